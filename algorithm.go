@@ -1,105 +1,271 @@
 package main
 
 import (
-	"database/sql"
 	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"crypto-trader/indicators"
 )
 
+// minBarsPerWindow is how many candles the fast window should span at least;
+// it decides which candle interval the WMAs are computed on.
+const minBarsPerWindow = 24
+
 // TradingSignal represents the recommendation from the algorithm
 type TradingSignal struct {
-	Action         string  // "BUY", "SELL", or "HOLD"
+	Action         string // "BUY", "SELL", or "HOLD"
 	CurrentPrice   float64
 	MovingAverage  float64
 	PercentChange  float64
 	Recommendation string
+
+	FastWMA             float64
+	SlowWMA             float64
+	InsufficientHistory bool          // true when less than the slow window of history is stored
+	HistoryAvailable    time.Duration // how much history the WMAs could use
+
+	Quantity float64 // amount to sell for a partial SELL, 0 for the whole position
+	ExitTier float64 // exit ladder tier (percent gain) behind a partial SELL
+	Reason   string  // what produced the signal: strategy (when empty), exit_ladder, stop_loss, trailing_stop, max_hold
 }
 
-// TradingAlgorithm analyzes price data and generates trading signals based on WMA crossover
-func TradingAlgorithm(db *sql.DB, currentPrice float64, movingAvgDays int, changeThreshold float64) (*TradingSignal, error) {
-	// Fetch price data for WMA calculation
-	query := `SELECT price FROM btc_price ORDER BY timestamp DESC LIMIT 240`
-	rows, err := db.Query(query)
-	if err != nil {
-		return nil, fmt.Errorf("failed to fetch prices: %w", err)
+// parseWindow parses a WMA window such as "7d", "4h" or "90m". Days are
+// accepted in addition to everything time.ParseDuration understands.
+func parseWindow(s string) (time.Duration, error) {
+	s = strings.TrimSpace(strings.ToLower(s))
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.ParseFloat(days, 64)
+		if err != nil || n <= 0 {
+			return 0, fmt.Errorf("invalid window %q", s)
+		}
+		return time.Duration(n * float64(24*time.Hour)), nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid window %q", s)
 	}
-	defer rows.Close()
+	return d, nil
+}
 
-	var prices []float64
-	for rows.Next() {
-		var p float64
-		if err := rows.Scan(&p); err != nil {
-			continue
-		}
-		prices = append([]float64{p}, prices...) // prepend to maintain chronological order
+// formatWindow renders a window the way parseWindow accepts it, e.g. "7d" or "4h".
+func formatWindow(d time.Duration) string {
+	if d%(24*time.Hour) == 0 {
+		return fmt.Sprintf("%dd", d/(24*time.Hour))
+	}
+	if d%time.Hour == 0 {
+		return fmt.Sprintf("%dh", d/time.Hour)
 	}
+	return d.String()
+}
 
-	// Need at least 30 data points for reliable signals
-	if len(prices) < 30 {
-		return &TradingSignal{
-			Action:         "HOLD",
-			CurrentPrice:   currentPrice,
-			MovingAverage:  0,
-			PercentChange:  0,
-			Recommendation: "",
-		}, nil
+// configuredWindows reads the fast and slow WMA windows from WMA_FAST and
+// WMA_SLOW, defaulting to 7d and 30d.
+func configuredWindows() (fast, slow time.Duration) {
+	fast, slow = 7*24*time.Hour, 30*24*time.Hour
+	if d, err := parseWindow(os.Getenv("WMA_FAST")); err == nil {
+		fast = d
 	}
+	if d, err := parseWindow(os.Getenv("WMA_SLOW")); err == nil {
+		slow = d
+	}
+	return fast, slow
+}
 
-	// Estimate samples per day
-	samplesPerDay := float64(len(prices)) / 1.0 // Assumes fetched data spans approximately 1 day
-	if samplesPerDay < 1 {
-		samplesPerDay = 1
+// configuredChangeThreshold reads the crossover threshold (percent) from
+// CHANGE_THRESHOLD, defaulting to 0.
+func configuredChangeThreshold() float64 {
+	if n, err := strconv.ParseFloat(strings.TrimSpace(os.Getenv("CHANGE_THRESHOLD")), 64); err == nil && n >= 0 {
+		return n
 	}
+	return 0
+}
 
-	// Window sizes for 7-day and 30-day WMAs
-	window7 := int(samplesPerDay * 7.0)
-	window30 := int(samplesPerDay * 30.0)
+// barInterval picks the coarsest aggregated candle interval (in minutes) that
+// still gives the fast window at least minBarsPerWindow bars.
+func barInterval(fast time.Duration) int {
+	best := tickIntervals[0]
+	for _, interval := range tickIntervals {
+		if fast/(time.Duration(interval)*time.Minute) >= minBarsPerWindow {
+			best = interval
+		}
+	}
+	return best
+}
 
-	if window7 < 1 {
-		window7 = 1
+// wmaSeries computes the time-based WMA of candle closes at every candle's
+// open time.
+func wmaSeries(candles []Candle, window time.Duration) []float64 {
+	times := make([]time.Time, len(candles))
+	for i, c := range candles {
+		times[i] = c.Time
 	}
-	if window30 < 1 {
-		window30 = 1
+	return indicators.TimeWMASeries(times, candleCloses(candles), window)
+}
+
+// WMACrossover is the built-in strategy: BUY when the fast WMA crosses above
+// the slow WMA (golden cross), SELL when it crosses below (death cross). With
+// a Threshold the fast WMA has to clear the slow one by that many percent, so
+// it must cross a band around the slow WMA rather than a line.
+type WMACrossover struct {
+	Fast      time.Duration
+	Slow      time.Duration
+	Threshold float64 // percent of the slow WMA
+}
+
+func init() {
+	RegisterStrategy("wma_crossover", newWMACrossover)
+}
+
+// newWMACrossover builds a crossover from "fast" and "slow" window and
+// "threshold" percent parameters, defaulting to WMA_FAST, WMA_SLOW and
+// CHANGE_THRESHOLD.
+func newWMACrossover(params map[string]string) (Strategy, error) {
+	fast, slow := configuredWindows()
+	threshold := configuredChangeThreshold()
+	for key, val := range params {
+		var err error
+		switch key {
+		case "fast":
+			fast, err = parseWindow(val)
+		case "slow":
+			slow, err = parseWindow(val)
+		case "threshold":
+			threshold, err = strconv.ParseFloat(val, 64)
+			if err == nil && threshold < 0 {
+				err = fmt.Errorf("must not be negative")
+			}
+		default:
+			return nil, fmt.Errorf("wma_crossover: unknown parameter %q", key)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("wma_crossover: %s: %w", key, err)
+		}
 	}
-	if window7 > len(prices) {
-		window7 = len(prices)
+	if fast >= slow {
+		return nil, fmt.Errorf("wma_crossover: fast window %s must be shorter than slow window %s", formatWindow(fast), formatWindow(slow))
 	}
-	if window30 > len(prices) {
-		window30 = len(prices)
+	return &WMACrossover{Fast: fast, Slow: slow, Threshold: threshold}, nil
+}
+
+func (w *WMACrossover) Name() string {
+	return "wma_crossover"
+}
+
+func (w *WMACrossover) Params() map[string]string {
+	return map[string]string{
+		"fast":      formatWindow(w.Fast),
+		"slow":      formatWindow(w.Slow),
+		"threshold": strconv.FormatFloat(w.Threshold, 'f', -1, 64),
 	}
+}
 
-	// Calculate WMAs
-	wma7 := computeWMA(prices, window7)
-	wma30 := computeWMA(prices, window30)
+func (w *WMACrossover) History() (int, time.Duration) {
+	return barInterval(w.Fast), w.Slow
+}
 
-	// Get current and previous WMA values
-	currentWMA7 := wma7[len(wma7)-1]
-	currentWMA30 := wma30[len(wma30)-1]
-	prevWMA7 := wma7[len(wma7)-2]
-	prevWMA30 := wma30[len(wma30)-2]
+// Evaluate analyzes the series and generates a trading signal based on WMA crossover.
+// The fast and slow windows are durations resolved against candle timestamps.
+func (w *WMACrossover) Evaluate(series Series) *TradingSignal {
+	candles := series.Candles
+	step := time.Duration(series.Interval) * time.Minute
 
-	// Calculate simple percent change for reference
-	avgPrice := (currentWMA7 + currentWMA30) / 2.0
-	percentChange := ((currentPrice - avgPrice) / avgPrice) * 100
+	// Without a full slow window the crossover is meaningless
+	signal := w.newSignal(series)
+	if len(candles) < 2 || signal.InsufficientHistory {
+		return w.insufficient(signal)
+	}
 
+	// Stream the candles through both WMAs, reading the previous values one
+	// bar before the latest candle
+	fastWMA := indicators.NewTimeWMA(w.Fast)
+	slowWMA := indicators.NewTimeWMA(w.Slow)
+	for _, c := range candles[:len(candles)-1] {
+		fastWMA.Update(c.Time, c.Close)
+		slowWMA.Update(c.Time, c.Close)
+	}
+	latest := candles[len(candles)-1]
+	prevFast := fastWMA.ValueAt(latest.Time.Add(-step))
+	prevSlow := slowWMA.ValueAt(latest.Time.Add(-step))
+	return w.crossover(signal, prevFast, prevSlow,
+		fastWMA.Update(latest.Time, latest.Close), slowWMA.Update(latest.Time, latest.Close))
+}
+
+// newSignal returns a HOLD signal for series, flagged when less than the
+// slow window of history is stored.
+func (w *WMACrossover) newSignal(series Series) *TradingSignal {
 	signal := &TradingSignal{
-		CurrentPrice:  currentPrice,
-		MovingAverage: avgPrice,
-		PercentChange: percentChange,
+		Action:       "HOLD",
+		CurrentPrice: series.Price,
+	}
+	if !series.Start.IsZero() {
+		signal.HistoryAvailable = series.Now.Sub(series.Start)
 	}
+	signal.InsufficientHistory = signal.HistoryAvailable < w.Slow
+	return signal
+}
+
+// insufficient marks signal as lacking the history for a crossover.
+func (w *WMACrossover) insufficient(signal *TradingSignal) *TradingSignal {
+	signal.InsufficientHistory = true
+	signal.Recommendation = fmt.Sprintf("insufficient history (%s of %s)",
+		signal.HistoryAvailable.Truncate(time.Minute), formatWindow(w.Slow))
+	return signal
+}
 
-	// Detect crossovers
-	// Golden Cross: 7d WMA crosses above 30d WMA (BUY signal)
-	if prevWMA7 <= prevWMA30 && currentWMA7 > currentWMA30 {
+// crossover fills in signal from the WMAs one bar ago and now.
+func (w *WMACrossover) crossover(signal *TradingSignal, prevFast, prevSlow, currentFast, currentSlow float64) *TradingSignal {
+	// Calculate simple percent change for reference
+	avgPrice := (currentFast + currentSlow) / 2.0
+	signal.MovingAverage = avgPrice
+	signal.PercentChange = ((signal.CurrentPrice - avgPrice) / avgPrice) * 100
+	signal.FastWMA = currentFast
+	signal.SlowWMA = currentSlow
+
+	// Detect crossovers of the band Threshold percent around the slow WMA
+	upper, lower := 1+w.Threshold/100, 1-w.Threshold/100
+	// Golden Cross: fast WMA crosses above slow WMA (BUY signal)
+	if prevFast <= prevSlow*upper && currentFast > currentSlow*upper {
 		signal.Action = "BUY"
 		signal.Recommendation = "** BUY **"
-	} else if prevWMA7 >= prevWMA30 && currentWMA7 < currentWMA30 {
-		// Death Cross: 7d WMA crosses below 30d WMA (SELL signal)
+	} else if prevFast >= prevSlow*lower && currentFast < currentSlow*lower {
+		// Death Cross: fast WMA crosses below slow WMA (SELL signal)
 		signal.Action = "SELL"
 		signal.Recommendation = "** SELL **"
-	} else {
-		signal.Action = "HOLD"
-		signal.Recommendation = ""
 	}
 
-	return signal, nil
+	return signal
+}
+
+// wmaStream is the state WMACrossover keeps for a backtest replay.
+type wmaStream struct {
+	w          *WMACrossover
+	fast, slow *indicators.TimeWMA
+	last       time.Time // open time of the latest closed candle
+}
+
+func (w *WMACrossover) NewStream() StrategyStream {
+	return &wmaStream{w: w, fast: indicators.NewTimeWMA(w.Fast), slow: indicators.NewTimeWMA(w.Slow)}
+}
+
+func (s *wmaStream) Close(c Candle) {
+	s.fast.Update(c.Time, c.Close)
+	s.slow.Update(c.Time, c.Close)
+	s.last = c.Time
+}
+
+func (s *wmaStream) Evaluate(bar Candle, series Series) *TradingSignal {
+	step := time.Duration(series.Interval) * time.Minute
+
+	// Evaluate needs a closed candle within the lookback loadSeries reads
+	signal := s.w.newSignal(series)
+	if s.last.IsZero() || s.last.Before(series.Now.Add(-s.w.Slow-2*step)) || signal.InsufficientHistory {
+		return s.w.insufficient(signal)
+	}
+
+	prevFast := s.fast.ValueAt(bar.Time.Add(-step))
+	prevSlow := s.slow.ValueAt(bar.Time.Add(-step))
+	return s.w.crossover(signal, prevFast, prevSlow, s.fast.Peek(bar.Time, bar.Close), s.slow.Peek(bar.Time, bar.Close))
 }
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"crypto-trader/store"
+)
+
+func TestParseWindow(t *testing.T) {
+	cases := map[string]time.Duration{
+		"7d":   7 * 24 * time.Hour,
+		"4h":   4 * time.Hour,
+		"90m":  90 * time.Minute,
+		"1.5d": 36 * time.Hour,
+	}
+	for in, want := range cases {
+		got, err := parseWindow(in)
+		if err != nil || got != want {
+			t.Fatalf("parseWindow(%q): expected %s, got %s (err %v)", in, want, got, err)
+		}
+	}
+	if _, err := parseWindow("soon"); err == nil {
+		t.Fatalf("expected error for invalid window")
+	}
+}
+
+func TestTradingAlgorithm_InsufficientHistory(t *testing.T) {
+	db := openMigratedTestDB(t)
+	now := time.Now().UTC().Truncate(time.Hour)
+	var candles []Candle
+	for i := 48; i >= 0; i-- {
+		candles = append(candles, Candle{Symbol: "XBT", Interval: 60, Time: now.Add(-time.Duration(i) * time.Hour), Close: 100})
+	}
+	if _, err := store.New(db).UpsertCandles(candles); err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+
+	signal, err := TradingAlgorithm(store.New(db), &WMACrossover{Fast: 7 * 24 * time.Hour, Slow: 30 * 24 * time.Hour}, "XBT", 100)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !signal.InsufficientHistory || signal.Action != "HOLD" {
+		t.Fatalf("expected insufficient history HOLD, got %+v", signal)
+	}
+}
+
+func TestTradingAlgorithm_GoldenCross(t *testing.T) {
+	st := store.NewMemory()
+	// 24h of flat hourly prices followed by a jump in the latest bar pulls the
+	// 4h WMA above the 24h WMA exactly on the last bar
+	now := time.Now().UTC().Truncate(time.Hour)
+	for i := 26; i >= 0; i-- {
+		price := 100.0
+		if i == 0 {
+			price = 120
+		}
+		st.AddCandles(Candle{Symbol: "XBT", Interval: 5, Time: now.Add(-time.Duration(i) * time.Hour), Close: price})
+	}
+
+	signal, err := TradingAlgorithm(st, &WMACrossover{Fast: 4 * time.Hour, Slow: 24 * time.Hour}, "XBT", 120)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if signal.Action != "BUY" {
+		t.Fatalf("expected BUY, got %+v", signal)
+	}
+}
+
+func TestWMACrossover_ThresholdIgnoresSmallCrosses(t *testing.T) {
+	st := store.NewMemory()
+	// A 1% jump in the latest bar crosses the WMAs by well under 1%
+	now := time.Now().UTC().Truncate(time.Hour)
+	for i := 26; i >= 0; i-- {
+		price := 100.0
+		if i == 0 {
+			price = 101
+		}
+		st.AddCandles(Candle{Symbol: "XBT", Interval: 5, Time: now.Add(-time.Duration(i) * time.Hour), Close: price})
+	}
+
+	for _, tc := range []struct {
+		threshold string
+		want      string
+	}{{"0", "BUY"}, {"1", "HOLD"}} {
+		strategy, err := newStrategy("wma_crossover", map[string]string{"fast": "4h", "slow": "24h", "threshold": tc.threshold})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		signal, err := TradingAlgorithm(st, strategy, "XBT", 101)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if signal.Action != tc.want {
+			t.Fatalf("threshold %s: expected %s, got %+v", tc.threshold, tc.want, signal)
+		}
+	}
+}
@@ -0,0 +1,524 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"time"
+
+	"crypto-trader/store"
+)
+
+// defaultBacktestFunds is the starting balance when neither -funds nor the
+// settings table provide one.
+const defaultBacktestFunds = 10000.0
+
+// pricePoint is one price observation replayed by the backtester.
+type pricePoint struct {
+	Time  time.Time
+	Price float64
+}
+
+// BacktestConfig holds the account settings a backtest trades with.
+type BacktestConfig struct {
+	InitialFunds float64
+	FeeRate      float64     // percent of each trade's value, as in the settings table
+	Ladder       *ExitLadder // optional take-profit ladder, nil to disable
+}
+
+// BacktestTrade is one round trip: a BUY and the SELL that closed it, with
+// any exit ladder sells in between. Trades still open at the end of the range
+// are marked to the last price.
+type BacktestTrade struct {
+	EntryTime  time.Time
+	ExitTime   time.Time
+	EntryPrice float64 // average when the position was added to
+	ExitPrice  float64 // price of the last sell, or the last price while open
+	Quantity   float64 // total quantity bought
+	Cost       float64 // cash spent on entry, fees included
+	Proceeds   float64 // cash received from sells, after fees
+	PnL        float64 // profit after fees on both sides
+	Exits      int     // number of sells, partial ones included
+	Open       bool
+}
+
+// EquityPoint is the account value at one replayed price.
+type EquityPoint struct {
+	Time   time.Time
+	Price  float64
+	Equity float64
+}
+
+// BacktestResult summarises a backtest. Returns and drawdown are fractions
+// (0.05 = 5%).
+type BacktestResult struct {
+	Strategy     string
+	Params       map[string]string
+	Symbol       string
+	From, To     time.Time
+	InitialFunds float64
+	FinalEquity  float64
+	TotalReturn  float64
+	MaxDrawdown  float64
+	WinRate      float64 // share of closed trades with a positive PnL
+	Sharpe       float64 // annualised from daily equity returns
+	Trades       []BacktestTrade
+	Equity       []EquityPoint
+}
+
+// ClosedTrades returns the trades that were exited within the range.
+func (r *BacktestResult) ClosedTrades() []BacktestTrade {
+	var closed []BacktestTrade
+	for _, t := range r.Trades {
+		if !t.Open {
+			closed = append(closed, t)
+		}
+	}
+	return closed
+}
+
+// backtestData is the stored history a backtest replays.
+type backtestData struct {
+	Candles []Candle     // candles at the strategy's interval, covering its lookback before From
+	Start   time.Time    // open time of the earliest stored candle
+	Prices  []pricePoint // prices to replay, oldest first
+}
+
+// loadBacktestData reads the history needed to replay strategy over
+// [from, to].
+func loadBacktestData(db *sql.DB, strategy Strategy, symbol string, from, to time.Time) (*backtestData, error) {
+	interval, lookback := strategy.History()
+	return loadBacktestHistory(db, symbol, interval, lookback, from, to)
+}
+
+// loadBacktestHistory reads interval candles from lookback before from up to
+// to, and the prices to replay over [from, to]. Prices come from btc_price;
+// when no ticks were collected in the range (e.g. only backfilled candles
+// exist) each candle's close is replayed at the end of its bar instead.
+func loadBacktestHistory(db *sql.DB, symbol string, interval int, lookback time.Duration, from, to time.Time) (*backtestData, error) {
+	step := time.Duration(interval) * time.Minute
+	st := store.New(db)
+
+	candles, err := st.CandlesSince(symbol, interval, from.Add(-lookback-2*step))
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch candles: %w", err)
+	}
+	for len(candles) > 0 && candles[len(candles)-1].Time.After(to) {
+		candles = candles[:len(candles)-1]
+	}
+	start, err := st.OldestCandleTime(symbol, interval)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch candles: %w", err)
+	}
+
+	ticks, err := st.PricesBetween(symbol, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch prices: %w", err)
+	}
+	prices := make([]pricePoint, 0, len(ticks))
+	for _, t := range ticks {
+		prices = append(prices, pricePoint{Time: t.Timestamp, Price: t.Price})
+	}
+
+	if len(prices) == 0 {
+		for _, c := range candles {
+			end := c.Time.Add(step - time.Second)
+			if c.Time.Before(from) || end.After(to) {
+				continue
+			}
+			prices = append(prices, pricePoint{Time: end, Price: c.Close})
+		}
+	}
+	return &backtestData{Candles: candles, Start: start, Prices: prices}, nil
+}
+
+// runBacktest replays data.Prices through strategy with a simulated clock. At
+// each price the strategy sees the candles that had closed by then plus the
+// bar in progress built from the prices replayed so far, as it would live.
+// A StreamingStrategy is fed each candle once as it closes instead.
+// BUY signals invest all cash and SELL signals close the whole position;
+// each side pays cfg.FeeRate percent. With cfg.Ladder set, the ladder sells
+// part of the position at each tier while the strategy holds, as in the
+// collector.
+func runBacktest(strategy Strategy, symbol string, data *backtestData, cfg BacktestConfig) *BacktestResult {
+	interval, lookback := strategy.History()
+	step := time.Duration(interval) * time.Minute
+	fee := cfg.FeeRate / 100
+
+	result := &BacktestResult{
+		Strategy:     strategy.Name(),
+		Params:       strategy.Params(),
+		Symbol:       symbol,
+		InitialFunds: cfg.InitialFunds,
+		FinalEquity:  cfg.InitialFunds,
+	}
+	if len(data.Prices) == 0 {
+		return result
+	}
+	result.From = data.Prices[0].Time
+	result.To = data.Prices[len(data.Prices)-1].Time
+
+	cash, qty := cfg.InitialFunds, 0.0
+	var open *BacktestTrade
+	var hit map[float64]bool
+	sell := func(q float64, p pricePoint) {
+		proceeds := q * p.Price * (1 - fee)
+		cash += proceeds
+		qty -= q
+		open.Proceeds += proceeds
+		open.ExitTime, open.ExitPrice = p.Time, p.Price
+		open.Exits++
+		if qty <= open.Quantity*1e-9 {
+			qty = 0
+			open.PnL = open.Proceeds - open.Cost
+			result.Trades = append(result.Trades, *open)
+			open = nil
+		}
+	}
+	var stream StrategyStream
+	if s, ok := strategy.(StreamingStrategy); ok {
+		stream = s.NewStream()
+	}
+	var bar Candle
+	lo, hi := 0, 0
+	for _, p := range data.Prices {
+		// Merge the price into the bar in progress
+		if bucket := p.Time.UTC().Truncate(step); !bar.Time.Equal(bucket) {
+			bar = Candle{Symbol: symbol, Interval: interval, Time: bucket, Open: p.Price, High: p.Price, Low: p.Price}
+		}
+		bar.High = math.Max(bar.High, p.Price)
+		bar.Low = math.Min(bar.Low, p.Price)
+		bar.Close = p.Price
+		bar.Count++
+
+		// Candles that closed by now
+		for hi < len(data.Candles) && !data.Candles[hi].Time.Add(step).After(p.Time) {
+			if stream != nil {
+				stream.Close(data.Candles[hi])
+			}
+			hi++
+		}
+
+		series := Series{
+			Symbol:   symbol,
+			Interval: interval,
+			Start:    data.Start,
+			Price:    p.Price,
+			Now:      p.Time,
+		}
+		var signal *TradingSignal
+		if stream != nil {
+			signal = stream.Evaluate(bar, series)
+		} else {
+			// Rebuild the lookback from the closed candles inside it
+			for lo < hi && data.Candles[lo].Time.Before(p.Time.Add(-lookback-2*step)) {
+				lo++
+			}
+			series.Candles = make([]Candle, hi-lo, hi-lo+1)
+			copy(series.Candles, data.Candles[lo:hi])
+			series.Candles = append(series.Candles, bar)
+			signal = strategy.Evaluate(series)
+		}
+
+		switch {
+		case signal.Action == "BUY" && cash > 0:
+			bought := cash * (1 - fee) / p.Price
+			if open == nil {
+				open = &BacktestTrade{EntryTime: p.Time}
+				hit = make(map[float64]bool)
+			}
+			// Adding cash left by ladder sells averages the entry price
+			open.EntryPrice = (open.EntryPrice*qty + p.Price*bought) / (qty + bought)
+			open.Quantity += bought
+			open.Cost += cash
+			qty += bought
+			cash = 0
+		case signal.Action == "SELL" && open != nil:
+			sell(qty, p)
+		case signal.Action == "HOLD" && open != nil:
+			if tier, ok := cfg.Ladder.Next(open.EntryPrice, p.Price, hit); ok {
+				hit[tier.Gain] = true
+				sell(tier.SellQuantity(open.Quantity, qty), p)
+			}
+		}
+
+		result.Equity = append(result.Equity, EquityPoint{Time: p.Time, Price: p.Price, Equity: cash + qty*p.Price})
+	}
+
+	last := data.Prices[len(data.Prices)-1]
+	if open != nil {
+		open.ExitTime, open.ExitPrice, open.Open = last.Time, last.Price, true
+		open.PnL = open.Proceeds + qty*last.Price - open.Cost
+		result.Trades = append(result.Trades, *open)
+	}
+
+	result.FinalEquity = cash + qty*last.Price
+	if cfg.InitialFunds > 0 {
+		result.TotalReturn = result.FinalEquity/cfg.InitialFunds - 1
+	}
+	result.MaxDrawdown = maxDrawdown(result.Equity)
+	result.Sharpe = sharpeRatio(result.Equity)
+	if closed := result.ClosedTrades(); len(closed) > 0 {
+		wins := 0
+		for _, t := range closed {
+			if t.PnL > 0 {
+				wins++
+			}
+		}
+		result.WinRate = float64(wins) / float64(len(closed))
+	}
+	return result
+}
+
+// maxDrawdown returns the largest peak-to-trough fall of the equity curve as a
+// fraction of the peak.
+func maxDrawdown(equity []EquityPoint) float64 {
+	peak, worst := 0.0, 0.0
+	for _, e := range equity {
+		peak = math.Max(peak, e.Equity)
+		if peak > 0 {
+			worst = math.Max(worst, (peak-e.Equity)/peak)
+		}
+	}
+	return worst
+}
+
+// sharpeRatio returns the annualised Sharpe ratio (risk-free rate 0) of the
+// daily returns of the equity curve, using each UTC day's last value. Crypto
+// trades every day, so a year is 365 periods.
+func sharpeRatio(equity []EquityPoint) float64 {
+	daily := dailyEquity(equity)
+	if len(daily) < 3 {
+		return 0
+	}
+
+	returns := make([]float64, 0, len(daily)-1)
+	for i := 1; i < len(daily); i++ {
+		if daily[i-1].Equity > 0 {
+			returns = append(returns, daily[i].Equity/daily[i-1].Equity-1)
+		}
+	}
+	if len(returns) < 2 {
+		return 0
+	}
+	var mean float64
+	for _, r := range returns {
+		mean += r
+	}
+	mean /= float64(len(returns))
+	var variance float64
+	for _, r := range returns {
+		variance += (r - mean) * (r - mean)
+	}
+	variance /= float64(len(returns) - 1)
+	if variance == 0 {
+		return 0
+	}
+	return mean / math.Sqrt(variance) * math.Sqrt(365)
+}
+
+// dailyEquity returns the last point of each UTC day in the equity curve.
+func dailyEquity(equity []EquityPoint) []EquityPoint {
+	var daily []EquityPoint
+	for i, e := range equity {
+		day := e.Time.UTC().Truncate(24 * time.Hour)
+		if i+1 < len(equity) && equity[i+1].Time.UTC().Truncate(24*time.Hour).Equal(day) {
+			continue
+		}
+		daily = append(daily, e)
+	}
+	return daily
+}
+
+// backtestSettings reads the initial funds and fee rate saved for symbol,
+// falling back to the settings saved for all symbols and then the defaults.
+func backtestSettings(db *sql.DB, symbol string) BacktestConfig {
+	settings, err := store.New(db).LatestSettings(symbol)
+	if err != nil {
+		settings = store.Settings{FeeRate: store.DefaultFeeRate}
+	}
+	cfg := BacktestConfig{InitialFunds: settings.InitialFunds, FeeRate: settings.FeeRate}
+	if cfg.InitialFunds <= 0 {
+		cfg.InitialFunds = defaultBacktestFunds
+	}
+	return cfg
+}
+
+// parseBacktestTime accepts a date (2006-01-02) or an RFC 3339 timestamp.
+func parseBacktestTime(s string) (time.Time, error) {
+	if t, err := time.Parse("2006-01-02", s); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
+
+// backtestRange resolves the -from, -to and -days flags. to defaults to now
+// and from to days before to.
+func backtestRange(fromFlag, toFlag string, days int) (from, to time.Time, err error) {
+	to = time.Now().UTC()
+	if toFlag != "" {
+		if to, err = parseBacktestTime(toFlag); err != nil {
+			return from, to, fmt.Errorf("invalid -to: %w", err)
+		}
+	}
+	from = to.AddDate(0, 0, -days)
+	if fromFlag != "" {
+		if from, err = parseBacktestTime(fromFlag); err != nil {
+			return from, to, fmt.Errorf("invalid -from: %w", err)
+		}
+	}
+	if !from.Before(to) {
+		return from, to, fmt.Errorf("-from must be before -to")
+	}
+	return from, to, nil
+}
+
+// backtestCommand implements `crypto-trader backtest`: it replays stored
+// prices through a strategy and reports how it would have traded.
+func backtestCommand(args []string) {
+	fs := flag.NewFlagSet("backtest", flag.ExitOnError)
+	symbol := fs.String("symbol", configuredTickers()[0], "Symbol to backtest (e.g. BTC, ETH)")
+	fromFlag := fs.String("from", "", "Start of the range, 2006-01-02 or RFC 3339 (default: -days before -to)")
+	toFlag := fs.String("to", "", "End of the range, 2006-01-02 or RFC 3339 (default: now)")
+	days := fs.Int("days", 30, "Days to replay when -from is not set")
+	strategyName := fs.String("strategy", "", "Strategy to backtest (default: STRATEGY setting)")
+	strategyParams := fs.String("params", "", "Strategy parameters as key=value,key=value (default: STRATEGY_PARAMS setting)")
+	funds := fs.Float64("funds", 0, "Initial funds (default: settings table, else 10000)")
+	fee := fs.Float64("fee", -1, "Transaction fee percent per trade (default: settings table)")
+	ladder := fs.String("ladder", os.Getenv("EXIT_LADDER"), "Exit ladder tiers as gain:fraction,... (default: EXIT_LADDER setting)")
+	equityFile := fs.String("equity", "", "Write the equity curve to this CSV file")
+	fs.Parse(args)
+
+	strategy, err := configuredStrategy()
+	if *strategyName != "" {
+		var params map[string]string
+		if params, err = parseStrategyParams(*strategyParams); err == nil {
+			strategy, err = newStrategy(*strategyName, params)
+		}
+	}
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	from, to, err := backtestRange(*fromFlag, *toFlag, *days)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	sym := normalizeSymbol(*symbol)
+
+	db, err := openDatabase()
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	defer db.Close()
+
+	// Roll any ticks the collector has not aggregated yet into candles
+	if _, err := catchUpCandles(store.New(db), sym); err != nil {
+		fmt.Println("Error aggregating candles:", err)
+		os.Exit(1)
+	}
+
+	cfg := backtestSettings(db, sym)
+	if *funds > 0 {
+		cfg.InitialFunds = *funds
+	}
+	if *fee >= 0 {
+		cfg.FeeRate = *fee
+	}
+	if cfg.Ladder, err = parseExitLadder(*ladder); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	data, err := loadBacktestData(db, strategy, sym, from, to)
+	if err != nil {
+		fmt.Println("Error loading history:", err)
+		os.Exit(1)
+	}
+	if len(data.Prices) == 0 {
+		fmt.Printf("No stored prices for %s between %s and %s\n", sym, from.Format(time.RFC3339), to.Format(time.RFC3339))
+		os.Exit(1)
+	}
+
+	result := runBacktest(strategy, sym, data, cfg)
+	printBacktestResult(result)
+
+	if *equityFile != "" {
+		if err := writeEquityCSV(*equityFile, result.Equity); err != nil {
+			fmt.Println("Error writing equity curve:", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Equity curve written to %s\n", *equityFile)
+	}
+}
+
+// printBacktestResult prints the trades, a daily equity curve and the summary.
+func printBacktestResult(r *BacktestResult) {
+	fmt.Printf("Backtest %s(%s) on %s, %s to %s, %d prices\n",
+		r.Strategy, formatStrategyParams(r.Params), r.Symbol,
+		r.From.Format("2006-01-02 15:04"), r.To.Format("2006-01-02 15:04"), len(r.Equity))
+
+	fmt.Println("\nTrades:")
+	if len(r.Trades) == 0 {
+		fmt.Println("  none")
+	}
+	for i, t := range r.Trades {
+		exit := "exit"
+		if t.Open {
+			exit = "open"
+		}
+		sells := ""
+		if t.Exits > 1 || (t.Open && t.Exits > 0) {
+			sells = fmt.Sprintf(", %d sells", t.Exits)
+		}
+		fmt.Printf("  %3d  entry %s @ $%.2f  %s %s @ $%.2f  PnL $%.2f (%+.2f%%)%s\n",
+			i+1, t.EntryTime.Format("2006-01-02 15:04"), t.EntryPrice,
+			exit, t.ExitTime.Format("2006-01-02 15:04"), t.ExitPrice,
+			t.PnL, t.PnL/t.Cost*100, sells)
+	}
+
+	fmt.Println("\nEquity curve (daily close):")
+	for _, e := range dailyEquity(r.Equity) {
+		fmt.Printf("  %s  price $%.2f  equity $%.2f\n", e.Time.Format("2006-01-02"), e.Price, e.Equity)
+	}
+
+	fmt.Println("\nSummary:")
+	fmt.Printf("  Initial funds:  $%.2f\n", r.InitialFunds)
+	fmt.Printf("  Final equity:   $%.2f\n", r.FinalEquity)
+	fmt.Printf("  Total return:   %+.2f%%\n", r.TotalReturn*100)
+	fmt.Printf("  Max drawdown:   %.2f%%\n", r.MaxDrawdown*100)
+	fmt.Printf("  Trades:         %d closed, %d open\n", len(r.ClosedTrades()), len(r.Trades)-len(r.ClosedTrades()))
+	fmt.Printf("  Win rate:       %.1f%%\n", r.WinRate*100)
+	fmt.Printf("  Sharpe ratio:   %.2f\n", r.Sharpe)
+}
+
+// writeEquityCSV writes the equity curve as time,price,equity rows.
+func writeEquityCSV(path string, equity []EquityPoint) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := csv.NewWriter(f)
+	w.Write([]string{"time", "price", "equity"})
+	for _, e := range equity {
+		w.Write([]string{
+			e.Time.Format(time.RFC3339),
+			strconv.FormatFloat(e.Price, 'f', 2, 64),
+			strconv.FormatFloat(e.Equity, 'f', 2, 64),
+		})
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
+	return f.Close()
+}
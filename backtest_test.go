@@ -0,0 +1,144 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+// bandStrategy buys below Low and sells above High, recording every series it
+// sees so tests can check what the backtester exposed.
+type bandStrategy struct {
+	Low, High float64
+	seen      []Series
+}
+
+func (s *bandStrategy) Name() string                  { return "band" }
+func (s *bandStrategy) Params() map[string]string     { return nil }
+func (s *bandStrategy) History() (int, time.Duration) { return 60, 3 * time.Hour }
+func (s *bandStrategy) Evaluate(series Series) *TradingSignal {
+	s.seen = append(s.seen, series)
+	switch {
+	case series.Price < s.Low:
+		return &TradingSignal{Action: "BUY", CurrentPrice: series.Price}
+	case series.Price > s.High:
+		return &TradingSignal{Action: "SELL", CurrentPrice: series.Price}
+	}
+	return &TradingSignal{Action: "HOLD", CurrentPrice: series.Price}
+}
+
+func TestRunBacktest_TradesWithFeesAndMetrics(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	prices := []float64{100, 90, 95, 120, 130, 80, 70, 75}
+	data := &backtestData{Start: start}
+	for i, p := range prices {
+		ts := start.Add(time.Duration(i) * 12 * time.Hour)
+		data.Prices = append(data.Prices, pricePoint{Time: ts, Price: p})
+		data.Candles = append(data.Candles, Candle{Time: ts.Truncate(time.Hour), Close: p})
+	}
+
+	strategy := &bandStrategy{Low: 92, High: 110}
+	result := runBacktest(strategy, "XBT", data, BacktestConfig{InitialFunds: 1000, FeeRate: 1})
+
+	// Buy at 90, sell at 120, buy at 80, still open at 75
+	if len(result.Trades) != 2 || result.Trades[1].Open != true {
+		t.Fatalf("expected one closed and one open trade, got %+v", result.Trades)
+	}
+	first := result.Trades[0]
+	wantCash := 1000 * 0.99 / 90 * 120 * 0.99
+	if math.Abs(first.PnL-(wantCash-1000)) > 1e-9 {
+		t.Fatalf("expected PnL %.4f, got %.4f", wantCash-1000, first.PnL)
+	}
+	wantFinal := wantCash * 0.99 / 80 * 75
+	if math.Abs(result.FinalEquity-wantFinal) > 1e-9 {
+		t.Fatalf("expected final equity %.4f, got %.4f", wantFinal, result.FinalEquity)
+	}
+	if math.Abs(result.TotalReturn-(wantFinal/1000-1)) > 1e-12 {
+		t.Fatalf("expected total return %.4f, got %.4f", wantFinal/1000-1, result.TotalReturn)
+	}
+	if result.WinRate != 1 {
+		t.Fatalf("expected win rate 1, got %v", result.WinRate)
+	}
+	if result.MaxDrawdown <= 0 || len(result.Equity) != len(prices) {
+		t.Fatalf("unexpected drawdown %v or equity length %d", result.MaxDrawdown, len(result.Equity))
+	}
+
+	// The strategy must never see a candle that had not opened yet
+	for _, s := range strategy.seen {
+		last := s.Candles[len(s.Candles)-1]
+		if last.Time.After(s.Now) || last.Close != s.Price {
+			t.Fatalf("series at %s leaks future data: %+v", s.Now, last)
+		}
+	}
+}
+
+// seriesOnly hides a strategy's NewStream so runBacktest rebuilds the Series.
+type seriesOnly struct{ Strategy }
+
+func TestRunBacktest_StreamingMatchesSeries(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	data := &backtestData{Start: start}
+	for i := 0; i < 30*72; i++ {
+		ts := start.Add(time.Duration(i) * 20 * time.Minute)
+		price := 100 + 10*math.Sin(float64(i)/40) + 3*math.Sin(float64(i)/7)
+		data.Prices = append(data.Prices, pricePoint{Time: ts, Price: price})
+		if n := len(data.Candles); n > 0 && data.Candles[n-1].Time.Equal(ts.Truncate(time.Hour)) {
+			data.Candles[n-1].Close = price
+		} else {
+			data.Candles = append(data.Candles, Candle{Time: ts.Truncate(time.Hour), Close: price})
+		}
+	}
+
+	strategy := &WMACrossover{Fast: 24 * time.Hour, Slow: 3 * 24 * time.Hour}
+	cfg := BacktestConfig{InitialFunds: 1000, FeeRate: 0.1}
+	streamed := runBacktest(strategy, "XBT", data, cfg)
+	rebuilt := runBacktest(seriesOnly{strategy}, "XBT", data, cfg)
+
+	if len(rebuilt.Trades) < 2 {
+		t.Fatalf("expected the test data to produce trades, got %d", len(rebuilt.Trades))
+	}
+	if len(streamed.Trades) != len(rebuilt.Trades) {
+		t.Fatalf("expected %d trades, got %d", len(rebuilt.Trades), len(streamed.Trades))
+	}
+	for i := range rebuilt.Trades {
+		if !streamed.Trades[i].EntryTime.Equal(rebuilt.Trades[i].EntryTime) || !streamed.Trades[i].ExitTime.Equal(rebuilt.Trades[i].ExitTime) {
+			t.Fatalf("trade %d: expected %+v, got %+v", i, rebuilt.Trades[i], streamed.Trades[i])
+		}
+	}
+	if math.Abs(streamed.FinalEquity-rebuilt.FinalEquity) > 1e-6 {
+		t.Fatalf("expected final equity %.6f, got %.6f", rebuilt.FinalEquity, streamed.FinalEquity)
+	}
+}
+
+func TestMaxDrawdown_PeakToTrough(t *testing.T) {
+	var equity []EquityPoint
+	for _, v := range []float64{100, 120, 90, 110, 60, 130} {
+		equity = append(equity, EquityPoint{Equity: v})
+	}
+	if got := maxDrawdown(equity); math.Abs(got-0.5) > 1e-12 {
+		t.Fatalf("expected drawdown 0.5, got %v", got)
+	}
+}
+
+func TestSharpeRatio_UsesDailyReturns(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	var equity []EquityPoint
+	for i, v := range []float64{100, 101, 103, 102, 105} {
+		day := start.AddDate(0, 0, i)
+		// Intraday noise is ignored; only each day's last value counts
+		equity = append(equity, EquityPoint{Time: day, Equity: 1}, EquityPoint{Time: day.Add(23 * time.Hour), Equity: v})
+	}
+
+	returns := []float64{0.01, 103.0/101 - 1, 102.0/103 - 1, 105.0/102 - 1}
+	var mean, variance float64
+	for _, r := range returns {
+		mean += r / 4
+	}
+	for _, r := range returns {
+		variance += (r - mean) * (r - mean) / 3
+	}
+	want := mean / math.Sqrt(variance) * math.Sqrt(365)
+	if got := sharpeRatio(equity); math.Abs(got-want) > 1e-9 {
+		t.Fatalf("expected Sharpe %.6f, got %.6f", want, got)
+	}
+}
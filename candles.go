@@ -0,0 +1,73 @@
+package main
+
+import (
+	"time"
+
+	"crypto-trader/store"
+)
+
+// Candle is one OHLC bar for a symbol, as stored by the store package.
+type Candle = store.Candle
+
+// tickIntervals are the timeframes (in minutes) raw ticks are rolled up into.
+var tickIntervals = store.TickIntervals
+
+// intervalNames maps the timeframe names accepted by the API to minutes.
+var intervalNames = map[string]int{"1m": 1, "5m": 5, "15m": 15, "30m": 30, "1h": 60, "4h": 240, "1d": 1440}
+
+// catchUpCandles rolls up every btc_price row for symbol that has not been
+// aggregated yet, e.g. ticks collected before aggregation existed. It returns
+// how many ticks were applied.
+func catchUpCandles(st store.Store, symbol string) (int, error) {
+	ticks, err := st.UnrolledPrices(symbol)
+	if err != nil || len(ticks) == 0 {
+		return 0, err
+	}
+	if err := st.RollUpTicks(ticks...); err != nil {
+		return 0, err
+	}
+	return len(ticks), nil
+}
+
+// maxChartPoints bounds the prices /api/prices returns for long ranges.
+const maxChartPoints = 2500
+
+// chartInterval returns the candle interval /api/prices serves a range of
+// days at: the finest tick interval that fits maxChartPoints, or 0 for raw
+// ticks when days is 1.
+func chartInterval(days int) int {
+	if days <= 1 {
+		return 0
+	}
+	for _, interval := range tickIntervals {
+		if days*1440/interval <= maxChartPoints {
+			return interval
+		}
+	}
+	return tickIntervals[len(tickIntervals)-1]
+}
+
+// chartPrices returns the closes of symbol's interval candles since since as
+// prices, ending with the latest tick so the chart stays current. Candle
+// prices have no ID.
+func chartPrices(st store.Store, symbol string, interval int, since time.Time) ([]store.Price, error) {
+	candles, err := st.CandlesSince(symbol, interval, since)
+	if err != nil {
+		return nil, err
+	}
+	prices := make([]store.Price, 0, len(candles)+1)
+	for _, c := range candles {
+		prices = append(prices, store.Price{Symbol: symbol, Price: c.Close, Timestamp: c.Time})
+	}
+	latest, err := st.LatestPrice(symbol)
+	if err == store.ErrNotFound {
+		return prices, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(prices) == 0 || latest.Timestamp.After(prices[len(prices)-1].Timestamp) {
+		prices = append(prices, latest)
+	}
+	return prices, nil
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"crypto-trader/store"
+)
+
+func TestCatchUpCandles_RollsTicksIntoIntervals(t *testing.T) {
+	db := openMigratedTestDB(t)
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	ticks := []struct {
+		offset time.Duration
+		price  float64
+	}{
+		{0, 100}, {20 * time.Second, 105}, {40 * time.Second, 95}, {70 * time.Second, 98},
+	}
+	for _, tk := range ticks {
+		if _, err := db.Exec(`INSERT INTO btc_price (symbol, price, timestamp) VALUES ('XBT', ?, ?)`, tk.price, start.Add(tk.offset)); err != nil {
+			t.Fatalf("setup failed: %v", err)
+		}
+	}
+
+	n, err := catchUpCandles(store.New(db), "XBT")
+	if err != nil || n != 4 {
+		t.Fatalf("expected 4 ticks rolled up, got %d (err %v)", n, err)
+	}
+	// Nothing new on a second pass
+	if n, err := catchUpCandles(store.New(db), "XBT"); err != nil || n != 0 {
+		t.Fatalf("expected 0 ticks on second pass, got %d (err %v)", n, err)
+	}
+
+	oneMinute, err := store.New(db).CandlesSince("XBT", 1, start)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(oneMinute) != 2 {
+		t.Fatalf("expected 2 one-minute candles, got %d", len(oneMinute))
+	}
+	first := oneMinute[0]
+	if first.Open != 100 || first.High != 105 || first.Low != 95 || first.Close != 95 || first.Count != 3 {
+		t.Fatalf("unexpected first candle: %+v", first)
+	}
+
+	fiveMinute, err := store.New(db).CandlesSince("XBT", 5, start)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(fiveMinute) != 1 || fiveMinute[0].Close != 98 || fiveMinute[0].Count != 4 {
+		t.Fatalf("unexpected five-minute candles: %+v", fiveMinute)
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const coinbaseBaseURL = "https://api.exchange.coinbase.com"
+
+// CoinbaseSource is a PriceSource backed by Coinbase Exchange's public REST API.
+type CoinbaseSource struct {
+	BaseURL string
+	Client  *http.Client
+}
+
+// NewCoinbaseSource returns a CoinbaseSource pointed at the live Coinbase API.
+func NewCoinbaseSource() *CoinbaseSource {
+	return &CoinbaseSource{
+		BaseURL: coinbaseBaseURL,
+		Client:  &http.Client{Timeout: 15 * time.Second},
+	}
+}
+
+func (c *CoinbaseSource) Name() string {
+	return "coinbase"
+}
+
+// Quote fetches the current ticker for symbol from Coinbase.
+func (c *CoinbaseSource) Quote(ctx context.Context, symbol string) (*Quote, error) {
+	// Coinbase uses BTC rather than Kraken's XBT
+	base := strings.ToUpper(symbol)
+	if base == "XBT" {
+		base = "BTC"
+	}
+	url := fmt.Sprintf("%s/products/%s-USD/ticker", c.BaseURL, base)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", url, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", url, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: status %d: %s", url, resp.StatusCode, string(body))
+	}
+
+	var ticker struct {
+		Price  string    `json:"price"`
+		Bid    string    `json:"bid"`
+		Ask    string    `json:"ask"`
+		Volume string    `json:"volume"`
+		Time   time.Time `json:"time"`
+	}
+	if err := json.Unmarshal(body, &ticker); err != nil {
+		return nil, fmt.Errorf("%s: %w", url, err)
+	}
+
+	quote := &Quote{
+		Symbol:    symbol,
+		Timestamp: ticker.Time.UTC(),
+		Source:    url,
+	}
+	if quote.Price, err = strconv.ParseFloat(ticker.Price, 64); err != nil {
+		return nil, fmt.Errorf("price not found in response from %s: %s", url, string(body))
+	}
+	quote.Bid, _ = strconv.ParseFloat(ticker.Bid, 64)
+	quote.Ask, _ = strconv.ParseFloat(ticker.Ask, 64)
+	quote.Volume, _ = strconv.ParseFloat(ticker.Volume, 64)
+	if ticker.Time.IsZero() {
+		quote.Timestamp = time.Now().UTC()
+	}
+	return quote, nil
+}
@@ -1,20 +1,70 @@
 package main
 
 import (
+	"context"
+	"database/sql"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	"os"
+	"strconv"
 	"strings"
+	"time"
 )
 
+const krakenBaseURL = "https://api.kraken.com"
+
+// krakenAPIURL returns the Kraken REST base URL: KRAKEN_BASE_URL when set
+// (e.g. a local fakeexchange), else the live API.
+func krakenAPIURL() string {
+	if val := strings.TrimRight(strings.TrimSpace(os.Getenv("KRAKEN_BASE_URL")), "/"); val != "" {
+		return val
+	}
+	return krakenBaseURL
+}
+
 // Struct for Kraken API response
 type KrakenTickerResponse struct {
+	Error  []string `json:"error"`
 	Result map[string]struct {
-		C []string `json:"c"`
+		A []string `json:"a"` // ask: price, whole lot volume, lot volume
+		B []string `json:"b"` // bid: price, whole lot volume, lot volume
+		C []string `json:"c"` // last trade closed: price, lot volume
+		V []string `json:"v"` // volume: today, last 24 hours
 	} `json:"result"`
 }
 
+// krakenTickerMap maps common ticker names to Kraken asset codes.
+var krakenTickerMap = map[string]string{
+	"BTC": "XBT",
+	"ETH": "ETH",
+	"LTC": "LTC",
+	// Add more mappings as needed
+}
+
+// KrakenSource is a PriceSource backed by Kraken's public REST API.
+type KrakenSource struct {
+	BaseURL string
+	Client  *http.Client
+	Pairs   *krakenPairCache // optional; nil downloads AssetPairs on every quote
+}
+
+// NewKrakenSource returns a KrakenSource pointed at krakenAPIURL. When db
+// is non-nil, resolved asset pairs are cached in it for ttl.
+func NewKrakenSource(db *sql.DB, ttl time.Duration) *KrakenSource {
+	k := &KrakenSource{
+		BaseURL: krakenAPIURL(),
+		Client:  &http.Client{Timeout: 15 * time.Second},
+	}
+	k.Pairs = newKrakenPairCache(db, ttl, k.fetchAssetPairs)
+	return k
+}
+
+func (k *KrakenSource) Name() string {
+	return "kraken"
+}
+
 // detectKrakenPair inspects an AssetPairs JSON blob and returns the best matching
 // pair key (e.g., "XXBTZUSD") for the given krakenTicker (e.g., "XBT"). Returns
 // empty string if no suitable pair is found.
@@ -46,81 +96,158 @@ func detectKrakenPair(krakenTicker string, assetPairsJSON []byte) string {
 	return ""
 }
 
-func getBTCPrice(ticker string) (float64, string, error) {
-	// Kraken expects XBT for BTC, ETH for Ethereum, etc. Map common names to Kraken codes.
-	tickerMap := map[string]string{
-		"BTC": "XBT",
-		"ETH": "ETH",
-		"LTC": "LTC",
-		// Add more mappings as needed
+// krakenTicker maps a common ticker name (e.g. "BTC") to its Kraken asset code.
+func krakenTicker(symbol string) string {
+	symbol = strings.ToUpper(symbol)
+	if val, ok := krakenTickerMap[symbol]; ok {
+		return val
+	}
+	return symbol
+}
+
+// get performs a GET request against the Kraken API and returns the response
+// body. Responses other than 200 OK are returned as errors.
+func (k *KrakenSource) get(ctx context.Context, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := k.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
 	}
-	krakenTicker := ticker
-	if val, ok := tickerMap[ticker]; ok {
-		krakenTicker = val
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s: %.200s", resp.Status, body)
 	}
+	return body, nil
+}
+
+// fetchAssetPairs downloads the full AssetPairs payload.
+func (k *KrakenSource) fetchAssetPairs(ctx context.Context) ([]byte, error) {
+	return k.get(ctx, k.BaseURL+"/0/public/AssetPairs")
+}
+
+// resolvePair returns the Kraken pair key to query for the given Kraken asset code.
+func (k *KrakenSource) resolvePair(ctx context.Context, ticker string) string {
 	// Try to auto-detect the correct Kraken asset pair via AssetPairs API
 	pairParam := ""
-	assetPairsURL := "https://api.kraken.com/0/public/AssetPairs"
-	apResp, apErr := http.Get(assetPairsURL)
-	if apErr == nil {
-		defer apResp.Body.Close()
-		apBody, _ := io.ReadAll(apResp.Body)
-		var assetResp struct {
-			Result map[string]struct {
-				Altname string `json:"altname"`
-			} `json:"result"`
-		}
-		if jsonErr := json.Unmarshal(apBody, &assetResp); jsonErr == nil {
-			// Prefer exact altname match, e.g. "XBTUSD"
-			targetAlt := strings.ToUpper(krakenTicker + "USD")
-			for k, v := range assetResp.Result {
-				if strings.ToUpper(v.Altname) == targetAlt {
-					pairParam = k
-					break
-				}
-			}
-			// Fallback: find any pair key that contains the ticker and USD
-			if pairParam == "" {
-				for k := range assetResp.Result {
-					ku := strings.ToUpper(k)
-					if strings.Contains(ku, strings.ToUpper(krakenTicker)) && strings.Contains(ku, "USD") {
-						pairParam = k
-						break
-					}
-				}
-			}
-		}
+	if k.Pairs != nil {
+		pairParam = k.Pairs.Resolve(ctx, ticker)
+	} else if body, err := k.fetchAssetPairs(ctx); err == nil {
+		pairParam = detectKrakenPair(ticker, body)
 	}
 
 	// Final fallback: use altname like XBTUSD which Kraken accepts
 	if pairParam == "" {
-		pairParam = fmt.Sprintf("%sUSD", krakenTicker)
+		pairParam = fmt.Sprintf("%sUSD", ticker)
 	}
+	return pairParam
+}
 
-	url := fmt.Sprintf("https://api.kraken.com/0/public/Ticker?pair=%s", pairParam)
-	resp, err := http.Get(url)
-	if err != nil {
-		return 0, url, err
-	}
-	defer resp.Body.Close()
+// Quote fetches the current ticker for symbol from Kraken.
+func (k *KrakenSource) Quote(ctx context.Context, symbol string) (*Quote, error) {
+	pairParam := k.resolvePair(ctx, krakenTicker(symbol))
 
-	body, err := io.ReadAll(resp.Body)
+	url := fmt.Sprintf("%s/0/public/Ticker?pair=%s", k.BaseURL, pairParam)
+	body, err := k.get(ctx, url)
 	if err != nil {
-		return 0, url, err
+		return nil, fmt.Errorf("%s: %w", url, err)
 	}
 
 	var tickerResp KrakenTickerResponse
-	err = json.Unmarshal(body, &tickerResp)
-	if err != nil {
-		return 0, url, err
+	if err := json.Unmarshal(body, &tickerResp); err != nil {
+		return nil, fmt.Errorf("%s: %w", url, err)
+	}
+	if len(tickerResp.Error) > 0 {
+		return nil, fmt.Errorf("%s: %s", url, strings.Join(tickerResp.Error, ", "))
 	}
 
 	for _, v := range tickerResp.Result {
-		if len(v.C) > 0 {
-			var price float64
-			fmt.Sscanf(v.C[0], "%f", &price)
-			return price, url, nil
+		if len(v.C) == 0 {
+			continue
+		}
+		price, err := strconv.ParseFloat(v.C[0], 64)
+		if err != nil || price <= 0 {
+			return nil, fmt.Errorf("%s: invalid last trade price %q", url, v.C[0])
+		}
+		quote := &Quote{
+			Symbol:    symbol,
+			Price:     price,
+			Timestamp: time.Now().UTC(), // Kraken's ticker carries no timestamp
+			Source:    url,
+		}
+		if len(v.B) > 0 {
+			quote.Bid, _ = strconv.ParseFloat(v.B[0], 64)
+		}
+		if len(v.A) > 0 {
+			quote.Ask, _ = strconv.ParseFloat(v.A[0], 64)
+		}
+		if len(v.V) > 1 {
+			quote.Volume, _ = strconv.ParseFloat(v.V[1], 64)
+		}
+		return quote, nil
+	}
+	return nil, fmt.Errorf("price not found in response from %s: %s", url, string(body))
+}
+
+// OHLC fetches candles for symbol at the given interval (in minutes) starting
+// after since. Kraken returns at most 720 bars per call; the returned cursor is
+// the "since" value to pass to get the next page.
+func (k *KrakenSource) OHLC(ctx context.Context, symbol string, interval int, since int64) ([]Candle, int64, error) {
+	pairParam := k.resolvePair(ctx, krakenTicker(symbol))
+
+	url := fmt.Sprintf("%s/0/public/OHLC?pair=%s&interval=%d&since=%d", k.BaseURL, pairParam, interval, since)
+	body, err := k.get(ctx, url)
+	if err != nil {
+		return nil, since, fmt.Errorf("%s: %w", url, err)
+	}
+
+	// Kraken returns data in nested arrays: [time, open, high, low, close, vwap, volume, count]
+	var data struct {
+		Error  []string                   `json:"error"`
+		Result map[string]json.RawMessage `json:"result"`
+	}
+	if err := json.Unmarshal(body, &data); err != nil {
+		return nil, since, fmt.Errorf("%s: %w", url, err)
+	}
+	if len(data.Error) > 0 {
+		return nil, since, fmt.Errorf("%s: %s", url, strings.Join(data.Error, ", "))
+	}
+
+	last := since
+	var candles []Candle
+	for key, raw := range data.Result {
+		if key == "last" {
+			json.Unmarshal(raw, &last)
+			continue
+		}
+		var bars [][]interface{}
+		if err := json.Unmarshal(raw, &bars); err != nil {
+			return nil, since, fmt.Errorf("%s: %w", url, err)
+		}
+		for _, b := range bars {
+			if len(b) < 8 {
+				continue
+			}
+			ts, _ := b[0].(float64)
+			c := Candle{
+				Symbol:   normalizeSymbol(symbol),
+				Interval: interval,
+				Time:     time.Unix(int64(ts), 0).UTC(),
+			}
+			for i, dst := range []*float64{&c.Open, &c.High, &c.Low, &c.Close, &c.VWAP, &c.Volume} {
+				s, _ := b[i+1].(string)
+				*dst, _ = strconv.ParseFloat(s, 64)
+			}
+			count, _ := b[7].(float64)
+			c.Count = int(count)
+			candles = append(candles, c)
 		}
 	}
-	return 0, url, fmt.Errorf("price not found in response: %s", string(body))
+	return candles, last, nil
 }
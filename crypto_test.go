@@ -1,6 +1,9 @@
 package main
 
 import (
+	"context"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 )
 
@@ -29,3 +32,92 @@ func TestDetectKrakenPair_NoMatch(t *testing.T) {
 		t.Fatalf("expected empty string when no match, got %s", got)
 	}
 }
+
+func TestKrakenSourceQuote(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/0/public/AssetPairs":
+			w.Write([]byte(`{"result": {"XXBTZUSD": {"altname": "XBTUSD"}}}`))
+		case "/0/public/Ticker":
+			if got := r.URL.Query().Get("pair"); got != "XXBTZUSD" {
+				t.Errorf("expected pair XXBTZUSD, got %s", got)
+			}
+			w.Write([]byte(`{"error": [], "result": {"XXBTZUSD": {"a": ["100.5", "1", "1.000"], "b": ["99.5", "1", "1.000"], "c": ["100.0", "0.1"], "v": ["10", "250.5"]}}}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	source := &KrakenSource{BaseURL: srv.URL, Client: srv.Client()}
+	quote, err := source.Quote(context.Background(), "BTC")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if quote.Price != 100.0 || quote.Bid != 99.5 || quote.Ask != 100.5 || quote.Volume != 250.5 {
+		t.Fatalf("unexpected quote: %+v", quote)
+	}
+}
+
+func TestKrakenSourceQuote_RejectsBadResponses(t *testing.T) {
+	cases := []struct {
+		name   string
+		status int
+		body   string
+	}{
+		{"http error", http.StatusServiceUnavailable, `<html>maintenance</html>`},
+		{"api error", http.StatusOK, `{"error": ["EQuery:Unknown asset pair"], "result": {}}`},
+		{"unparsable price", http.StatusOK, `{"error": [], "result": {"XXBTZUSD": {"c": ["n/a", "0.1"]}}}`},
+		{"zero price", http.StatusOK, `{"error": [], "result": {"XXBTZUSD": {"c": ["0.00000", "0.1"]}}}`},
+	}
+	for _, tc := range cases {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/0/public/AssetPairs" {
+				w.Write([]byte(`{"result": {"XXBTZUSD": {"altname": "XBTUSD"}}}`))
+				return
+			}
+			w.WriteHeader(tc.status)
+			w.Write([]byte(tc.body))
+		}))
+		source := &KrakenSource{BaseURL: srv.URL, Client: srv.Client()}
+		quote, err := source.Quote(context.Background(), "BTC")
+		srv.Close()
+		if err == nil {
+			t.Fatalf("%s: expected an error, got quote %+v", tc.name, quote)
+		}
+	}
+}
+
+func TestKrakenSourceOHLC(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/0/public/AssetPairs":
+			w.Write([]byte(`{"result": {"XXBTZUSD": {"altname": "XBTUSD"}}}`))
+		case "/0/public/OHLC":
+			w.Write([]byte(`{"error": [], "result": {"XXBTZUSD": [
+				[1700000000, "100.0", "110.0", "90.0", "105.0", "101.5", "12.5", 42],
+				[1700003600, "105.0", "106.0", "104.0", "104.5", "105.1", "3.0", 7]
+			], "last": 1700003600}}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	source := &KrakenSource{BaseURL: srv.URL, Client: srv.Client()}
+	candles, last, err := source.OHLC(context.Background(), "BTC", 60, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if last != 1700003600 {
+		t.Fatalf("expected cursor 1700003600, got %d", last)
+	}
+	if len(candles) != 2 {
+		t.Fatalf("expected 2 candles, got %d", len(candles))
+	}
+	c := candles[0]
+	if c.Symbol != "XBT" || c.Interval != 60 || c.Time.Unix() != 1700000000 ||
+		c.Open != 100 || c.High != 110 || c.Low != 90 || c.Close != 105 || c.VWAP != 101.5 || c.Volume != 12.5 || c.Count != 42 {
+		t.Fatalf("unexpected candle: %+v", c)
+	}
+}
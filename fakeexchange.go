@@ -0,0 +1,547 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"crypto-trader/store"
+)
+
+// FakeExchange is a local stand-in for Kraken's REST API. It serves the
+// public Ticker, AssetPairs and OHLC endpoints from scripted or recorded
+// price paths, and the private AddOrder, CancelOrder, QueryOrders,
+// OpenOrders, ClosedOrders and Balance endpoints against a simulated
+// account. Market orders fill at the current price; limit orders fill once
+// the path crosses their price.
+type FakeExchange struct {
+	Paths     map[string][]float64 // price path per asset code, e.g. XBT
+	Step      time.Duration        // advance paths by wall clock; 0 advances one price per Ticker request
+	Latency   time.Duration        // delay before every response
+	ErrorRate float64              // share of requests answered with EService:Unavailable
+	FeeRate   float64              // percent charged on fills
+	Key       string               // when set with Secret, private requests must be signed
+	Secret    string               // base64 API secret
+
+	mu        sync.Mutex
+	started   time.Time
+	ticks     map[string]int
+	balances  map[string]float64
+	orders    map[string]*fakeOrder
+	nextOrder int
+	lastNonce int64
+	rng       *rand.Rand
+}
+
+// fakeOrder is an order held by the FakeExchange.
+type fakeOrder struct {
+	asset     string
+	side      string
+	orderType string
+	volume    float64
+	limit     float64
+	userref   int32
+	status    string
+	reason    string
+	volExec   float64
+	cost      float64
+	fee       float64
+	openTime  time.Time
+	closeTime time.Time
+}
+
+// NewFakeExchange returns an exchange playing back paths with funds USD in
+// the account.
+func NewFakeExchange(paths map[string][]float64, funds float64) *FakeExchange {
+	return &FakeExchange{
+		Paths:    paths,
+		FeeRate:  0.26,
+		started:  time.Now(),
+		ticks:    make(map[string]int),
+		balances: map[string]float64{"ZUSD": funds},
+		orders:   make(map[string]*fakeOrder),
+		rng:      rand.New(rand.NewSource(1)),
+	}
+}
+
+// fakeAssetCodes are the assets Kraken names with an X prefix and whose
+// pairs quote ZUSD.
+var fakeAssetCodes = map[string]bool{"XBT": true, "ETH": true, "LTC": true, "XRP": true, "XLM": true, "ETC": true, "XMR": true, "ZEC": true}
+
+// fakePairKey returns Kraken's pair key for asset, e.g. XXBTZUSD.
+func fakePairKey(asset string) string {
+	if fakeAssetCodes[asset] {
+		return "X" + asset + "ZUSD"
+	}
+	return asset + "USD"
+}
+
+// fakeBalanceCode returns Kraken's balance code for asset, e.g. XXBT.
+func fakeBalanceCode(asset string) string {
+	if fakeAssetCodes[asset] {
+		return "X" + asset
+	}
+	return asset
+}
+
+// pairAsset returns the asset whose pair key or altname is pair.
+func (f *FakeExchange) pairAsset(pair string) (string, bool) {
+	for asset := range f.Paths {
+		if pair == fakePairKey(asset) || pair == asset+"USD" {
+			return asset, true
+		}
+	}
+	return "", false
+}
+
+// price returns asset's current price, the one last served by Ticker when
+// paths advance per request. Paths loop. Callers must hold f.mu.
+func (f *FakeExchange) price(asset string) float64 {
+	path := f.Paths[asset]
+	i := f.ticks[asset] - 1
+	if f.Step > 0 {
+		i = int(time.Since(f.started) / f.Step)
+	}
+	if i < 0 {
+		i = 0
+	}
+	return path[i%len(path)]
+}
+
+// advance moves asset one step along its path when paths advance per
+// request, then fills any limit orders the new price crosses. Callers must
+// hold f.mu.
+func (f *FakeExchange) advance(asset string) float64 {
+	if f.Step == 0 {
+		f.ticks[asset]++
+	}
+	price := f.price(asset)
+	for _, o := range f.orders {
+		if o.asset != asset || o.status != "open" {
+			continue
+		}
+		if (o.side == "buy" && price <= o.limit) || (o.side == "sell" && price >= o.limit) {
+			f.fill(o, o.limit)
+		}
+	}
+	return price
+}
+
+// fill executes o in full at price and settles the account. Callers must
+// hold f.mu.
+func (f *FakeExchange) fill(o *fakeOrder, price float64) {
+	o.volExec = o.volume
+	o.cost = o.volume * price
+	o.fee = o.cost * f.FeeRate / 100
+	o.status = "closed"
+	o.closeTime = time.Now()
+	code := fakeBalanceCode(o.asset)
+	if o.side == "buy" {
+		f.balances["ZUSD"] -= o.cost + o.fee
+		f.balances[code] += o.volume
+	} else {
+		f.balances["ZUSD"] += o.cost - o.fee
+		f.balances[code] -= o.volume
+	}
+}
+
+// ServeHTTP answers Kraken REST requests.
+func (f *FakeExchange) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if f.Latency > 0 {
+		time.Sleep(f.Latency)
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	if f.ErrorRate > 0 && f.rng.Float64() < f.ErrorRate {
+		writeKrakenJSON(w, nil, "EService:Unavailable")
+		return
+	}
+
+	var result interface{}
+	var errMsg string
+	switch r.URL.Path {
+	case "/0/public/AssetPairs":
+		result = f.assetPairs()
+	case "/0/public/Ticker":
+		result, errMsg = f.ticker(r.URL.Query().Get("pair"))
+	case "/0/public/OHLC":
+		result, errMsg = f.ohlc(r.URL.Query())
+	default:
+		if !strings.HasPrefix(r.URL.Path, "/0/private/") {
+			http.NotFound(w, r)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		form, _ := url.ParseQuery(string(body))
+		if errMsg = f.authenticate(r, string(body), form); errMsg == "" {
+			result, errMsg = f.private(strings.TrimPrefix(r.URL.Path, "/0/private/"), form)
+		}
+	}
+	writeKrakenJSON(w, result, errMsg)
+}
+
+// writeKrakenJSON writes Kraken's {"error": [...], "result": ...} envelope.
+func writeKrakenJSON(w http.ResponseWriter, result interface{}, errMsg string) {
+	errs := []string{}
+	if errMsg != "" {
+		errs = append(errs, errMsg)
+		result = nil
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"error": errs, "result": result})
+}
+
+func (f *FakeExchange) assetPairs() interface{} {
+	pairs := make(map[string]interface{})
+	for asset := range f.Paths {
+		pairs[fakePairKey(asset)] = map[string]string{"altname": asset + "USD", "base": fakeBalanceCode(asset), "quote": "ZUSD"}
+	}
+	return pairs
+}
+
+func (f *FakeExchange) ticker(pair string) (interface{}, string) {
+	asset, ok := f.pairAsset(pair)
+	if !ok {
+		return nil, "EQuery:Unknown asset pair"
+	}
+	price := f.advance(asset)
+	p := strconv.FormatFloat(price, 'f', -1, 64)
+	bid := strconv.FormatFloat(price*0.9999, 'f', 2, 64)
+	ask := strconv.FormatFloat(price*1.0001, 'f', 2, 64)
+	return map[string]interface{}{
+		fakePairKey(asset): map[string][]string{
+			"a": {ask, "1", "1.000"},
+			"b": {bid, "1", "1.000"},
+			"c": {p, "0.01"},
+			"v": {"100", "250"},
+		},
+	}, ""
+}
+
+// ohlc serves the path as one bar per price, the last bar ending now.
+func (f *FakeExchange) ohlc(q url.Values) (interface{}, string) {
+	asset, ok := f.pairAsset(q.Get("pair"))
+	if !ok {
+		return nil, "EQuery:Unknown asset pair"
+	}
+	interval, _ := strconv.Atoi(q.Get("interval"))
+	if interval <= 0 {
+		interval = 1
+	}
+	since, _ := strconv.ParseInt(q.Get("since"), 10, 64)
+	step := time.Duration(interval) * time.Minute
+	path := f.Paths[asset]
+	start := time.Now().Truncate(step).Add(-time.Duration(len(path)-1) * step)
+
+	bars := [][]interface{}{}
+	last := since
+	for i, price := range path {
+		ts := start.Add(time.Duration(i) * step).Unix()
+		if ts <= since {
+			continue
+		}
+		open := price
+		if i > 0 {
+			open = path[i-1]
+		}
+		high, low := open, open
+		if price > high {
+			high = price
+		}
+		if price < low {
+			low = price
+		}
+		s := func(v float64) string { return strconv.FormatFloat(v, 'f', -1, 64) }
+		bars = append(bars, []interface{}{ts, s(open), s(high), s(low), s(price), s((open + price) / 2), "1.0", 1})
+		last = ts
+	}
+	return map[string]interface{}{fakePairKey(asset): bars, "last": last}, ""
+}
+
+// authenticate checks a private request's signature and nonce when the
+// exchange has credentials, returning Kraken's error for a bad request.
+func (f *FakeExchange) authenticate(r *http.Request, body string, form url.Values) string {
+	nonce, err := strconv.ParseInt(form.Get("nonce"), 10, 64)
+	if err != nil || nonce <= f.lastNonce {
+		return "EAPI:Invalid nonce"
+	}
+	if f.Key != "" && f.Secret != "" {
+		secret, _ := base64.StdEncoding.DecodeString(f.Secret)
+		if r.Header.Get("API-Key") != f.Key || r.Header.Get("API-Sign") != krakenSignature(r.URL.Path, form.Get("nonce"), body, secret) {
+			return "EAPI:Invalid key"
+		}
+	}
+	f.lastNonce = nonce
+	return ""
+}
+
+func (f *FakeExchange) private(method string, form url.Values) (interface{}, string) {
+	switch method {
+	case "AddOrder":
+		return f.addOrder(form)
+	case "CancelOrder":
+		o, ok := f.orders[form.Get("txid")]
+		if !ok || o.status != "open" {
+			return nil, "EOrder:Unknown order"
+		}
+		o.status, o.reason, o.closeTime = "canceled", "User requested", time.Now()
+		return map[string]int{"count": 1}, ""
+	case "QueryOrders":
+		result := make(map[string]interface{})
+		for _, txid := range strings.Split(form.Get("txid"), ",") {
+			o, ok := f.orders[txid]
+			if !ok {
+				return nil, "EOrder:Invalid order"
+			}
+			result[txid] = o.state()
+		}
+		return result, ""
+	case "OpenOrders", "ClosedOrders":
+		open := method == "OpenOrders"
+		userref, _ := strconv.ParseInt(form.Get("userref"), 10, 32)
+		start, _ := strconv.ParseInt(form.Get("start"), 10, 64)
+		orders := make(map[string]interface{})
+		for txid, o := range f.orders {
+			if (o.status == "open") != open || (form.Has("userref") && int64(o.userref) != userref) {
+				continue
+			}
+			if !open && o.closeTime.Unix() < start {
+				continue
+			}
+			orders[txid] = o.state()
+		}
+		if open {
+			return map[string]interface{}{"open": orders}, ""
+		}
+		return map[string]interface{}{"closed": orders, "count": len(orders)}, ""
+	case "Balance":
+		result := make(map[string]string)
+		for code, amount := range f.balances {
+			result[code] = strconv.FormatFloat(amount, 'f', 8, 64)
+		}
+		return result, ""
+	}
+	return nil, "EGeneral:Unknown method"
+}
+
+func (f *FakeExchange) addOrder(form url.Values) (interface{}, string) {
+	asset, ok := f.pairAsset(form.Get("pair"))
+	if !ok {
+		return nil, "EQuery:Unknown asset pair"
+	}
+	side, orderType := form.Get("type"), form.Get("ordertype")
+	if side != "buy" && side != "sell" {
+		return nil, "EGeneral:Invalid arguments:type"
+	}
+	volume, err := strconv.ParseFloat(form.Get("volume"), 64)
+	if err != nil || volume <= 0 {
+		return nil, "EGeneral:Invalid arguments:volume"
+	}
+	userref, _ := strconv.ParseInt(form.Get("userref"), 10, 32)
+	o := &fakeOrder{asset: asset, side: side, orderType: orderType, volume: volume, userref: int32(userref), status: "open", openTime: time.Now()}
+	price := f.price(asset)
+	switch orderType {
+	case "market":
+	case "limit":
+		if o.limit, err = strconv.ParseFloat(form.Get("price"), 64); err != nil || o.limit <= 0 {
+			return nil, "EGeneral:Invalid arguments:price"
+		}
+		price = o.limit
+	default:
+		return nil, "EGeneral:Invalid arguments:ordertype"
+	}
+	if side == "buy" && volume*price*(1+f.FeeRate/100) > f.balances["ZUSD"] {
+		return nil, "EOrder:Insufficient funds"
+	}
+	if side == "sell" && volume > f.balances[fakeBalanceCode(asset)] {
+		return nil, "EOrder:Insufficient funds"
+	}
+
+	descr := map[string]string{"order": fmt.Sprintf("%s %.8f %sUSD @ %s", side, volume, asset, orderType)}
+	if form.Get("validate") == "true" {
+		return map[string]interface{}{"descr": descr}, ""
+	}
+	f.nextOrder++
+	txid := fmt.Sprintf("OFAKE%d-%05d", f.nextOrder, f.nextOrder)
+	f.orders[txid] = o
+	if orderType == "market" {
+		f.fill(o, f.price(asset))
+	}
+	return map[string]interface{}{"descr": descr, "txid": []string{txid}}, ""
+}
+
+// state renders o as QueryOrders reports it.
+func (o *fakeOrder) state() map[string]interface{} {
+	s := func(v float64) string { return strconv.FormatFloat(v, 'f', 8, 64) }
+	var avg float64
+	if o.volExec > 0 {
+		avg = o.cost / o.volExec
+	}
+	state := map[string]interface{}{
+		"status":  o.status,
+		"reason":  o.reason,
+		"userref": o.userref,
+		"descr": map[string]string{
+			"pair":      o.asset + "USD",
+			"type":      o.side,
+			"ordertype": o.orderType,
+			"price":     s(o.limit),
+		},
+		"vol":      s(o.volume),
+		"vol_exec": s(o.volExec),
+		"cost":     s(o.cost),
+		"fee":      s(o.fee),
+		"price":    s(avg),
+		"opentm":   float64(o.openTime.UnixNano()) / 1e9,
+	}
+	if !o.closeTime.IsZero() {
+		state["closetm"] = float64(o.closeTime.UnixNano()) / 1e9
+	}
+	return state
+}
+
+// parsePricePaths parses scripted paths written as
+// "BTC=65000,65100,64900;ETH=3000,3010".
+func parsePricePaths(s string) (map[string][]float64, error) {
+	paths := make(map[string][]float64)
+	for _, part := range strings.Split(s, ";") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		symbol, prices, ok := strings.Cut(part, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid price path %q, expected SYMBOL=price,price,...", part)
+		}
+		asset := normalizeSymbol(symbol)
+		for _, p := range strings.Split(prices, ",") {
+			price, err := strconv.ParseFloat(strings.TrimSpace(p), 64)
+			if err != nil || price <= 0 {
+				return nil, fmt.Errorf("invalid price %q in %s path", p, symbol)
+			}
+			paths[asset] = append(paths[asset], price)
+		}
+	}
+	return paths, nil
+}
+
+// loadPricePathCSV reads symbol,price rows (an optional header is skipped)
+// into paths, in file order.
+func loadPricePathCSV(r io.Reader) (map[string][]float64, error) {
+	rows, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	paths := make(map[string][]float64)
+	for i, row := range rows {
+		if len(row) < 2 {
+			return nil, fmt.Errorf("line %d: expected symbol,price", i+1)
+		}
+		price, err := strconv.ParseFloat(strings.TrimSpace(row[1]), 64)
+		if err != nil {
+			if i == 0 {
+				continue // header
+			}
+			return nil, fmt.Errorf("line %d: invalid price %q", i+1, row[1])
+		}
+		asset := normalizeSymbol(row[0])
+		paths[asset] = append(paths[asset], price)
+	}
+	return paths, nil
+}
+
+// recordedPricePaths loads the prices collected in st over the last days as
+// paths to play back.
+func recordedPricePaths(st store.Store, days int) (map[string][]float64, error) {
+	symbols, err := st.Symbols()
+	if err != nil {
+		return nil, err
+	}
+	since := time.Now().UTC().AddDate(0, 0, -days)
+	paths := make(map[string][]float64)
+	for _, symbol := range symbols {
+		prices, err := st.PricesSince(symbol, since)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range prices {
+			paths[symbol] = append(paths[symbol], p.Price)
+		}
+	}
+	return paths, nil
+}
+
+// fakeExchangeCommand serves a FakeExchange for the collector to point at
+// with KRAKEN_BASE_URL.
+func fakeExchangeCommand(args []string) {
+	fs := flag.NewFlagSet("fakeexchange", flag.ExitOnError)
+	addr := fs.String("addr", "127.0.0.1:8090", "Address to listen on")
+	prices := fs.String("prices", "", "Scripted price paths, e.g. BTC=65000,65100,64900;ETH=3000,3010")
+	csvFile := fs.String("csv", "", "CSV file of symbol,price rows to play back")
+	record := fs.String("record", "", "Play back prices recorded in this database (SQLite file or postgres:// URL)")
+	days := fs.Int("days", 1, "Days of recorded prices to play back with -record")
+	step := fs.Duration("step", 0, "Advance the paths by wall clock every step (default: one price per Ticker request)")
+	latency := fs.Duration("latency", 0, "Delay before every response")
+	errorRate := fs.Float64("error-rate", 0, "Share of requests that fail with EService:Unavailable, 0 to 1")
+	funds := fs.Float64("funds", 10000, "USD balance of the simulated account")
+	fee := fs.Float64("fee", 0.26, "Fee percent charged on fills")
+	fs.Parse(args)
+
+	var paths map[string][]float64
+	var err error
+	switch {
+	case *csvFile != "":
+		var f *os.File
+		if f, err = os.Open(*csvFile); err == nil {
+			paths, err = loadPricePathCSV(f)
+			f.Close()
+		}
+	case *record != "":
+		var db *sql.DB
+		if db, err = store.Open(*record); err == nil {
+			paths, err = recordedPricePaths(store.New(db), *days)
+			db.Close()
+		}
+	case *prices != "":
+		paths, err = parsePricePaths(*prices)
+	default:
+		paths, err = parsePricePaths("XBT=65000,65250,65100,64800,64950,65400")
+	}
+	if err == nil && len(paths) == 0 {
+		err = fmt.Errorf("no prices to play back")
+	}
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	ex := NewFakeExchange(paths, *funds)
+	ex.Step, ex.Latency, ex.ErrorRate, ex.FeeRate = *step, *latency, *errorRate, *fee
+	ex.Key, ex.Secret = os.Getenv("KRAKEN_API_KEY"), os.Getenv("KRAKEN_API_SECRET")
+
+	var assets []string
+	for asset, path := range paths {
+		assets = append(assets, fmt.Sprintf("%s (%d prices)", asset, len(path)))
+	}
+	sort.Strings(assets)
+	fmt.Printf("Fake exchange playing %s on http://%s\n", strings.Join(assets, ", "), *addr)
+	fmt.Printf("Point the collector at it with KRAKEN_BASE_URL=http://%s\n", *addr)
+	if err := http.ListenAndServe(*addr, ex); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+}
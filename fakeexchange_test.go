@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"crypto-trader/store"
+)
+
+// newTestFakeExchange serves ex and returns a public source and a private
+// client pointed at it.
+func newTestFakeExchange(t *testing.T, ex *FakeExchange) (*KrakenSource, *KrakenPrivateClient) {
+	t.Helper()
+	ex.Key, ex.Secret = "key", testKrakenSecret
+	srv := httptest.NewServer(ex)
+	t.Cleanup(srv.Close)
+
+	client, err := NewKrakenPrivateClient("key", testKrakenSecret)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	client.BaseURL, client.Client = srv.URL, srv.Client()
+	return &KrakenSource{BaseURL: srv.URL, Client: srv.Client()}, client
+}
+
+func TestFakeExchange_PlaysBackPricePath(t *testing.T) {
+	paths, err := parsePricePaths("BTC=100,101,102")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	source, _ := newTestFakeExchange(t, NewFakeExchange(paths, 0))
+	ctx := context.Background()
+
+	for _, want := range []float64{100, 101, 102, 100} {
+		quote, err := source.Quote(ctx, "BTC")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if quote.Price != want {
+			t.Fatalf("expected %v, got %v", want, quote.Price)
+		}
+	}
+
+	candles, last, err := source.OHLC(ctx, "BTC", 60, 0)
+	if err != nil || len(candles) != 3 {
+		t.Fatalf("expected 3 hourly candles, got %d, %v", len(candles), err)
+	}
+	if c := candles[2]; c.Open != 101 || c.Close != 102 || c.High != 102 || c.Low != 101 {
+		t.Fatalf("unexpected last candle %+v", c)
+	}
+	if more, _, _ := source.OHLC(ctx, "BTC", 60, last); len(more) != 0 {
+		t.Fatalf("expected no candles after the cursor, got %d", len(more))
+	}
+}
+
+func TestFakeExchange_OrdersEndToEnd(t *testing.T) {
+	ex := NewFakeExchange(map[string][]float64{"XBT": {100, 95, 110}}, 1000)
+	ex.FeeRate = 0
+	source, client := newTestFakeExchange(t, ex)
+	db := openMigratedTestDB(t)
+	m := newOrderManager(store.New(db), client)
+	ctx := context.Background()
+
+	source.Quote(ctx, "XBT") // 100
+	buy, err := m.Submit(ctx, 1, "XBT", OrderRequest{Pair: "XBTUSD", Side: "buy", Volume: 5})
+	if err != nil || buy.Status != OrderSubmitted {
+		t.Fatalf("expected a submitted buy, got %+v, %v", buy, err)
+	}
+	tooBig, _ := m.Submit(ctx, 2, "XBT", OrderRequest{Pair: "XBTUSD", Side: "buy", Volume: 50})
+	if tooBig.Status != OrderRejected || !strings.Contains(tooBig.Error, "Insufficient funds") {
+		t.Fatalf("expected the oversized buy to be rejected, got %+v", tooBig)
+	}
+	sell, err := m.Submit(ctx, 3, "XBT", OrderRequest{Pair: "XBTUSD", Side: "sell", OrderType: "limit", Volume: 5, Price: 105})
+	if err != nil || sell.Status != OrderSubmitted {
+		t.Fatalf("expected a submitted limit sell, got %+v, %v", sell, err)
+	}
+
+	if err := m.Poll(ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	open, _ := openOrders(store.New(db))
+	if len(open) != 1 || open[0].ID != sell.ID {
+		t.Fatalf("expected only the limit sell open after the market buy filled, got %+v", open)
+	}
+
+	source.Quote(ctx, "XBT") // 95, below the limit
+	source.Quote(ctx, "XBT") // 110 crosses it
+	if err := m.Poll(ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	orders, _ := store.New(db).RecentOrders("XBT", 10)
+	if orders[0].Status != OrderFilled || orders[0].AvgPrice != 105 {
+		t.Fatalf("expected the limit sell filled at 105, got %+v", orders[0])
+	}
+
+	balances, err := client.Balance(ctx)
+	if err != nil || balances["ZUSD"] != 1025 || balances["XXBT"] != 0 {
+		t.Fatalf("expected $1025 and no XBT, got %v, %v", balances, err)
+	}
+}
+
+func TestFakeExchange_InjectsErrors(t *testing.T) {
+	ex := NewFakeExchange(map[string][]float64{"XBT": {100}}, 0)
+	ex.ErrorRate = 1
+	source, client := newTestFakeExchange(t, ex)
+
+	if _, err := source.Quote(context.Background(), "XBT"); err == nil {
+		t.Fatalf("expected an injected error")
+	}
+	if _, err := client.Balance(context.Background()); err == nil || !strings.Contains(err.Error(), "EService:Unavailable") {
+		t.Fatalf("expected EService:Unavailable, got %v", err)
+	}
+}
+
+func TestLoadPricePathCSV(t *testing.T) {
+	paths, err := loadPricePathCSV(strings.NewReader("symbol,price\nBTC,100\nETH,10\nBTC,101\n"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(paths["XBT"]) != 2 || paths["XBT"][1] != 101 || len(paths["ETH"]) != 1 {
+		t.Fatalf("unexpected paths %v", paths)
+	}
+	if _, err := loadPricePathCSV(strings.NewReader("BTC,100\nBTC,abc\n")); err == nil {
+		t.Fatalf("expected error for an invalid price")
+	}
+}
+
+func TestRecordedPricePaths(t *testing.T) {
+	st := store.NewMemory()
+	now := time.Now().UTC()
+	for _, p := range []struct {
+		symbol string
+		price  float64
+		age    time.Duration
+	}{
+		{"XBT", 90, 48 * time.Hour}, {"XBT", 100, 2 * time.Hour}, {"ETH", 10, time.Hour}, {"XBT", 101, time.Hour},
+	} {
+		if _, err := st.InsertPrice(p.symbol, p.price, now.Add(-p.age)); err != nil {
+			t.Fatalf("setup failed: %v", err)
+		}
+	}
+
+	paths, err := recordedPricePaths(st, 1)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(paths["XBT"]) != 2 || paths["XBT"][0] != 100 || paths["XBT"][1] != 101 || len(paths["ETH"]) != 1 {
+		t.Fatalf("unexpected paths %v", paths)
+	}
+}
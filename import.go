@@ -0,0 +1,530 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"crypto-trader/store"
+)
+
+// importFormats are the file formats the import subcommand reads.
+var importFormats = map[string]bool{"csv": true, "kraken-ohlcvt": true, "kraken-trades": true, "cryptosim": true}
+
+// importProgressRows is how often progress is printed while importing.
+const importProgressRows = 100000
+
+var (
+	// crypto_sym_gala.log from crypto_sim.py, gala_trade_log.csv from
+	// crypto_sim_actual_buys.py
+	cryptoSimLogName = regexp.MustCompile(`^(?:crypto_sym_([a-z0-9]+)\.log|([a-z0-9]+)_trade_log\.csv)$`)
+	// XBTUSD_60.csv (OHLCVT, 60 minute candles) or XBTUSD.csv (trades)
+	krakenFileName = regexp.MustCompile(`^([A-Z0-9]+?)(?:_([0-9]+))?\.csv$`)
+)
+
+// importSpec says how the rows of one file are read.
+type importSpec struct {
+	Format     string
+	Symbol     string
+	Interval   int // candle minutes, kraken-ohlcvt only
+	Header     bool
+	Columns    map[string]string // time and price column names or 0-based indexes, csv only
+	TimeFormat string            // auto, unix, unixms or a Go time layout
+	Location   *time.Location    // for times without a zone
+}
+
+// importStats counts what happened to the rows of a file.
+type importStats struct {
+	Rows       int
+	New        int
+	Duplicates int
+	Invalid    int
+	Candles    int // candles added, imported or rolled up
+}
+
+// detectImportSpec fills in the format, symbol and interval a file name
+// implies, leaving anything already set alone.
+func detectImportSpec(spec importSpec, file string) (importSpec, error) {
+	base := filepath.Base(file)
+	format, symbol, interval := "", "", 0
+	if m := cryptoSimLogName.FindStringSubmatch(base); m != nil {
+		format, symbol = "cryptosim", m[1]+m[2]
+	} else if m := krakenFileName.FindStringSubmatch(base); m != nil {
+		format, symbol = "kraken-trades", krakenPairBase(m[1])
+		if m[2] != "" {
+			format = "kraken-ohlcvt"
+			interval, _ = strconv.Atoi(m[2])
+		}
+	}
+
+	if spec.Format == "" || spec.Format == "auto" {
+		if format == "" {
+			return spec, fmt.Errorf("cannot tell the format of %s; pass -format", base)
+		}
+		spec.Format = format
+	}
+	if !importFormats[spec.Format] {
+		return spec, fmt.Errorf("unknown format %q, expected csv, kraken-ohlcvt, kraken-trades or cryptosim", spec.Format)
+	}
+	if spec.Symbol == "" && spec.Format == format {
+		spec.Symbol = symbol
+	}
+	if spec.Symbol == "" {
+		spec.Symbol = configuredTickers()[0]
+	}
+	spec.Symbol = normalizeSymbol(spec.Symbol)
+	if spec.Interval == 0 && spec.Format == format {
+		spec.Interval = interval
+	}
+	if spec.Format == "kraken-ohlcvt" && spec.Interval <= 0 {
+		return spec, fmt.Errorf("cannot tell the candle interval of %s; pass -interval", base)
+	}
+
+	// The fixed layouts of the known formats
+	switch spec.Format {
+	case "kraken-ohlcvt", "kraken-trades":
+		spec.Header, spec.TimeFormat = false, "unix"
+		spec.Columns = map[string]string{"time": "0", "price": "1"}
+	case "cryptosim":
+		spec.Header, spec.TimeFormat = true, "2006-01-02 15:04:05"
+		spec.Columns = map[string]string{"time": "Timestamp", "price": "Price"}
+	}
+	return spec, nil
+}
+
+// krakenPairBase returns the base asset of a Kraken pair name, e.g. XBT for
+// XBTUSD.
+func krakenPairBase(pair string) string {
+	for _, quote := range []string{"USDT", "USDC", "ZUSD", "ZEUR", "USD", "EUR", "GBP", "CAD", "JPY", "CHF", "AUD"} {
+		if len(pair) > len(quote) && strings.HasSuffix(pair, quote) {
+			return strings.TrimSuffix(pair, quote)
+		}
+	}
+	return pair
+}
+
+// parseImportColumns parses a time=...,price=... column mapping.
+func parseImportColumns(s string) (map[string]string, error) {
+	columns := map[string]string{"time": "0", "price": "1"}
+	if strings.TrimSpace(s) == "" {
+		return columns, nil
+	}
+	for _, part := range strings.Split(s, ",") {
+		key, val, ok := strings.Cut(part, "=")
+		key, val = strings.TrimSpace(key), strings.TrimSpace(val)
+		if !ok || val == "" || (key != "time" && key != "price") {
+			return nil, fmt.Errorf("invalid column mapping %q, expected time=COLUMN,price=COLUMN", part)
+		}
+		columns[key] = val
+	}
+	return columns, nil
+}
+
+// columnIndex resolves a column name or 0-based index against header.
+func columnIndex(col string, header []string) (int, error) {
+	if i, err := strconv.Atoi(col); err == nil && i >= 0 {
+		return i, nil
+	}
+	for i, name := range header {
+		if strings.EqualFold(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")), col) {
+			return i, nil
+		}
+	}
+	if header == nil {
+		return 0, fmt.Errorf("column %q needs a header row", col)
+	}
+	return 0, fmt.Errorf("no column %q in header %v", col, header)
+}
+
+// parseImportTime parses s as format: unix seconds (fractions allowed),
+// unix milliseconds, a Go layout, or auto to try each in turn. Times
+// without a zone are read in loc.
+func parseImportTime(s, format string, loc *time.Location) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	switch format {
+	case "unix", "unixms":
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid unix time %q", s)
+		}
+		if format == "unixms" {
+			return time.UnixMilli(int64(f)).UTC(), nil
+		}
+		return time.Unix(0, int64(f*1e9)).UTC().Round(time.Microsecond), nil
+	case "", "auto":
+		if f, err := strconv.ParseFloat(s, 64); err == nil {
+			if f > 1e12 {
+				return parseImportTime(s, "unixms", loc)
+			}
+			return parseImportTime(s, "unix", loc)
+		}
+		for _, layout := range []string{time.RFC3339Nano, "2006-01-02 15:04:05", "2006-01-02T15:04:05", "2006-01-02 15:04", "2006-01-02"} {
+			if t, err := time.ParseInLocation(layout, s, loc); err == nil {
+				return t.UTC(), nil
+			}
+		}
+		return time.Time{}, fmt.Errorf("unrecognised time %q", s)
+	default:
+		t, err := time.ParseInLocation(format, s, loc)
+		return t.UTC(), err
+	}
+}
+
+// importer writes the rows of one file inside tx.
+type importer struct {
+	tx     *sql.Tx
+	symbol string
+	days   map[time.Time]bool // UTC days that received rows
+	maxID  int64              // last btc_price row inserted
+	stats  importStats
+}
+
+// addPrice stores a tick unless symbol already has one at ts.
+func (im *importer) addPrice(ts time.Time, price float64) error {
+	var n int
+	if err := im.tx.QueryRow(`SELECT COUNT(*) FROM btc_price WHERE symbol = ? AND timestamp = ?`, im.symbol, ts).Scan(&n); err != nil {
+		return err
+	}
+	if n > 0 {
+		im.stats.Duplicates++
+		return nil
+	}
+	if err := im.tx.QueryRow(`INSERT INTO btc_price (symbol, price, timestamp) VALUES (?, ?, ?) RETURNING id`,
+		im.symbol, price, ts).Scan(&im.maxID); err != nil {
+		return err
+	}
+	im.stats.New++
+	im.days[ts.Truncate(24*time.Hour)] = true
+	return nil
+}
+
+// addCandle stores a candle unless symbol already has one for its interval
+// and time.
+func (im *importer) addCandle(c Candle) error {
+	added, err := insertCandleIfMissing(im.tx, c, store.CandleSourceKraken)
+	if err != nil {
+		return err
+	}
+	if !added {
+		im.stats.Duplicates++
+		return nil
+	}
+	im.stats.New++
+	im.stats.Candles++
+	im.days[c.Time.Truncate(24*time.Hour)] = true
+	return nil
+}
+
+// insertCandleIfMissing stores c from source unless a candle with the same
+// symbol, interval and time exists, and reports whether it did.
+func insertCandleIfMissing(tx *sql.Tx, c Candle, source string) (bool, error) {
+	res, err := tx.Exec(`INSERT INTO candles (symbol, interval, time, open, high, low, close, vwap, volume, count, source)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?) ON CONFLICT(symbol, interval, time) DO NOTHING`,
+		c.Symbol, c.Interval, c.Time.UTC(), c.Open, c.High, c.Low, c.Close, c.VWAP, c.Volume, c.Count, source)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// finish rolls the days that received rows up into the coarser tick
+// intervals, from ticks (interval 0) or from interval candles. Existing
+// candles are kept. Imported ticks are marked as rolled up.
+func (im *importer) finish(interval int) error {
+	for day := range im.days {
+		n, err := rollUpDay(im.tx, im.symbol, interval, day)
+		if err != nil {
+			return err
+		}
+		im.stats.Candles += n
+	}
+	if im.maxID == 0 {
+		return nil
+	}
+	return advanceCandleRollup(im.tx, im.symbol, im.maxID)
+}
+
+// advanceCandleRollup records priceID as the last btc_price row of symbol
+// rolled up into candles, unless a later one already is.
+func advanceCandleRollup(tx *sql.Tx, symbol string, priceID int64) error {
+	_, err := tx.Exec(`INSERT INTO candle_rollup (symbol, price_id) VALUES (?, ?)
+		ON CONFLICT(symbol) DO UPDATE SET price_id = CASE WHEN excluded.price_id > candle_rollup.price_id THEN excluded.price_id ELSE candle_rollup.price_id END`,
+		symbol, priceID)
+	return err
+}
+
+// rollUpDay builds symbol's candles for every tick interval coarser than
+// interval (0 for raw ticks) on day from the stored rows, adding those that
+// do not exist yet. It returns how many were added.
+func rollUpDay(tx *sql.Tx, symbol string, interval int, day time.Time) (int, error) {
+	var rows *sql.Rows
+	var err error
+	if interval == 0 {
+		rows, err = tx.Query(`SELECT price, timestamp FROM btc_price WHERE symbol = ? AND timestamp >= ? AND timestamp < ? ORDER BY timestamp, id`,
+			symbol, day, day.Add(24*time.Hour))
+	} else {
+		rows, err = tx.Query(`SELECT open, high, low, close, vwap, volume, count, time FROM candles
+			WHERE symbol = ? AND interval = ? AND time >= ? AND time < ? ORDER BY time`, symbol, interval, day, day.Add(24*time.Hour))
+	}
+	if err != nil {
+		return 0, err
+	}
+	var bars []Candle
+	for rows.Next() {
+		c := Candle{Symbol: symbol, Interval: interval, Count: 1}
+		if interval == 0 {
+			err = rows.Scan(&c.Close, &c.Time)
+			c.Open, c.High, c.Low = c.Close, c.Close, c.Close
+		} else {
+			err = rows.Scan(&c.Open, &c.High, &c.Low, &c.Close, &c.VWAP, &c.Volume, &c.Count, &c.Time)
+		}
+		if err != nil {
+			rows.Close()
+			return 0, err
+		}
+		bars = append(bars, c)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	// Bars rolled up from Kraken's candles keep their volume and trade counts
+	source := store.CandleSourceTicks
+	if interval > 0 {
+		source = store.CandleSourceKraken
+	}
+	added := 0
+	for _, target := range tickIntervals {
+		if target <= interval || (interval > 0 && target%interval != 0) {
+			continue
+		}
+		for _, c := range rollUpCandles(bars, target) {
+			ok, err := insertCandleIfMissing(tx, c, source)
+			if err != nil {
+				return added, err
+			}
+			if ok {
+				added++
+			}
+		}
+	}
+	return added, nil
+}
+
+// rollUpCandles merges time-ordered bars into candles of interval minutes.
+func rollUpCandles(bars []Candle, interval int) []Candle {
+	step := time.Duration(interval) * time.Minute
+	var out []Candle
+	for _, b := range bars {
+		bucket := b.Time.UTC().Truncate(step)
+		if n := len(out); n > 0 && out[n-1].Time.Equal(bucket) {
+			c := &out[n-1]
+			if b.High > c.High {
+				c.High = b.High
+			}
+			if b.Low < c.Low {
+				c.Low = b.Low
+			}
+			c.Close = b.Close
+			if volume := c.Volume + b.Volume; volume > 0 {
+				c.VWAP = (c.VWAP*c.Volume + b.VWAP*b.Volume) / volume
+			}
+			c.Volume += b.Volume
+			c.Count += b.Count
+			continue
+		}
+		b.Interval, b.Time = interval, bucket
+		out = append(out, b)
+	}
+	return out
+}
+
+// importFile reads one file into the database in a single transaction,
+// rolled back when dryRun is set.
+func importFile(db *sql.DB, file string, spec importSpec, dryRun bool) (importStats, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return importStats{}, err
+	}
+	defer f.Close()
+
+	// Ticks from before this import must be rolled up before the rollup
+	// position moves past them
+	if !dryRun && spec.Format != "kraken-ohlcvt" {
+		if _, err := catchUpCandles(store.New(db), spec.Symbol); err != nil {
+			return importStats{}, err
+		}
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return importStats{}, err
+	}
+	defer tx.Rollback()
+	im := &importer{tx: tx, symbol: spec.Symbol, days: make(map[time.Time]bool)}
+
+	r := csv.NewReader(f)
+	r.FieldsPerRecord = -1
+	r.TrimLeadingSpace = true
+	var header []string
+	if spec.Header {
+		if header, err = r.Read(); err != nil {
+			return im.stats, fmt.Errorf("failed to read header: %w", err)
+		}
+	}
+	timeCol, err := columnIndex(spec.Columns["time"], header)
+	if err != nil {
+		return im.stats, err
+	}
+	priceCol, err := columnIndex(spec.Columns["price"], header)
+	if err != nil {
+		return im.stats, err
+	}
+
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return im.stats, err
+		}
+		line, _ := r.FieldPos(0)
+		im.stats.Rows++
+		if rowErr := im.addRecord(record, spec, timeCol, priceCol); rowErr != nil {
+			if _, ok := rowErr.(invalidRowError); !ok {
+				return im.stats, fmt.Errorf("line %d: %w", line, rowErr)
+			}
+			if im.stats.Invalid < 5 {
+				fmt.Printf("  %s line %d: %v, skipped\n", filepath.Base(file), line, rowErr)
+			}
+			im.stats.Invalid++
+		}
+		if im.stats.Rows%importProgressRows == 0 {
+			fmt.Printf("  %s: %d rows read, %d new, %d duplicates\n", filepath.Base(file), im.stats.Rows, im.stats.New, im.stats.Duplicates)
+		}
+	}
+
+	if err := im.finish(spec.Interval); err != nil {
+		return im.stats, fmt.Errorf("failed to roll up candles: %w", err)
+	}
+	if dryRun {
+		return im.stats, nil
+	}
+	return im.stats, tx.Commit()
+}
+
+// invalidRowError is a row that cannot be parsed and is skipped.
+type invalidRowError struct{ error }
+
+// addRecord parses one CSV record as spec's format and stores it.
+func (im *importer) addRecord(record []string, spec importSpec, timeCol, priceCol int) error {
+	field := func(i int) (float64, error) {
+		if i >= len(record) {
+			return 0, invalidRowError{fmt.Errorf("missing column %d", i)}
+		}
+		f, err := strconv.ParseFloat(strings.TrimSpace(record[i]), 64)
+		if err != nil {
+			return 0, invalidRowError{fmt.Errorf("invalid number %q", record[i])}
+		}
+		return f, nil
+	}
+	if timeCol >= len(record) {
+		return invalidRowError{fmt.Errorf("missing column %d", timeCol)}
+	}
+	ts, err := parseImportTime(record[timeCol], spec.TimeFormat, spec.Location)
+	if err != nil {
+		return invalidRowError{err}
+	}
+
+	if spec.Format == "kraken-ohlcvt" {
+		// timestamp, open, high, low, close, volume, trades
+		var v [6]float64
+		for i := range v {
+			if v[i], err = field(i + 1); err != nil {
+				return err
+			}
+		}
+		return im.addCandle(Candle{Symbol: im.symbol, Interval: spec.Interval, Time: ts,
+			Open: v[0], High: v[1], Low: v[2], Close: v[3], Volume: v[4], Count: int(v[5])})
+	}
+
+	price, err := field(priceCol)
+	if err != nil {
+		return err
+	}
+	if price <= 0 {
+		return invalidRowError{fmt.Errorf("invalid price %v", price)}
+	}
+	return im.addPrice(ts, price)
+}
+
+// importCommand loads historical prices from files, e.g.
+// import crypto_sym_gala.log XBTUSD_60.csv
+// import -format csv -columns time=date,price=close -symbol ETH prices.csv
+func importCommand(args []string) {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	format := fs.String("format", "auto", "File format: auto (from the file name), csv, kraken-ohlcvt, kraken-trades or cryptosim")
+	symbol := fs.String("symbol", "", "Symbol the prices are for (default: from the file name, else the first ticker)")
+	interval := fs.Int("interval", 0, "Candle interval in minutes for kraken-ohlcvt (default: from the file name)")
+	columns := fs.String("columns", "", "csv columns as time=COLUMN,price=COLUMN, by header name or 0-based index (default time=0,price=1)")
+	header := fs.Bool("header", true, "csv files start with a header row")
+	timeFormat := fs.String("time-format", "auto", "csv time format: auto, unix, unixms or a Go layout such as 2006-01-02 15:04")
+	tz := fs.String("tz", "Local", "Time zone of times without one (cryptosim logs are in local time)")
+	dryRun := fs.Bool("dry-run", false, "Read and de-duplicate the files without writing anything")
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fmt.Println("usage: import [flags] FILE...")
+		fs.PrintDefaults()
+		os.Exit(1)
+	}
+
+	loc, err := time.LoadLocation(*tz)
+	if err != nil {
+		fmt.Println("Invalid -tz:", err)
+		os.Exit(1)
+	}
+	cols, err := parseImportColumns(*columns)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	db, err := openDatabase()
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	defer db.Close()
+
+	for _, file := range fs.Args() {
+		spec, err := detectImportSpec(importSpec{Format: *format, Symbol: *symbol, Interval: *interval, Header: *header,
+			Columns: cols, TimeFormat: *timeFormat, Location: loc}, file)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		fmt.Printf("Importing %s as %s %s\n", file, spec.Symbol, spec.Format)
+		stats, err := importFile(db, file, spec, *dryRun)
+		if err != nil {
+			fmt.Printf("Error importing %s: %v\n", file, err)
+			os.Exit(1)
+		}
+		verb := "Imported"
+		if *dryRun {
+			verb = "Dry run, would import"
+		}
+		fmt.Printf("%s %s: %d rows, %d new, %d duplicates, %d invalid, %d candles\n",
+			verb, file, stats.Rows, stats.New, stats.Duplicates, stats.Invalid, stats.Candles)
+	}
+}
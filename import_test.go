@@ -0,0 +1,122 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"crypto-trader/store"
+)
+
+// writeImportFile writes content to name in a temporary directory.
+func writeImportFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+	return path
+}
+
+func TestDetectImportSpec_FromFileName(t *testing.T) {
+	for file, want := range map[string]importSpec{
+		"logs/crypto_sym_gala.log": {Format: "cryptosim", Symbol: "GALA"},
+		"btc_trade_log.csv":        {Format: "cryptosim", Symbol: "XBT"},
+		"XBTUSD_60.csv":            {Format: "kraken-ohlcvt", Symbol: "XBT", Interval: 60},
+		"ETHEUR.csv":               {Format: "kraken-trades", Symbol: "ETH"},
+	} {
+		spec, err := detectImportSpec(importSpec{Format: "auto"}, file)
+		if err != nil || spec.Format != want.Format || spec.Symbol != want.Symbol || spec.Interval != want.Interval {
+			t.Fatalf("%s: expected %+v, got %+v, %v", file, want, spec, err)
+		}
+	}
+	if _, err := detectImportSpec(importSpec{Format: "auto"}, "prices.csv"); err == nil {
+		t.Fatalf("expected an error for an unknown file name")
+	}
+	if spec, _ := detectImportSpec(importSpec{Format: "csv", Symbol: "eth"}, "XBTUSD_60.csv"); spec.Symbol != "ETH" || spec.Interval != 0 {
+		t.Fatalf("expected the flags to win over the file name, got %+v", spec)
+	}
+}
+
+func TestParseImportTime(t *testing.T) {
+	want := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	for _, c := range []struct{ s, format string }{
+		{"1704164645", "auto"},
+		{"1704164645000", "auto"},
+		{"1704164645.000", "unix"},
+		{"2024-01-02T03:04:05Z", "auto"},
+		{"2024-01-02 03:04:05", "auto"},
+		{"02/01/2024 03:04:05", "02/01/2006 15:04:05"},
+	} {
+		if got, err := parseImportTime(c.s, c.format, time.UTC); err != nil || !got.Equal(want) {
+			t.Fatalf("%q as %s: expected %v, got %v, %v", c.s, c.format, want, got, err)
+		}
+	}
+	if _, err := parseImportTime("yesterday", "auto", time.UTC); err == nil {
+		t.Fatalf("expected an error for an unrecognised time")
+	}
+}
+
+func TestImportFile_CryptoSimLogDeduplicates(t *testing.T) {
+	db := openMigratedTestDB(t)
+	file := writeImportFile(t, "crypto_sym_gala.log", `Timestamp,Action,Price,Quantity,Cash,Holdings,Portfolio_Value
+2024-01-02 03:04:05,BUY,0.02000,4995.00000000,0.00,4995.00000000,99.90
+2024-01-02 03:30:00,SELL_25%,0.02100,1248.75000000,26.20,3746.25000000,104.87
+2024-01-02 03:30:00,SELL_25%,0.02100,936.56250000,45.85,2809.68750000,104.85
+not a time,BUY,0.02,1,0,1,1
+`)
+	spec, _ := detectImportSpec(importSpec{Format: "auto", Location: time.UTC}, file)
+
+	stats, err := importFile(db, file, spec, true)
+	if err != nil || stats.Rows != 4 || stats.New != 2 || stats.Duplicates != 1 || stats.Invalid != 1 {
+		t.Fatalf("expected 2 new, 1 duplicate and 1 invalid row, got %+v, %v", stats, err)
+	}
+	st := store.New(db)
+	if prices, _ := st.PricesSince("GALA", time.Time{}); len(prices) != 0 {
+		t.Fatalf("expected a dry run to write nothing, got %+v", prices)
+	}
+
+	if stats, err = importFile(db, file, spec, false); err != nil || stats.New != 2 {
+		t.Fatalf("expected 2 new rows, got %+v, %v", stats, err)
+	}
+	if stats, _ = importFile(db, file, spec, false); stats.New != 0 || stats.Duplicates != 3 {
+		t.Fatalf("expected every row a duplicate on a re-run, got %+v", stats)
+	}
+	prices, _ := st.PricesSince("GALA", time.Time{})
+	if len(prices) != 2 || prices[0].Price != 0.02 || !prices[1].Timestamp.Equal(time.Date(2024, 1, 2, 3, 30, 0, 0, time.UTC)) {
+		t.Fatalf("unexpected prices %+v", prices)
+	}
+	hours, _ := st.CandlesSince("GALA", 60, time.Time{})
+	if len(hours) != 1 || hours[0].Open != 0.02 || hours[0].Close != 0.021 || hours[0].Count != 2 {
+		t.Fatalf("expected one hourly candle from both ticks, got %+v", hours)
+	}
+	if n, _ := catchUpCandles(store.New(db), "GALA"); n != 0 {
+		t.Fatalf("expected the imported ticks marked as rolled up, got %d to catch up", n)
+	}
+}
+
+func TestImportFile_KrakenOHLCVTRollsUp(t *testing.T) {
+	db := openMigratedTestDB(t)
+	file := writeImportFile(t, "XBTUSD_60.csv", `1704067200,42000,42500,41800,42200,10,100
+1704070800,42200,43000,42100,42900,30,300
+1704153600,43000,43100,42900,43050,5,50
+`)
+	spec, _ := detectImportSpec(importSpec{Format: "auto"}, file)
+	stats, err := importFile(db, file, spec, false)
+	if err != nil || stats.New != 3 || stats.Candles != 5 {
+		t.Fatalf("expected 3 hourly and 2 daily candles, got %+v, %v", stats, err)
+	}
+
+	st := store.New(db)
+	days, _ := st.CandlesSince("XBT", 1440, time.Time{})
+	if len(days) != 2 {
+		t.Fatalf("expected 2 daily candles, got %+v", days)
+	}
+	if d := days[0]; d.Open != 42000 || d.High != 43000 || d.Low != 41800 || d.Close != 42900 || d.Volume != 40 || d.Count != 400 {
+		t.Fatalf("unexpected daily candle %+v", d)
+	}
+	if prices, _ := st.PricesSince("XBT", time.Time{}); len(prices) != 0 {
+		t.Fatalf("expected candles only, got %+v", prices)
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+
+	"crypto-trader/indicators"
+)
+
+// indicatorSpec describes an indicator the API can compute over candles.
+type indicatorSpec struct {
+	defaults map[string]float64
+	overlay  bool // plotted on the price axis rather than its own scale
+	compute  func(candles []Candle, p map[string]float64) map[string][]float64
+}
+
+// indicatorSpecs lists the indicators served by /api/indicators, keyed by name.
+var indicatorSpecs = map[string]indicatorSpec{
+	"sma": {
+		defaults: map[string]float64{"period": 20},
+		overlay:  true,
+		compute: func(candles []Candle, p map[string]float64) map[string][]float64 {
+			return map[string][]float64{"sma": indicators.SMASeries(candleCloses(candles), int(p["period"]))}
+		},
+	},
+	"ema": {
+		defaults: map[string]float64{"period": 20},
+		overlay:  true,
+		compute: func(candles []Candle, p map[string]float64) map[string][]float64 {
+			return map[string][]float64{"ema": indicators.EMASeries(candleCloses(candles), int(p["period"]))}
+		},
+	},
+	"wma": {
+		defaults: map[string]float64{"period": 20},
+		overlay:  true,
+		compute: func(candles []Candle, p map[string]float64) map[string][]float64 {
+			return map[string][]float64{"wma": indicators.WMASeries(candleCloses(candles), int(p["period"]))}
+		},
+	},
+	"bollinger": {
+		defaults: map[string]float64{"period": 20, "k": 2},
+		overlay:  true,
+		compute: func(candles []Candle, p map[string]float64) map[string][]float64 {
+			middle, upper, lower := indicators.BollingerSeries(candleCloses(candles), int(p["period"]), p["k"])
+			return map[string][]float64{"middle": middle, "upper": upper, "lower": lower}
+		},
+	},
+	"rsi": {
+		defaults: map[string]float64{"period": 14},
+		compute: func(candles []Candle, p map[string]float64) map[string][]float64 {
+			return map[string][]float64{"rsi": indicators.RSISeries(candleCloses(candles), int(p["period"]))}
+		},
+	},
+	"macd": {
+		defaults: map[string]float64{"fast": 12, "slow": 26, "signal": 9},
+		compute: func(candles []Candle, p map[string]float64) map[string][]float64 {
+			line, signal, hist := indicators.MACDSeries(candleCloses(candles), int(p["fast"]), int(p["slow"]), int(p["signal"]))
+			return map[string][]float64{"macd": line, "signal": signal, "histogram": hist}
+		},
+	},
+	"atr": {
+		defaults: map[string]float64{"period": 14},
+		compute: func(candles []Candle, p map[string]float64) map[string][]float64 {
+			high, low, close := candleHLC(candles)
+			return map[string][]float64{"atr": indicators.ATRSeries(high, low, close, int(p["period"]))}
+		},
+	},
+	"stochastic": {
+		defaults: map[string]float64{"period": 14, "smooth": 3},
+		compute: func(candles []Candle, p map[string]float64) map[string][]float64 {
+			high, low, close := candleHLC(candles)
+			k, d := indicators.StochasticSeries(high, low, close, int(p["period"]), int(p["smooth"]))
+			return map[string][]float64{"k": k, "d": d}
+		},
+	},
+}
+
+// indicatorNames returns the names served by /api/indicators in sorted order.
+func indicatorNames() []string {
+	var names []string
+	for n := range indicatorSpecs {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// computeIndicator runs the named indicator over candles. params override the
+// indicator's defaults; the resolved parameters are returned alongside the
+// output series, which are aligned with candles.
+func computeIndicator(name string, params map[string]string, candles []Candle) (map[string][]float64, map[string]float64, error) {
+	spec, ok := indicatorSpecs[name]
+	if !ok {
+		return nil, nil, fmt.Errorf("unknown indicator %q", name)
+	}
+	resolved := make(map[string]float64)
+	for k, v := range spec.defaults {
+		resolved[k] = v
+	}
+	for k, v := range params {
+		if _, known := spec.defaults[k]; !known {
+			return nil, nil, fmt.Errorf("%s: unknown parameter %q", name, k)
+		}
+		n, err := strconv.ParseFloat(v, 64)
+		if err != nil || n <= 0 {
+			return nil, nil, fmt.Errorf("%s: invalid %s %q", name, k, v)
+		}
+		resolved[k] = n
+	}
+	return spec.compute(candles, resolved), resolved, nil
+}
+
+// candleCloses returns the close of every candle.
+func candleCloses(candles []Candle) []float64 {
+	closes := make([]float64, len(candles))
+	for i, c := range candles {
+		closes[i] = c.Close
+	}
+	return closes
+}
+
+// candleHLC returns the high, low and close of every candle.
+func candleHLC(candles []Candle) (high, low, close []float64) {
+	high = make([]float64, len(candles))
+	low = make([]float64, len(candles))
+	close = make([]float64, len(candles))
+	for i, c := range candles {
+		high[i], low[i], close[i] = c.High, c.Low, c.Close
+	}
+	return high, low, close
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestComputeIndicator_AppliesDefaultsAndOverrides(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	var candles []Candle
+	for i := 0; i < 30; i++ {
+		p := 100 + float64(i)
+		candles = append(candles, Candle{Time: start.Add(time.Duration(i) * time.Hour), High: p + 1, Low: p - 1, Close: p})
+	}
+
+	series, params, err := computeIndicator("macd", map[string]string{"fast": "6"}, candles)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if params["fast"] != 6 || params["slow"] != 26 || params["signal"] != 9 {
+		t.Fatalf("unexpected params: %v", params)
+	}
+	for _, name := range []string{"macd", "signal", "histogram"} {
+		if len(series[name]) != len(candles) {
+			t.Fatalf("expected %d %s values, got %d", len(candles), name, len(series[name]))
+		}
+	}
+
+	// A steady uptrend has an RSI of 100
+	series, _, err = computeIndicator("rsi", nil, candles)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := series["rsi"][len(candles)-1]; got != 100 {
+		t.Fatalf("expected RSI 100, got %v", got)
+	}
+}
+
+func TestComputeIndicator_RejectsBadInput(t *testing.T) {
+	if _, _, err := computeIndicator("nope", nil, nil); err == nil {
+		t.Fatalf("expected error for unknown indicator")
+	}
+	if _, _, err := computeIndicator("rsi", map[string]string{"length": "14"}, nil); err == nil {
+		t.Fatalf("expected error for unknown parameter")
+	}
+	if _, _, err := computeIndicator("rsi", map[string]string{"period": "-1"}, nil); err == nil {
+		t.Fatalf("expected error for invalid period")
+	}
+}
@@ -0,0 +1,292 @@
+// Package indicators implements streaming technical indicators that update in
+// constant time per value, plus batch helpers that run them over a series.
+package indicators
+
+import "time"
+
+// SMA is a streaming simple moving average over the last N values.
+type SMA struct {
+	n      int
+	buf    []float64
+	next   int
+	filled int
+	sum    float64
+}
+
+// NewSMA returns a simple moving average over window values (minimum 1).
+func NewSMA(window int) *SMA {
+	if window < 1 {
+		window = 1
+	}
+	return &SMA{n: window, buf: make([]float64, window)}
+}
+
+// Update adds a value and returns the new average.
+func (s *SMA) Update(x float64) float64 {
+	if s.filled == s.n {
+		s.sum -= s.buf[s.next]
+	} else {
+		s.filled++
+	}
+	s.buf[s.next] = x
+	s.next = (s.next + 1) % s.n
+	s.sum += x
+	return s.Value()
+}
+
+// Value returns the average of the values seen so far, up to the window size.
+func (s *SMA) Value() float64 {
+	if s.filled == 0 {
+		return 0
+	}
+	return s.sum / float64(s.filled)
+}
+
+// Ready reports whether a full window of values has been seen.
+func (s *SMA) Ready() bool {
+	return s.filled == s.n
+}
+
+// WMA is a streaming linearly weighted moving average over the last N values:
+// the newest value has weight N, the oldest weight 1. Until the window fills
+// it averages the values seen so far with weights 1..k, matching the original
+// computeWMA.
+type WMA struct {
+	n        int
+	buf      []float64
+	next     int
+	filled   int
+	sum      float64 // plain sum of the window
+	weighted float64 // weighted sum of the window
+}
+
+// NewWMA returns a weighted moving average over window values (minimum 1).
+func NewWMA(window int) *WMA {
+	if window < 1 {
+		window = 1
+	}
+	return &WMA{n: window, buf: make([]float64, window)}
+}
+
+// Update adds a value and returns the new average.
+func (w *WMA) Update(x float64) float64 {
+	if w.filled == w.n {
+		// Every remaining value loses one unit of weight and the oldest drops out
+		w.weighted += float64(w.n)*x - w.sum
+		w.sum += x - w.buf[w.next]
+	} else {
+		w.filled++
+		w.weighted += float64(w.filled) * x
+		w.sum += x
+	}
+	w.buf[w.next] = x
+	w.next = (w.next + 1) % w.n
+	return w.Value()
+}
+
+// Value returns the current weighted average.
+func (w *WMA) Value() float64 {
+	if w.filled == 0 {
+		return 0
+	}
+	k := float64(w.filled)
+	return w.weighted / (k * (k + 1) / 2)
+}
+
+// Ready reports whether a full window of values has been seen.
+func (w *WMA) Ready() bool {
+	return w.filled == w.n
+}
+
+// EMA is a streaming exponential moving average with smoothing 2/(N+1),
+// seeded with the first value.
+type EMA struct {
+	alpha float64
+	value float64
+	count int
+	n     int
+}
+
+// NewEMA returns an exponential moving average with the given period (minimum 1).
+func NewEMA(period int) *EMA {
+	if period < 1 {
+		period = 1
+	}
+	return &EMA{alpha: 2 / float64(period+1), n: period}
+}
+
+// Update adds a value and returns the new average.
+func (e *EMA) Update(x float64) float64 {
+	if e.count == 0 {
+		e.value = x
+	} else {
+		e.value += e.alpha * (x - e.value)
+	}
+	e.count++
+	return e.value
+}
+
+// Value returns the current average.
+func (e *EMA) Value() float64 {
+	return e.value
+}
+
+// Ready reports whether at least one period of values has been seen.
+func (e *EMA) Ready() bool {
+	return e.count >= e.n
+}
+
+// TimeWMA is a streaming weighted moving average over a time window rather
+// than a sample count: a value observed at t has weight proportional to how
+// far t is into the window (end-window, end]. Gaps in the data contribute
+// nothing instead of stretching the window, so the average means the same
+// thing at any sampling rate.
+type TimeWMA struct {
+	window time.Duration
+	times  []time.Time
+	values []float64
+	head   int
+
+	// Running sums over the window, with times as seconds since ref to keep
+	// the products well inside float64 precision
+	ref   time.Time
+	n     float64
+	sumT  float64
+	sumX  float64
+	sumXT float64
+}
+
+// NewTimeWMA returns a time-weighted moving average over window.
+func NewTimeWMA(window time.Duration) *TimeWMA {
+	return &TimeWMA{window: window}
+}
+
+// Update adds a value observed at t, which must not be earlier than the
+// previous update, and returns the average for the window ending at t.
+func (w *TimeWMA) Update(t time.Time, x float64) float64 {
+	if w.ref.IsZero() {
+		w.ref = t
+	}
+	w.times = append(w.times, t)
+	w.values = append(w.values, x)
+	st := t.Sub(w.ref).Seconds()
+	w.n++
+	w.sumT += st
+	w.sumX += x
+	w.sumXT += x * st
+	return w.ValueAt(t)
+}
+
+// ValueAt returns the average for the window ending at end, dropping values
+// that have left the window. end must not move backwards between calls.
+func (w *TimeWMA) ValueAt(end time.Time) float64 {
+	start := end.Add(-w.window)
+	for w.head < len(w.times) && !w.times[w.head].After(start) {
+		st := w.times[w.head].Sub(w.ref).Seconds()
+		x := w.values[w.head]
+		w.n--
+		w.sumT -= st
+		w.sumX -= x
+		w.sumXT -= x * st
+		w.head++
+	}
+	w.compact()
+
+	// weight_i = t_i - start, so sum(w*x) = sumXT - start*sumX and sum(w) = sumT - n*start
+	s := start.Sub(w.ref).Seconds()
+	sumW := w.sumT - w.n*s
+	if w.n == 0 || sumW <= 0 {
+		return 0
+	}
+	return (w.sumXT - s*w.sumX) / sumW
+}
+
+// Peek returns what Update(t, x) would return without adding x, e.g. for a
+// candle still in progress. Unlike ValueAt it evicts nothing, so a later
+// ValueAt or Update may still use an end before t.
+func (w *TimeWMA) Peek(t time.Time, x float64) float64 {
+	ref := w.ref
+	if ref.IsZero() {
+		ref = t
+	}
+	st := t.Sub(ref).Seconds()
+	n, sumT, sumX, sumXT := w.n+1, w.sumT+st, w.sumX+x, w.sumXT+x*st
+	start := t.Add(-w.window)
+	for i := w.head; i < len(w.times) && !w.times[i].After(start); i++ {
+		st := w.times[i].Sub(ref).Seconds()
+		n--
+		sumT -= st
+		sumX -= w.values[i]
+		sumXT -= w.values[i] * st
+	}
+
+	s := start.Sub(ref).Seconds()
+	sumW := sumT - n*s
+	if n == 0 || sumW <= 0 {
+		return 0
+	}
+	return (sumXT - s*sumX) / sumW
+}
+
+// compact drops evicted entries and, once the reference time is far behind,
+// rebases the running sums on the oldest value still in the window.
+func (w *TimeWMA) compact() {
+	if w.head > 0 && w.head*2 >= len(w.times) {
+		w.times = append(w.times[:0], w.times[w.head:]...)
+		w.values = append(w.values[:0], w.values[w.head:]...)
+		w.head = 0
+	}
+	if len(w.times) == w.head || w.times[w.head].Sub(w.ref) <= 4*w.window {
+		return
+	}
+	w.ref = w.times[w.head]
+	w.n, w.sumT, w.sumX, w.sumXT = 0, 0, 0, 0
+	for i := w.head; i < len(w.times); i++ {
+		st := w.times[i].Sub(w.ref).Seconds()
+		w.n++
+		w.sumT += st
+		w.sumX += w.values[i]
+		w.sumXT += w.values[i] * st
+	}
+}
+
+// SMASeries returns the simple moving average at every point of values.
+func SMASeries(values []float64, window int) []float64 {
+	s := NewSMA(window)
+	res := make([]float64, len(values))
+	for i, v := range values {
+		res[i] = s.Update(v)
+	}
+	return res
+}
+
+// WMASeries returns the weighted moving average at every point of values.
+func WMASeries(values []float64, window int) []float64 {
+	w := NewWMA(window)
+	res := make([]float64, len(values))
+	for i, v := range values {
+		res[i] = w.Update(v)
+	}
+	return res
+}
+
+// EMASeries returns the exponential moving average at every point of values.
+func EMASeries(values []float64, period int) []float64 {
+	e := NewEMA(period)
+	res := make([]float64, len(values))
+	for i, v := range values {
+		res[i] = e.Update(v)
+	}
+	return res
+}
+
+// TimeWMASeries returns the time-weighted moving average at every point.
+// times must be in ascending order and the same length as values.
+func TimeWMASeries(times []time.Time, values []float64, window time.Duration) []float64 {
+	w := NewTimeWMA(window)
+	res := make([]float64, len(values))
+	for i, v := range values {
+		res[i] = w.Update(times[i], v)
+	}
+	return res
+}
@@ -0,0 +1,115 @@
+package indicators
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+// naiveWMA is the original O(n·window) computeWMA the streaming WMA replaces.
+func naiveWMA(prices []float64, window int) []float64 {
+	res := make([]float64, len(prices))
+	for i := range prices {
+		start := i - window + 1
+		if start < 0 {
+			start = 0
+		}
+		var weightedSum, sumWeights float64
+		for j := start; j <= i; j++ {
+			weight := float64(j - start + 1)
+			weightedSum += prices[j] * weight
+			sumWeights += weight
+		}
+		res[i] = weightedSum / sumWeights
+	}
+	return res
+}
+
+func randomWalk(n int) []float64 {
+	r := rand.New(rand.NewSource(1))
+	prices := make([]float64, n)
+	p := 50000.0
+	for i := range prices {
+		p += r.NormFloat64() * 100
+		prices[i] = p
+	}
+	return prices
+}
+
+func assertClose(t *testing.T, what string, got, want float64) {
+	t.Helper()
+	if math.Abs(got-want) > 1e-6*math.Max(1, math.Abs(want)) {
+		t.Fatalf("%s: expected %f, got %f", what, want, got)
+	}
+}
+
+func TestWMASeries_MatchesNaive(t *testing.T) {
+	prices := randomWalk(500)
+	for _, window := range []int{1, 7, 30, 240} {
+		got := WMASeries(prices, window)
+		want := naiveWMA(prices, window)
+		for i := range prices {
+			assertClose(t, "WMA", got[i], want[i])
+		}
+	}
+}
+
+func TestSMAAndEMA(t *testing.T) {
+	sma := SMASeries([]float64{1, 2, 3, 4, 5}, 3)
+	for i, want := range []float64{1, 1.5, 2, 3, 4} {
+		assertClose(t, "SMA", sma[i], want)
+	}
+
+	ema := EMASeries([]float64{10, 20, 20}, 3) // alpha = 0.5
+	for i, want := range []float64{10, 15, 17.5} {
+		assertClose(t, "EMA", ema[i], want)
+	}
+}
+
+func TestTimeWMA_MatchesNaiveWithGaps(t *testing.T) {
+	prices := randomWalk(2000)
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	var times []time.Time
+	var values []float64
+	for i, p := range prices {
+		if i%50 < 5 {
+			continue // simulate collection outages
+		}
+		times = append(times, start.Add(time.Duration(i)*time.Hour))
+		values = append(values, p)
+	}
+
+	window := 24 * time.Hour
+	got := TimeWMASeries(times, values, window)
+	for i, end := range times {
+		from := end.Add(-window)
+		var weightedSum, sumWeights float64
+		for j := 0; j <= i; j++ {
+			if !times[j].After(from) {
+				continue
+			}
+			weight := times[j].Sub(from).Seconds()
+			weightedSum += values[j] * weight
+			sumWeights += weight
+		}
+		assertClose(t, "TimeWMA", got[i], weightedSum/sumWeights)
+	}
+}
+
+func TestTimeWMA_PeekMatchesUpdate(t *testing.T) {
+	prices := randomWalk(500)
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	window := 12 * time.Hour
+	w, ref := NewTimeWMA(window), NewTimeWMA(window)
+	for i, p := range prices {
+		ts := start.Add(time.Duration(i) * time.Hour)
+		peeked := w.Peek(ts, p)
+		// Peeking must not evict values still needed an hour back
+		if i > 0 {
+			assertClose(t, "ValueAt after Peek", w.ValueAt(ts.Add(-time.Hour)), ref.ValueAt(ts.Add(-time.Hour)))
+		}
+		assertClose(t, "Peek", peeked, ref.Update(ts, p))
+		w.Update(ts, p)
+	}
+}
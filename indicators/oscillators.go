@@ -0,0 +1,277 @@
+package indicators
+
+import "math"
+
+// RSI is a streaming relative strength index using Wilder's smoothing. It
+// reports 50 until period changes have been seen.
+type RSI struct {
+	period  int
+	prev    float64
+	count   int
+	avgGain float64
+	avgLoss float64
+}
+
+// NewRSI returns an RSI over period values (minimum 1).
+func NewRSI(period int) *RSI {
+	if period < 1 {
+		period = 1
+	}
+	return &RSI{period: period}
+}
+
+// Update adds a value and returns the new RSI (0-100).
+func (r *RSI) Update(x float64) float64 {
+	if r.count == 0 {
+		r.prev = x
+		r.count++
+		return 50
+	}
+	change := x - r.prev
+	r.prev = x
+	gain, loss := math.Max(change, 0), math.Max(-change, 0)
+
+	n := float64(r.period)
+	if r.count <= r.period {
+		// Seed the averages with a simple mean of the first period changes
+		r.avgGain += gain / n
+		r.avgLoss += loss / n
+	} else {
+		r.avgGain = (r.avgGain*(n-1) + gain) / n
+		r.avgLoss = (r.avgLoss*(n-1) + loss) / n
+	}
+	r.count++
+	return r.Value()
+}
+
+// Value returns the current RSI.
+func (r *RSI) Value() float64 {
+	if !r.Ready() {
+		return 50
+	}
+	if r.avgLoss == 0 {
+		if r.avgGain == 0 {
+			return 50
+		}
+		return 100
+	}
+	return 100 - 100/(1+r.avgGain/r.avgLoss)
+}
+
+// Ready reports whether period changes have been seen.
+func (r *RSI) Ready() bool {
+	return r.count > r.period
+}
+
+// MACD is a streaming moving average convergence/divergence: the difference
+// between a fast and slow EMA, a signal EMA of that difference and the
+// histogram between them.
+type MACD struct {
+	fast, slow, signal *EMA
+}
+
+// NewMACD returns a MACD with the given EMA periods (commonly 12, 26, 9).
+func NewMACD(fast, slow, signal int) *MACD {
+	return &MACD{fast: NewEMA(fast), slow: NewEMA(slow), signal: NewEMA(signal)}
+}
+
+// Update adds a value and returns the MACD line, signal line and histogram.
+func (m *MACD) Update(x float64) (line, signal, histogram float64) {
+	line = m.fast.Update(x) - m.slow.Update(x)
+	signal = m.signal.Update(line)
+	return line, signal, line - signal
+}
+
+// Bollinger is a streaming Bollinger Band: an SMA with bands k population
+// standard deviations above and below it.
+type Bollinger struct {
+	sma   *SMA
+	k     float64
+	sumSq float64
+}
+
+// NewBollinger returns Bollinger Bands over window values, k deviations wide
+// (commonly 20 and 2).
+func NewBollinger(window int, k float64) *Bollinger {
+	return &Bollinger{sma: NewSMA(window), k: k}
+}
+
+// Update adds a value and returns the middle, upper and lower bands.
+func (b *Bollinger) Update(x float64) (middle, upper, lower float64) {
+	if b.sma.filled == b.sma.n {
+		old := b.sma.buf[b.sma.next]
+		b.sumSq -= old * old
+	}
+	b.sumSq += x * x
+	middle = b.sma.Update(x)
+
+	n := float64(b.sma.filled)
+	variance := b.sumSq/n - middle*middle
+	if variance < 0 {
+		variance = 0 // rounding
+	}
+	dev := b.k * math.Sqrt(variance)
+	return middle, middle + dev, middle - dev
+}
+
+// ATR is a streaming average true range using Wilder's smoothing.
+type ATR struct {
+	period    int
+	prevClose float64
+	count     int
+	value     float64
+}
+
+// NewATR returns an ATR over period bars (minimum 1).
+func NewATR(period int) *ATR {
+	if period < 1 {
+		period = 1
+	}
+	return &ATR{period: period}
+}
+
+// Update adds a bar and returns the new ATR.
+func (a *ATR) Update(high, low, close float64) float64 {
+	tr := high - low
+	if a.count > 0 {
+		tr = math.Max(tr, math.Max(math.Abs(high-a.prevClose), math.Abs(low-a.prevClose)))
+	}
+	a.prevClose = close
+	a.count++
+
+	n := float64(a.period)
+	if a.count <= a.period {
+		// Simple mean of the true ranges seen so far until the period fills
+		a.value += (tr - a.value) / float64(a.count)
+	} else {
+		a.value = (a.value*(n-1) + tr) / n
+	}
+	return a.value
+}
+
+// Value returns the current ATR.
+func (a *ATR) Value() float64 {
+	return a.value
+}
+
+// Stochastic is a streaming stochastic oscillator: %K is where the close sits
+// in the high/low range of the last period bars, %D an SMA of %K.
+type Stochastic struct {
+	period int
+	count  int
+	highs  monotonicWindow
+	lows   monotonicWindow
+	d      *SMA
+}
+
+// NewStochastic returns a stochastic oscillator with the given %K period and
+// %D smoothing (commonly 14 and 3).
+func NewStochastic(period, smooth int) *Stochastic {
+	if period < 1 {
+		period = 1
+	}
+	return &Stochastic{
+		period: period,
+		highs:  monotonicWindow{max: true},
+		lows:   monotonicWindow{max: false},
+		d:      NewSMA(smooth),
+	}
+}
+
+// Update adds a bar and returns %K and %D (0-100).
+func (s *Stochastic) Update(high, low, close float64) (k, d float64) {
+	s.highs.push(s.count, high, s.period)
+	s.lows.push(s.count, low, s.period)
+	s.count++
+
+	hi, lo := s.highs.front(), s.lows.front()
+	k = 50
+	if hi > lo {
+		k = 100 * (close - lo) / (hi - lo)
+	}
+	return k, s.d.Update(k)
+}
+
+// monotonicWindow tracks the max (or min) of a sliding window in amortized
+// constant time.
+type monotonicWindow struct {
+	max   bool
+	index []int
+	value []float64
+}
+
+func (m *monotonicWindow) push(i int, x float64, window int) {
+	for len(m.value) > 0 {
+		last := m.value[len(m.value)-1]
+		if (m.max && last > x) || (!m.max && last < x) {
+			break
+		}
+		m.index = m.index[:len(m.index)-1]
+		m.value = m.value[:len(m.value)-1]
+	}
+	m.index = append(m.index, i)
+	m.value = append(m.value, x)
+	for m.index[0] <= i-window {
+		m.index = m.index[1:]
+		m.value = m.value[1:]
+	}
+}
+
+func (m *monotonicWindow) front() float64 {
+	return m.value[0]
+}
+
+// RSISeries returns the RSI at every point of values.
+func RSISeries(values []float64, period int) []float64 {
+	r := NewRSI(period)
+	res := make([]float64, len(values))
+	for i, v := range values {
+		res[i] = r.Update(v)
+	}
+	return res
+}
+
+// MACDSeries returns the MACD line, signal line and histogram at every point.
+func MACDSeries(values []float64, fast, slow, signal int) (line, sig, hist []float64) {
+	m := NewMACD(fast, slow, signal)
+	line = make([]float64, len(values))
+	sig = make([]float64, len(values))
+	hist = make([]float64, len(values))
+	for i, v := range values {
+		line[i], sig[i], hist[i] = m.Update(v)
+	}
+	return line, sig, hist
+}
+
+// BollingerSeries returns the middle, upper and lower bands at every point.
+func BollingerSeries(values []float64, window int, k float64) (middle, upper, lower []float64) {
+	b := NewBollinger(window, k)
+	middle = make([]float64, len(values))
+	upper = make([]float64, len(values))
+	lower = make([]float64, len(values))
+	for i, v := range values {
+		middle[i], upper[i], lower[i] = b.Update(v)
+	}
+	return middle, upper, lower
+}
+
+// ATRSeries returns the ATR at every bar. The slices must be the same length.
+func ATRSeries(high, low, close []float64, period int) []float64 {
+	a := NewATR(period)
+	res := make([]float64, len(close))
+	for i := range close {
+		res[i] = a.Update(high[i], low[i], close[i])
+	}
+	return res
+}
+
+// StochasticSeries returns %K and %D at every bar. The slices must be the same length.
+func StochasticSeries(high, low, close []float64, period, smooth int) (k, d []float64) {
+	s := NewStochastic(period, smooth)
+	k = make([]float64, len(close))
+	d = make([]float64, len(close))
+	for i := range close {
+		k[i], d[i] = s.Update(high[i], low[i], close[i])
+	}
+	return k, d
+}
@@ -0,0 +1,58 @@
+package indicators
+
+import (
+	"math"
+	"testing"
+)
+
+func TestRSI(t *testing.T) {
+	up := RSISeries([]float64{1, 2, 3, 4, 5, 6}, 3)
+	assertClose(t, "RSI warm-up", up[2], 50)
+	assertClose(t, "RSI rising", up[5], 100)
+
+	// Equal gains and losses balance out at 50
+	zigzag := RSISeries([]float64{10, 11, 10, 11, 10, 11, 10}, 2)
+	if v := zigzag[len(zigzag)-1]; v <= 0 || v >= 100 {
+		t.Fatalf("expected RSI strictly between 0 and 100, got %f", v)
+	}
+}
+
+func TestMACD_FlatSeriesIsZero(t *testing.T) {
+	line, sig, hist := MACDSeries([]float64{5, 5, 5, 5, 5}, 12, 26, 9)
+	for i := range line {
+		if line[i] != 0 || sig[i] != 0 || hist[i] != 0 {
+			t.Fatalf("expected zero MACD at %d, got %f %f %f", i, line[i], sig[i], hist[i])
+		}
+	}
+}
+
+func TestBollinger(t *testing.T) {
+	middle, upper, lower := BollingerSeries([]float64{2, 4, 4, 4, 5, 5, 7, 9}, 8, 2)
+	last := len(middle) - 1
+	// Population standard deviation of the window is exactly 2
+	assertClose(t, "middle", middle[last], 5)
+	assertClose(t, "upper", upper[last], 9)
+	assertClose(t, "lower", lower[last], 1)
+}
+
+func TestATR(t *testing.T) {
+	high := []float64{11, 12, 13}
+	low := []float64{9, 10, 11}
+	close := []float64{10, 11, 12}
+	atr := ATRSeries(high, low, close, 2)
+	assertClose(t, "ATR first", atr[0], 2)
+	assertClose(t, "ATR", atr[2], 2)
+}
+
+func TestStochastic(t *testing.T) {
+	high := []float64{10, 12, 14, 13, 11}
+	low := []float64{8, 9, 10, 9, 7}
+	close := []float64{9, 12, 14, 9, 7}
+	k, d := StochasticSeries(high, low, close, 3, 2)
+	assertClose(t, "%K at high", k[2], 100)
+	assertClose(t, "%K at low", k[4], 0)
+	assertClose(t, "%D", d[2], (k[1]+k[2])/2)
+	if math.IsNaN(k[0]) {
+		t.Fatalf("expected a number for the first bar")
+	}
+}
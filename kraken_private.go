@@ -0,0 +1,281 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// KrakenPrivateClient calls Kraken's authenticated REST API, ported from
+// _kraken_signature and kraken_place_order in crypto_sim_actual_buys.py.
+type KrakenPrivateClient struct {
+	BaseURL string
+	Client  *http.Client
+	Key     string
+	secret  []byte // decoded API secret
+
+	mu        sync.Mutex
+	lastNonce int64
+}
+
+// NewKrakenPrivateClient returns a client for krakenAPIURL using the
+// given API key and base64-encoded secret.
+func NewKrakenPrivateClient(key, secret string) (*KrakenPrivateClient, error) {
+	if key == "" || secret == "" {
+		return nil, fmt.Errorf("KRAKEN_API_KEY and KRAKEN_API_SECRET are required")
+	}
+	decoded, err := base64.StdEncoding.DecodeString(secret)
+	if err != nil {
+		return nil, fmt.Errorf("invalid KRAKEN_API_SECRET: %w", err)
+	}
+	return &KrakenPrivateClient{
+		BaseURL: krakenAPIURL(),
+		Client:  &http.Client{Timeout: 15 * time.Second},
+		Key:     key,
+		secret:  decoded,
+	}, nil
+}
+
+// nonce returns a millisecond timestamp, bumped when needed so that every
+// request carries a strictly increasing nonce as Kraken requires.
+func (k *KrakenPrivateClient) nonce() int64 {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	n := time.Now().UnixMilli()
+	if n <= k.lastNonce {
+		n = k.lastNonce + 1
+	}
+	k.lastNonce = n
+	return n
+}
+
+// krakenSignature signs a private request: the base64 HMAC-SHA512, keyed by
+// the decoded secret, of the URL path followed by SHA256(nonce + POST body).
+func krakenSignature(path, nonce, body string, secret []byte) string {
+	sum := sha256.Sum256([]byte(nonce + body))
+	mac := hmac.New(sha512.New, secret)
+	mac.Write([]byte(path))
+	mac.Write(sum[:])
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// KrakenAPIError is an error Kraken reported in a response's error array. It
+// means Kraken received and refused the request, unlike transport errors
+// after which the outcome is unknown.
+type KrakenAPIError struct {
+	Method string
+	Errors []string
+}
+
+func (e *KrakenAPIError) Error() string {
+	return e.Method + ": " + strings.Join(e.Errors, ", ")
+}
+
+// errInvalidOrder is returned by AddOrder for requests it refuses to send.
+var errInvalidOrder = errors.New("invalid order")
+
+// post calls the private endpoint method with params and decodes the result
+// into out. Errors reported by Kraken are returned as a *KrakenAPIError.
+func (k *KrakenPrivateClient) post(ctx context.Context, method string, params url.Values, out interface{}) error {
+	path := "/0/private/" + method
+	if params == nil {
+		params = url.Values{}
+	}
+	nonce := strconv.FormatInt(k.nonce(), 10)
+	params.Set("nonce", nonce)
+	body := params.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, k.BaseURL+path, strings.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("API-Key", k.Key)
+	req.Header.Set("API-Sign", krakenSignature(path, nonce, body, k.secret))
+
+	resp, err := k.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s: %w", method, err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("%s: %w", method, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: status %d: %s", method, resp.StatusCode, string(data))
+	}
+
+	var envelope struct {
+		Error  []string        `json:"error"`
+		Result json.RawMessage `json:"result"`
+	}
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		return fmt.Errorf("%s: %w", method, err)
+	}
+	if len(envelope.Error) > 0 {
+		return &KrakenAPIError{Method: method, Errors: envelope.Error}
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.Unmarshal(envelope.Result, out); err != nil {
+		return fmt.Errorf("%s: %w", method, err)
+	}
+	return nil
+}
+
+// OrderRequest describes an order for AddOrder.
+type OrderRequest struct {
+	Pair      string  // Kraken pair, e.g. XBTUSD
+	Side      string  // buy or sell
+	OrderType string  // market (default) or limit
+	Volume    float64 // base asset quantity
+	Price     float64 // limit price; ignored for market orders
+	UserRef   int32   // optional reference echoed back in QueryOrders and used to find the order
+	Validate  bool    // validate only; Kraken checks the order without placing it
+}
+
+// AddOrderResult is Kraken's response to AddOrder.
+type AddOrderResult struct {
+	Description struct {
+		Order string `json:"order"`
+	} `json:"descr"`
+	TxIDs []string `json:"txid"` // empty when the order was only validated
+}
+
+// AddOrder places (or with Validate, checks) an order.
+func (k *KrakenPrivateClient) AddOrder(ctx context.Context, o OrderRequest) (*AddOrderResult, error) {
+	if o.Side != "buy" && o.Side != "sell" {
+		return nil, fmt.Errorf("%w side %q", errInvalidOrder, o.Side)
+	}
+	if o.Volume <= 0 {
+		return nil, fmt.Errorf("%w volume %v", errInvalidOrder, o.Volume)
+	}
+	orderType := o.OrderType
+	if orderType == "" {
+		orderType = "market"
+	}
+	params := url.Values{
+		"pair":      {o.Pair},
+		"type":      {o.Side},
+		"ordertype": {orderType},
+		"volume":    {strconv.FormatFloat(o.Volume, 'f', 8, 64)},
+	}
+	if orderType == "limit" {
+		params.Set("price", strconv.FormatFloat(o.Price, 'f', -1, 64))
+	}
+	if o.UserRef != 0 {
+		params.Set("userref", strconv.FormatInt(int64(o.UserRef), 10))
+	}
+	if o.Validate {
+		params.Set("validate", "true")
+	}
+	var result AddOrderResult
+	if err := k.post(ctx, "AddOrder", params, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// CancelOrder cancels the open order txid and returns how many orders were
+// cancelled.
+func (k *KrakenPrivateClient) CancelOrder(ctx context.Context, txid string) (int, error) {
+	var result struct {
+		Count int `json:"count"`
+	}
+	if err := k.post(ctx, "CancelOrder", url.Values{"txid": {txid}}, &result); err != nil {
+		return 0, err
+	}
+	return result.Count, nil
+}
+
+// KrakenOrder is an order's state as reported by QueryOrders. Kraken sends
+// quantities and prices as strings.
+type KrakenOrder struct {
+	Status      string `json:"status"` // pending, open, closed, canceled or expired
+	Reason      string `json:"reason"` // why the order was cancelled, if it was
+	UserRef     int32  `json:"userref"`
+	Description struct {
+		Pair      string `json:"pair"`
+		Type      string `json:"type"`
+		OrderType string `json:"ordertype"`
+		Price     string `json:"price"`
+	} `json:"descr"`
+	Volume     string  `json:"vol"`
+	VolumeExec string  `json:"vol_exec"`
+	Cost       string  `json:"cost"`
+	Fee        string  `json:"fee"`
+	Price      string  `json:"price"` // average fill price
+	OpenTime   float64 `json:"opentm"`
+	CloseTime  float64 `json:"closetm"`
+}
+
+// QueryOrders returns the state of the given orders keyed by txid.
+func (k *KrakenPrivateClient) QueryOrders(ctx context.Context, txids ...string) (map[string]KrakenOrder, error) {
+	if len(txids) == 0 {
+		return map[string]KrakenOrder{}, nil
+	}
+	result := make(map[string]KrakenOrder)
+	if err := k.post(ctx, "QueryOrders", url.Values{"txid": {strings.Join(txids, ",")}, "trades": {"true"}}, &result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// OpenOrders returns the open orders placed with userref, keyed by txid.
+func (k *KrakenPrivateClient) OpenOrders(ctx context.Context, userref int32) (map[string]KrakenOrder, error) {
+	var result struct {
+		Open map[string]KrakenOrder `json:"open"`
+	}
+	params := url.Values{"userref": {strconv.FormatInt(int64(userref), 10)}}
+	if err := k.post(ctx, "OpenOrders", params, &result); err != nil {
+		return nil, err
+	}
+	return result.Open, nil
+}
+
+// ClosedOrders returns the orders placed with userref that closed after
+// start, keyed by txid.
+func (k *KrakenPrivateClient) ClosedOrders(ctx context.Context, userref int32, start time.Time) (map[string]KrakenOrder, error) {
+	var result struct {
+		Closed map[string]KrakenOrder `json:"closed"`
+	}
+	params := url.Values{
+		"userref": {strconv.FormatInt(int64(userref), 10)},
+		"start":   {strconv.FormatInt(start.Unix(), 10)},
+	}
+	if err := k.post(ctx, "ClosedOrders", params, &result); err != nil {
+		return nil, err
+	}
+	return result.Closed, nil
+}
+
+// Balance returns the account's balance per Kraken asset code (e.g. ZUSD, XXBT).
+func (k *KrakenPrivateClient) Balance(ctx context.Context) (map[string]float64, error) {
+	var raw map[string]string
+	if err := k.post(ctx, "Balance", nil, &raw); err != nil {
+		return nil, err
+	}
+	balances := make(map[string]float64, len(raw))
+	for asset, amount := range raw {
+		n, err := strconv.ParseFloat(amount, 64)
+		if err != nil {
+			return nil, fmt.Errorf("Balance: invalid %s amount %q", asset, amount)
+		}
+		balances[asset] = n
+	}
+	return balances, nil
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+const testKrakenSecret = "kQH5HW/8p1uGOVjbgWA7FunAmGO8lsSUXNsu3eow76sz84Q18fWxnyRzBHCd3pd5nE9qa99HAZtuZuj6F1huXg=="
+
+func TestKrakenSignature_MatchesDocumentedExample(t *testing.T) {
+	secret, _ := base64.StdEncoding.DecodeString(testKrakenSecret)
+	body := "nonce=1616492376594&ordertype=limit&pair=XBTUSD&price=37500&type=buy&volume=1.25"
+	got := krakenSignature("/0/private/AddOrder", "1616492376594", body, secret)
+	want := "4/dpxb3iT4tp/ZCVEwSnEsLxx0bqyhLpdfOpc6fn7OR8+UClSV5n9E6aSS8MPtnRfp32bAb0nmbRn6H8ndwLUQ=="
+	if got != want {
+		t.Fatalf("expected %s, got %s", want, got)
+	}
+}
+
+// newTestKrakenPrivate returns a client pointed at handler, which is called
+// only for requests whose signature verifies.
+func newTestKrakenPrivate(t *testing.T, handler func(method string, form url.Values) string) *KrakenPrivateClient {
+	t.Helper()
+	var lastNonce int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		form, _ := url.ParseQuery(string(body))
+		secret, _ := base64.StdEncoding.DecodeString(testKrakenSecret)
+		if r.Header.Get("API-Key") != "key" || r.Header.Get("API-Sign") != krakenSignature(r.URL.Path, form.Get("nonce"), string(body), secret) {
+			w.Write([]byte(`{"error": ["EAPI:Invalid signature"]}`))
+			return
+		}
+		nonce, _ := strconv.ParseInt(form.Get("nonce"), 10, 64)
+		if nonce <= lastNonce {
+			w.Write([]byte(`{"error": ["EAPI:Invalid nonce"]}`))
+			return
+		}
+		lastNonce = nonce
+		w.Write([]byte(handler(strings.TrimPrefix(r.URL.Path, "/0/private/"), form)))
+	}))
+	t.Cleanup(srv.Close)
+
+	client, err := NewKrakenPrivateClient("key", testKrakenSecret)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	client.BaseURL, client.Client = srv.URL, srv.Client()
+	return client
+}
+
+func TestKrakenPrivateClient_Orders(t *testing.T) {
+	client := newTestKrakenPrivate(t, func(method string, form url.Values) string {
+		switch method {
+		case "AddOrder":
+			if form.Get("pair") != "XBTUSD" || form.Get("type") != "buy" || form.Get("ordertype") != "market" || form.Get("volume") != "0.01000000" {
+				return `{"error": ["EGeneral:Invalid arguments"]}`
+			}
+			if form.Get("validate") == "true" {
+				return `{"error": [], "result": {"descr": {"order": "buy 0.01000000 XBTUSD @ market"}}}`
+			}
+			return `{"error": [], "result": {"descr": {"order": "buy 0.01000000 XBTUSD @ market"}, "txid": ["OABC12-DEF34-GHI567"]}}`
+		case "QueryOrders":
+			return `{"error": [], "result": {"OABC12-DEF34-GHI567": {"status": "closed", "descr": {"pair": "XBTUSD", "type": "buy", "ordertype": "market"}, "vol": "0.01000000", "vol_exec": "0.01000000", "cost": "650.00", "fee": "1.69", "price": "65000.0"}}}`
+		case "CancelOrder":
+			return `{"error": ["EOrder:Unknown order"]}`
+		case "Balance":
+			return `{"error": [], "result": {"ZUSD": "1000.5000", "XXBT": "0.0100000000"}}`
+		}
+		return `{"error": ["EGeneral:Unknown method"]}`
+	})
+	ctx := context.Background()
+
+	order := OrderRequest{Pair: "XBTUSD", Side: "buy", Volume: 0.01, Validate: true}
+	result, err := client.AddOrder(ctx, order)
+	if err != nil || len(result.TxIDs) != 0 {
+		t.Fatalf("expected a validated order without txid, got %+v, %v", result, err)
+	}
+	order.Validate = false
+	if result, err = client.AddOrder(ctx, order); err != nil || len(result.TxIDs) != 1 {
+		t.Fatalf("expected a placed order, got %+v, %v", result, err)
+	}
+
+	orders, err := client.QueryOrders(ctx, result.TxIDs[0])
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if o := orders["OABC12-DEF34-GHI567"]; o.Status != "closed" || o.VolumeExec != "0.01000000" || o.Price != "65000.0" {
+		t.Fatalf("unexpected order state: %+v", o)
+	}
+
+	if _, err := client.CancelOrder(ctx, "OABC12-DEF34-GHI567"); err == nil || !strings.Contains(err.Error(), "EOrder:Unknown order") {
+		t.Fatalf("expected Kraken's error to be returned, got %v", err)
+	}
+
+	balances, err := client.Balance(ctx)
+	if err != nil || balances["ZUSD"] != 1000.5 || balances["XXBT"] != 0.01 {
+		t.Fatalf("unexpected balances %v, %v", balances, err)
+	}
+}
+
+func TestConfiguredLiveTrader(t *testing.T) {
+	t.Setenv("KRAKEN_API_KEY", "")
+	t.Setenv("KRAKEN_API_SECRET", "")
+
+	t.Setenv("LIVE_TRADING", "")
+	if trader, err := configuredLiveTrader(nil); trader != nil || err != nil {
+		t.Fatalf("expected live trading off by default, got %v, %v", trader, err)
+	}
+
+	t.Setenv("LIVE_TRADING", "dry-run")
+	trader, err := configuredLiveTrader(nil)
+	if err != nil || trader == nil || !trader.DryRun || trader.Client != nil {
+		t.Fatalf("expected a log-only dry run without credentials, got %+v, %v", trader, err)
+	}
+
+	t.Setenv("LIVE_TRADING", "on")
+	if _, err := configuredLiveTrader(nil); err == nil {
+		t.Fatalf("expected live trading to require credentials")
+	}
+	t.Setenv("LIVE_TRADING", "maybe")
+	if _, err := configuredLiveTrader(nil); err == nil {
+		t.Fatalf("expected error for an invalid LIVE_TRADING")
+	}
+}
@@ -0,0 +1,294 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+const (
+	krakenWSURL             = "wss://ws.kraken.com/v2"
+	defaultHeartbeatTimeout = 10 * time.Second
+	maxReconnectDelay       = 60 * time.Second
+)
+
+// KrakenStream is a PriceSource fed by Kraken's public WebSocket ticker and
+// trade channels. Quote returns the most recent streamed value, falling back
+// to the REST source whenever the stream is disconnected or has gone quiet, so
+// the collector never records gaps while the socket reconnects.
+type KrakenStream struct {
+	URL              string
+	REST             PriceSource   // used for gap backfill
+	HeartbeatTimeout time.Duration // reconnect if nothing arrives for this long
+
+	startOnce sync.Once
+	mu        sync.Mutex
+	stop      context.CancelFunc // stops the stream Quote started
+	conn      *websocket.Conn
+	symbols   map[string]bool // subscribed symbols, in our canonical form
+	latest    map[string]*Quote
+	received  map[string]time.Time
+	connected bool
+}
+
+// NewKrakenStream returns a stream against the live Kraken WebSocket API that
+// backfills from rest.
+func NewKrakenStream(rest PriceSource) *KrakenStream {
+	return &KrakenStream{
+		URL:              krakenWSURL,
+		REST:             rest,
+		HeartbeatTimeout: defaultHeartbeatTimeout,
+		symbols:          make(map[string]bool),
+		latest:           make(map[string]*Quote),
+		received:         make(map[string]time.Time),
+	}
+}
+
+func (s *KrakenStream) Name() string {
+	return "kraken-ws"
+}
+
+// Quote returns the latest streamed quote for symbol. The first call for a
+// symbol subscribes to it and starts the stream if needed; Close stops it.
+func (s *KrakenStream) Quote(ctx context.Context, symbol string) (*Quote, error) {
+	s.startOnce.Do(func() {
+		runCtx, stop := context.WithCancel(context.Background())
+		s.mu.Lock()
+		s.stop = stop
+		s.mu.Unlock()
+		go s.Run(runCtx)
+	})
+	s.subscribe(symbol)
+
+	s.mu.Lock()
+	var q Quote
+	quote, ok := s.latest[symbol]
+	fresh := ok && s.connected && time.Since(s.received[symbol]) <= s.HeartbeatTimeout
+	if fresh {
+		q = *quote
+	}
+	s.mu.Unlock()
+
+	if fresh {
+		return &q, nil
+	}
+	return s.REST.Quote(ctx, symbol)
+}
+
+// Close stops the stream and closes its connection. Quotes after Close come
+// from the REST source.
+func (s *KrakenStream) Close() error {
+	s.startOnce.Do(func() {})
+	s.mu.Lock()
+	stop := s.stop
+	s.stop = nil
+	s.mu.Unlock()
+	if stop != nil {
+		stop()
+	}
+	return nil
+}
+
+// subscribe adds symbol to the subscription set and subscribes on the live
+// connection if there is one.
+func (s *KrakenStream) subscribe(symbol string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.symbols[symbol] {
+		return
+	}
+	s.symbols[symbol] = true
+	if s.conn != nil {
+		if err := sendKrakenSubscribe(s.conn, []string{symbol}); err != nil {
+			fmt.Println("Error subscribing to", symbol, "on Kraken WebSocket:", err)
+		}
+	}
+}
+
+// Run connects and reads from the WebSocket until ctx is cancelled,
+// reconnecting with exponential backoff whenever the connection drops or
+// misses heartbeats.
+func (s *KrakenStream) Run(ctx context.Context) {
+	delay := time.Second
+	for ctx.Err() == nil {
+		start := time.Now()
+		err := s.runOnce(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		fmt.Println("Kraken WebSocket disconnected, falling back to REST:", err)
+
+		// Reset the backoff once a connection has stayed up for a while
+		if time.Since(start) > maxReconnectDelay {
+			delay = time.Second
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		delay *= 2
+		if delay > maxReconnectDelay {
+			delay = maxReconnectDelay
+		}
+	}
+}
+
+// runOnce holds a single connection open until it fails.
+func (s *KrakenStream) runOnce(ctx context.Context) error {
+	config, err := websocket.NewConfig(s.URL, "http://localhost/")
+	if err != nil {
+		return err
+	}
+	dialCtx, cancel := context.WithTimeout(ctx, 15*time.Second)
+	conn, err := config.DialContext(dialCtx)
+	cancel()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// Close the connection when ctx is cancelled so the read below unblocks
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+
+	s.mu.Lock()
+	var symbols []string
+	for sym := range s.symbols {
+		symbols = append(symbols, sym)
+	}
+	s.conn = conn
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		s.conn = nil
+		s.connected = false
+		s.mu.Unlock()
+	}()
+
+	if len(symbols) > 0 {
+		if err := sendKrakenSubscribe(conn, symbols); err != nil {
+			return err
+		}
+	}
+
+	for {
+		// Kraken sends a heartbeat every second once subscribed; a silent
+		// socket means the connection is dead even if TCP hasn't noticed.
+		conn.SetReadDeadline(time.Now().Add(s.HeartbeatTimeout))
+		var msg []byte
+		if err := websocket.Message.Receive(conn, &msg); err != nil {
+			return err
+		}
+		s.mu.Lock()
+		s.connected = true
+		s.mu.Unlock()
+		s.handleMessage(msg)
+	}
+}
+
+// krakenWSMessage covers the ticker, trade and heartbeat messages of Kraken's
+// v2 WebSocket API.
+type krakenWSMessage struct {
+	Channel string `json:"channel"`
+	Type    string `json:"type"`
+	Data    []struct {
+		Symbol    string    `json:"symbol"`
+		Bid       float64   `json:"bid"`
+		Ask       float64   `json:"ask"`
+		Last      float64   `json:"last"`
+		Volume    float64   `json:"volume"`
+		Price     float64   `json:"price"`
+		Timestamp time.Time `json:"timestamp"`
+	} `json:"data"`
+}
+
+// handleMessage applies a ticker or trade update to the latest quotes.
+func (s *KrakenStream) handleMessage(msg []byte) {
+	var m krakenWSMessage
+	if err := json.Unmarshal(msg, &m); err != nil {
+		return
+	}
+	if m.Channel != "ticker" && m.Channel != "trade" {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now().UTC()
+	for _, d := range m.Data {
+		symbol := fromKrakenWSSymbol(d.Symbol)
+		quote, ok := s.latest[symbol]
+		if !ok {
+			quote = &Quote{Symbol: symbol, Source: s.URL}
+			s.latest[symbol] = quote
+		}
+		switch m.Channel {
+		case "ticker":
+			quote.Price = d.Last
+			quote.Bid = d.Bid
+			quote.Ask = d.Ask
+			quote.Volume = d.Volume
+			quote.Timestamp = now
+		case "trade":
+			quote.Price = d.Price
+			quote.Timestamp = d.Timestamp.UTC()
+			if d.Timestamp.IsZero() {
+				quote.Timestamp = now
+			}
+		}
+		if quote.Price > 0 {
+			s.received[symbol] = now
+		}
+	}
+}
+
+// sendKrakenSubscribe subscribes conn to the ticker and trade channels for symbols.
+func sendKrakenSubscribe(conn *websocket.Conn, symbols []string) error {
+	var pairs []string
+	for _, sym := range symbols {
+		pairs = append(pairs, toKrakenWSSymbol(sym))
+	}
+	for _, channel := range []string{"ticker", "trade"} {
+		req := map[string]interface{}{
+			"method": "subscribe",
+			"params": map[string]interface{}{
+				"channel": channel,
+				"symbol":  pairs,
+			},
+		}
+		if err := websocket.JSON.Send(conn, req); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// toKrakenWSSymbol converts a stored symbol (e.g. "XBT") to the WebSocket API's
+// pair notation (e.g. "BTC/USD"). The v2 API uses BTC rather than XBT.
+func toKrakenWSSymbol(symbol string) string {
+	symbol = strings.ToUpper(symbol)
+	if symbol == "XBT" {
+		symbol = "BTC"
+	}
+	return symbol + "/USD"
+}
+
+// fromKrakenWSSymbol is the inverse of toKrakenWSSymbol.
+func fromKrakenWSSymbol(pair string) string {
+	base, _, _ := strings.Cut(pair, "/")
+	return normalizeSymbol(base)
+}
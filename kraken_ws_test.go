@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+// staticSource is a PriceSource that always returns the same price.
+type staticSource struct {
+	price float64
+}
+
+func (s staticSource) Name() string { return "static" }
+
+func (s staticSource) Quote(ctx context.Context, symbol string) (*Quote, error) {
+	return &Quote{Symbol: symbol, Price: s.price, Timestamp: time.Now().UTC()}, nil
+}
+
+func TestKrakenStream_StreamsAndFallsBackToREST(t *testing.T) {
+	subscribed := make(chan string, 4)
+	srv := httptest.NewServer(websocket.Handler(func(conn *websocket.Conn) {
+		for i := 0; i < 2; i++ {
+			var req map[string]interface{}
+			if err := websocket.JSON.Receive(conn, &req); err != nil {
+				return
+			}
+			params := req["params"].(map[string]interface{})
+			subscribed <- params["channel"].(string) + ":" + params["symbol"].([]interface{})[0].(string)
+		}
+		for {
+			msg := `{"channel":"ticker","type":"update","data":[{"symbol":"BTC/USD","bid":99.5,"ask":100.5,"last":100.0,"volume":12.5}]}`
+			if err := websocket.Message.Send(conn, msg); err != nil {
+				return
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+	}))
+	defer srv.Close()
+
+	stream := NewKrakenStream(staticSource{price: 1})
+	stream.URL = "ws" + strings.TrimPrefix(srv.URL, "http")
+	stream.HeartbeatTimeout = time.Second
+	defer stream.Close()
+
+	// Before the stream has delivered anything the REST source answers
+	quote, err := stream.Quote(context.Background(), "XBT")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if quote.Price != 1 {
+		t.Fatalf("expected REST fallback price 1, got %f", quote.Price)
+	}
+
+	if got := <-subscribed; got != "ticker:BTC/USD" {
+		t.Fatalf("expected ticker:BTC/USD subscription, got %s", got)
+	}
+
+	if quote = waitForQuotePrice(t, stream, 100); quote.Bid != 99.5 || quote.Ask != 100.5 || quote.Volume != 12.5 {
+		t.Fatalf("unexpected streamed quote: %+v", quote)
+	}
+
+	// Once closed the stream disconnects and REST answers again
+	stream.Close()
+	waitForQuotePrice(t, stream, 1)
+}
+
+// waitForQuotePrice polls stream until it quotes XBT at price.
+func waitForQuotePrice(t *testing.T, stream *KrakenStream, price float64) *Quote {
+	t.Helper()
+	var quote *Quote
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		var err error
+		if quote, err = stream.Quote(context.Background(), "XBT"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if quote.Price == price {
+			return quote
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("expected a quote at %f, last price %f", price, quote.Price)
+	return nil
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"crypto-trader/store"
+)
+
+// LadderTier sells Fraction of a position once the price is Gain percent
+// above the entry price.
+type LadderTier struct {
+	Gain     float64 // percent above entry, e.g. 5
+	Fraction float64 // share of the position's entry quantity to sell, (0, 1]
+}
+
+// ExitLadder is a tiered take-profit rule, ported from crypto_sim.py's
+// sell_ladder. It runs alongside the entry strategy: while a position is
+// open, the lowest tier that has been reached and not yet sold triggers a
+// partial SELL. Only one tier fires per price, as in the original.
+type ExitLadder struct {
+	Tiers []LadderTier // ascending by Gain
+}
+
+// parseExitLadder parses tiers written as "gain:fraction,...", e.g.
+// "5:0.25,10:0.25,15:0.25,20:0.25". An empty string disables the ladder.
+func parseExitLadder(s string) (*ExitLadder, error) {
+	var tiers []LadderTier
+	seen := make(map[float64]bool)
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		g, f, ok := strings.Cut(part, ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid exit ladder tier %q, expected gain:fraction", part)
+		}
+		gain, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(g), "%"), 64)
+		if err != nil || gain <= 0 {
+			return nil, fmt.Errorf("invalid exit ladder gain %q", g)
+		}
+		fraction, err := strconv.ParseFloat(strings.TrimSpace(f), 64)
+		if err != nil || fraction <= 0 || fraction > 1 {
+			return nil, fmt.Errorf("invalid exit ladder fraction %q, expected (0, 1]", f)
+		}
+		if seen[gain] {
+			return nil, fmt.Errorf("exit ladder tier %v%% given twice", gain)
+		}
+		seen[gain] = true
+		tiers = append(tiers, LadderTier{Gain: gain, Fraction: fraction})
+	}
+	if len(tiers) == 0 {
+		return nil, nil
+	}
+	sort.Slice(tiers, func(i, j int) bool { return tiers[i].Gain < tiers[j].Gain })
+	return &ExitLadder{Tiers: tiers}, nil
+}
+
+// String renders the ladder in the form parseExitLadder accepts.
+func (l *ExitLadder) String() string {
+	var parts []string
+	for _, t := range l.Tiers {
+		parts = append(parts, strconv.FormatFloat(t.Gain, 'f', -1, 64)+":"+strconv.FormatFloat(t.Fraction, 'f', -1, 64))
+	}
+	return strings.Join(parts, ",")
+}
+
+// Next returns the lowest tier reached at price that is not in hit.
+func (l *ExitLadder) Next(entryPrice, price float64, hit map[float64]bool) (LadderTier, bool) {
+	if l == nil || entryPrice <= 0 {
+		return LadderTier{}, false
+	}
+	gain := (price - entryPrice) / entryPrice * 100
+	for _, t := range l.Tiers {
+		if gain >= t.Gain && !hit[t.Gain] {
+			return t, true
+		}
+	}
+	return LadderTier{}, false
+}
+
+// SellQuantity returns how much of a position that started at entryQty and
+// now holds held to sell for tier. Dust left by rounding is sold with it.
+func (t LadderTier) SellQuantity(entryQty, held float64) float64 {
+	qty := t.Fraction * entryQty
+	if qty >= held || held-qty < entryQty*1e-9 {
+		return held
+	}
+	return qty
+}
+
+// ladderSignal checks the paper position for symbol against the ladder and
+// returns a partial SELL signal for the next tier reached, or nil.
+func ladderSignal(st store.Store, ladder *ExitLadder, symbol string, price float64) (*TradingSignal, error) {
+	p, err := loadPaperPortfolio(st, symbol)
+	if err != nil {
+		return nil, err
+	}
+	if p.Quantity <= 0 || p.OpenedAt.IsZero() {
+		return nil, nil
+	}
+	hit, err := st.LadderHits(symbol, p.OpenedAt)
+	if err != nil {
+		return nil, err
+	}
+	tier, ok := ladder.Next(p.EntryPrice, price, hit)
+	if !ok {
+		return nil, nil
+	}
+	entryQty := p.EntryQuantity
+	if entryQty <= 0 {
+		entryQty = p.Quantity
+	}
+	qty := tier.SellQuantity(entryQty, p.Quantity)
+	signal := &TradingSignal{
+		Action:         "SELL",
+		Reason:         "exit_ladder",
+		CurrentPrice:   price,
+		Quantity:       qty,
+		ExitTier:       tier.Gain,
+		Recommendation: fmt.Sprintf("** SELL %.8f (+%v%% tier) **", qty, tier.Gain),
+	}
+	if qty >= p.Quantity {
+		signal.Quantity = 0 // the last tier closes the position
+	}
+	return signal, nil
+}
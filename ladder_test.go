@@ -0,0 +1,133 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"crypto-trader/store"
+)
+
+func TestParseExitLadder(t *testing.T) {
+	ladder, err := parseExitLadder("10:0.25, 5%:0.25,20:0.5")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := ladder.String(); got != "5:0.25,10:0.25,20:0.5" {
+		t.Fatalf("expected tiers sorted by gain, got %s", got)
+	}
+	if ladder, err := parseExitLadder(""); ladder != nil || err != nil {
+		t.Fatalf("expected empty ladder to be disabled, got %v, %v", ladder, err)
+	}
+	for _, bad := range []string{"5", "5:0", "5:1.5", "-5:0.5", "5:0.5,5:0.5"} {
+		if _, err := parseExitLadder(bad); err == nil {
+			t.Fatalf("expected error for %q", bad)
+		}
+	}
+}
+
+func TestExitLadder_NextFiresLowestUnsoldTier(t *testing.T) {
+	ladder, _ := parseExitLadder("5:0.25,10:0.25,15:0.25,20:0.25")
+	hit := map[float64]bool{}
+
+	if _, ok := ladder.Next(100, 104, hit); ok {
+		t.Fatalf("expected no tier below +5%%")
+	}
+	// A jump past several tiers sells one per price, lowest first
+	tier, ok := ladder.Next(100, 112, hit)
+	if !ok || tier.Gain != 5 {
+		t.Fatalf("expected the 5%% tier, got %+v", tier)
+	}
+	hit[tier.Gain] = true
+	if tier, _ = ladder.Next(100, 112, hit); tier.Gain != 10 {
+		t.Fatalf("expected the 10%% tier, got %+v", tier)
+	}
+
+	if got := (LadderTier{Fraction: 0.25}).SellQuantity(4, 1.0000000001); got != 1.0000000001 {
+		t.Fatalf("expected rounding dust to be sold, got %v", got)
+	}
+	if got := (LadderTier{Fraction: 0.25}).SellQuantity(4, 3); got != 1 {
+		t.Fatalf("expected a quarter of the entry quantity, got %v", got)
+	}
+}
+
+func TestLadderSignal_SellsEachTierOncePerPosition(t *testing.T) {
+	db := openMigratedTestDB(t)
+	db.Exec(`INSERT INTO settings (initial_funds, transaction_fee_rate) VALUES (1000, 0)`)
+	ladder, _ := parseExitLadder("5:0.5,10:0.5")
+	ts := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	if _, _, err := paperTrade(store.New(db), "XBT", &TradingSignal{Action: "BUY", CurrentPrice: 100}, 0, ts, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	signal, err := ladderSignal(store.New(db), ladder, "XBT", 106)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if signal == nil || signal.Action != "SELL" || signal.Quantity != 5 || signal.ExitTier != 5 {
+		t.Fatalf("expected a partial SELL of 5 at the 5%% tier, got %+v", signal)
+	}
+	fill, p, err := paperTrade(store.New(db), "XBT", signal, 0, ts.Add(time.Hour), nil)
+	if err != nil || fill == nil || fill.Quantity != 5 || p.Quantity != 5 || p.EntryQuantity != 10 {
+		t.Fatalf("unexpected partial sell: %+v, %+v, %v", fill, p, err)
+	}
+
+	// The 5% tier has been sold for this position
+	if signal, _ := ladderSignal(store.New(db), ladder, "XBT", 107); signal != nil {
+		t.Fatalf("expected no signal once the tier is sold, got %+v", signal)
+	}
+	signal, _ = ladderSignal(store.New(db), ladder, "XBT", 111)
+	if signal == nil || signal.Quantity != 0 || signal.ExitTier != 10 {
+		t.Fatalf("expected the 10%% tier to close the position, got %+v", signal)
+	}
+	if _, p, _ = paperTrade(store.New(db), "XBT", signal, 0, ts.Add(2*time.Hour), nil); p.Quantity != 0 || !p.OpenedAt.IsZero() {
+		t.Fatalf("expected the position to be closed, got %+v", p)
+	}
+
+	// A new position starts with a fresh ladder
+	paperTrade(store.New(db), "XBT", &TradingSignal{Action: "BUY", CurrentPrice: 100}, 0, ts.Add(3*time.Hour), nil)
+	if signal, _ := ladderSignal(store.New(db), ladder, "XBT", 106); signal == nil || signal.ExitTier != 5 {
+		t.Fatalf("expected the 5%% tier to fire for the new position, got %+v", signal)
+	}
+}
+
+func TestPaperTrade_LadderSellRollsBackWithoutTierRecord(t *testing.T) {
+	db := openMigratedTestDB(t)
+	db.Exec(`INSERT INTO settings (initial_funds, transaction_fee_rate) VALUES (1000, 0)`)
+	ts := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	paperTrade(store.New(db), "XBT", &TradingSignal{Action: "BUY", CurrentPrice: 100}, 0, ts, nil)
+
+	// Without ladder_hits the tier cannot be recorded, so the sell must not stick
+	db.Exec(`DROP TABLE ladder_hits`)
+	signal := &TradingSignal{Action: "SELL", CurrentPrice: 106, Quantity: 5, ExitTier: 5}
+	if _, _, err := paperTrade(store.New(db), "XBT", signal, 0, ts.Add(time.Hour), nil); err == nil {
+		t.Fatalf("expected an error recording the tier")
+	}
+	p, err := loadPaperPortfolio(store.New(db), "XBT")
+	if err != nil || p.Quantity != 10 || p.Cash != 0 {
+		t.Fatalf("expected the position to be untouched, got %+v, %v", p, err)
+	}
+	if fills, _ := store.New(db).PaperFills("XBT", 10); len(fills) != 1 {
+		t.Fatalf("expected only the buy fill, got %d", len(fills))
+	}
+}
+
+func TestRunBacktest_ExitLadderSellsPartially(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	data := &backtestData{Start: start}
+	for i, p := range []float64{90, 100, 106, 111, 100} {
+		data.Prices = append(data.Prices, pricePoint{Time: start.Add(time.Duration(i) * time.Hour), Price: p})
+	}
+	ladder, _ := parseExitLadder("5:0.5,10:0.5")
+
+	// Buy at 90 only; the band never signals SELL below 200
+	result := runBacktest(&bandStrategy{Low: 95, High: 200}, "XBT", data, BacktestConfig{InitialFunds: 900, Ladder: ladder})
+	if len(result.Trades) != 1 || result.Trades[0].Open || result.Trades[0].Exits != 2 {
+		t.Fatalf("expected one trade closed by two ladder sells, got %+v", result.Trades)
+	}
+	// 10 units: 5 sold at 100 (+11%, the 5% tier), 5 at 106 (+17.8%, the 10% tier)
+	if want := 5*100.0 + 5*106.0; math.Abs(result.FinalEquity-want) > 1e-9 {
+		t.Fatalf("expected final equity %.2f, got %.2f", want, result.FinalEquity)
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"crypto-trader/store"
+)
+
+// LiveTrader mirrors paper fills as Kraken market orders, like
+// crypto_sim_actual_buys.py does for its simulated trades. In dry-run mode
+// orders are only validated by Kraken (or just logged without credentials).
+type LiveTrader struct {
+	Client *KrakenPrivateClient // nil in dry-run mode without credentials
+	Orders *OrderManager        // records and tracks orders; nil without Client
+	Risk   *RiskLimits          // pre-trade checks every order must pass
+	DryRun bool
+	st     store.Store
+}
+
+// configuredLiveTrader reads LIVE_TRADING (off, dry-run or on; default off)
+// and the KRAKEN_API_KEY / KRAKEN_API_SECRET credentials. It returns nil when
+// live trading is off. Orders are recorded in st and checked against the
+// configured risk limits.
+func configuredLiveTrader(st store.Store) (*LiveTrader, error) {
+	var dryRun bool
+	switch mode := strings.ToLower(strings.TrimSpace(os.Getenv("LIVE_TRADING"))); mode {
+	case "", "0", "false", "no", "off":
+		return nil, nil
+	case "dry-run", "dryrun", "validate":
+		dryRun = true
+	case "1", "true", "yes", "on":
+	default:
+		return nil, fmt.Errorf("invalid LIVE_TRADING %q, expected off, dry-run or on", mode)
+	}
+
+	risk, err := configuredRiskLimits()
+	if err != nil {
+		return nil, err
+	}
+	t := &LiveTrader{Risk: risk, DryRun: dryRun, st: st}
+
+	key, secret := os.Getenv("KRAKEN_API_KEY"), os.Getenv("KRAKEN_API_SECRET")
+	if dryRun && key == "" && secret == "" {
+		// No orders are recorded, so the trade rate is taken from the fills
+		risk.CountFills = true
+		return t, nil
+	}
+	if t.Client, err = NewKrakenPrivateClient(key, secret); err != nil {
+		return nil, err
+	}
+	t.Orders = newOrderManager(st, t.Client)
+	return t, nil
+}
+
+// Mode describes the trader for log lines.
+func (t *LiveTrader) Mode() string {
+	if t.DryRun {
+		return "dry-run"
+	}
+	return "live"
+}
+
+// orderForFill returns the market order that mirrors fill.
+func orderForFill(symbol string, fill *PaperFill) OrderRequest {
+	return OrderRequest{
+		Pair:      krakenTicker(symbol) + "USD",
+		Side:      strings.ToLower(fill.Side),
+		OrderType: "market",
+		Volume:    fill.Quantity,
+	}
+}
+
+// Check runs the risk limits on the order that would mirror fill. A failed
+// check is returned as a *RiskViolation. The collector checks a proposed
+// paper fill before storing it, so a blocked order is neither paper-traded
+// nor sent and the paper portfolio keeps matching the live account.
+func (t *LiveTrader) Check(symbol string, fill *PaperFill) error {
+	if t.Risk == nil {
+		return nil
+	}
+	v, err := t.Risk.Check(t.st, symbol, orderForFill(symbol, fill), fill.Price, time.Now())
+	if err != nil {
+		return fmt.Errorf("risk check: %w", err)
+	}
+	if v != nil {
+		return v
+	}
+	return nil
+}
+
+// Submit sends the order mirroring fill, which already passed Check, linked
+// to the signal that caused it. It returns a nil order when the order was
+// only logged.
+func (t *LiveTrader) Submit(ctx context.Context, symbol string, signalID int64, fill *PaperFill) (*Order, error) {
+	order := orderForFill(symbol, fill)
+	order.Validate = t.DryRun
+	if t.Orders == nil {
+		return nil, nil
+	}
+	return t.Orders.Submit(ctx, signalID, symbol, order)
+}
+
+// submitLiveOrder places the order mirroring fill and logs the outcome.
+func submitLiveOrder(t *LiveTrader, symbol string, signalID int64, fill *PaperFill) {
+	order := orderForFill(symbol, fill)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	o, err := t.Submit(ctx, symbol, signalID, fill)
+	cancel()
+	switch {
+	case err != nil:
+		fmt.Printf("Error placing %s %s order for %.8f %s: %v\n", t.Mode(), order.Side, order.Volume, order.Pair, err)
+	case o == nil:
+		fmt.Printf("Dry-run %s order: %.8f %s (no credentials, not sent)\n", order.Side, order.Volume, order.Pair)
+	case o.Status == OrderRejected:
+		fmt.Printf("Order %d rejected: %s %.8f %s: %s\n", o.ID, o.Side, o.Volume, o.Pair, o.Error)
+	case o.Status == OrderPending:
+		fmt.Printf("Order %d outcome unknown, will look it up at Kraken: %s %.8f %s: %s\n", o.ID, o.Side, o.Volume, o.Pair, o.Error)
+	case o.Status == OrderValidated:
+		fmt.Printf("Dry-run order %d validated by Kraken: %s %.8f %s\n", o.ID, o.Side, o.Volume, o.Pair)
+	default:
+		fmt.Printf("Live order %d placed: %s %.8f %s | txid: %s\n", o.ID, o.Side, o.Volume, o.Pair, o.TxID)
+	}
+}
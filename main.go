@@ -1,16 +1,22 @@
 package main
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"net/http"
 	"os"
 	"os/exec"
 	"runtime"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
 
+	"crypto-trader/indicators"
+	"crypto-trader/store"
+
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
 	"golang.org/x/text/message"
@@ -22,10 +28,40 @@ func main() {
 	// Load .env file if present
 	_ = godotenv.Load()
 
-	// Check if web server mode is requested
-	if len(os.Args) > 1 && os.Args[1] == "web" {
-		webServer()
-		return
+	// Check if web server mode or a subcommand is requested
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "web":
+			webServer()
+			return
+		case "backfill":
+			backfillCommand(os.Args[2:])
+			return
+		case "backtest":
+			backtestCommand(os.Args[2:])
+			return
+		case "optimize":
+			optimizeCommand(os.Args[2:])
+			return
+		case "walkforward":
+			walkForwardCommand(os.Args[2:])
+			return
+		case "killswitch":
+			killSwitchCommand(os.Args[2:])
+			return
+		case "fakeexchange":
+			fakeExchangeCommand(os.Args[2:])
+			return
+		case "migrate":
+			migrateCommand(os.Args[2:])
+			return
+		case "import":
+			importCommand(os.Args[2:])
+			return
+		case "retention":
+			retentionCommand(os.Args[2:])
+			return
+		}
 	}
 
 	// Run console mode
@@ -33,252 +69,369 @@ func main() {
 }
 
 func consoleMode() {
-	db, err := sql.Open("sqlite", "file:btc_prices.db?cache=shared&mode=rwc")
+	db, err := openDatabase()
 	if err != nil {
-		panic(err)
+		fmt.Println(err)
+		os.Exit(1)
 	}
 	defer db.Close()
 
-	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS btc_price (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		price REAL,
-		timestamp DATETIME
-	)`)
-	if err != nil {
-		panic(err)
+	runPriceCollection(db, true)
+}
+
+func runPriceCollection(db *sql.DB, showConsoleOutput bool) {
+	// Symbols to collect, e.g. TICKERS=BTC,ETH,LTC (defaults to XBT)
+	tickers := configuredTickers()
+
+	sleepSeconds := 60 // default
+	if val := os.Getenv("SLEEP_SECONDS"); val != "" {
+		if n, err := strconv.Atoi(val); err == nil && n > 0 {
+			sleepSeconds = n
+		}
 	}
 
-	// Create settings table
-	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS settings (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		initial_funds REAL DEFAULT 0,
-		transaction_fee_rate REAL DEFAULT 1.0,
-		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
-	)`)
+	st := store.New(db)
+	cfg := collectorConfig{showConsoleOutput: showConsoleOutput, paperTrading: paperTradingEnabled()}
+
+	// Trading strategy, e.g. STRATEGY=wma_crossover STRATEGY_PARAMS=fast=4h,slow=24h
+	strategy, err := configuredStrategy()
 	if err != nil {
 		panic(err)
 	}
+	cfg.strategy = strategy
 
-	// Create trading signals table
-	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS trading_signals (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		price_id INTEGER,
-		action TEXT,
-		price REAL,
-		timestamp DATETIME,
-		FOREIGN KEY(price_id) REFERENCES btc_price(id)
-	)`)
-	if err != nil {
+	// Take-profit ladder run alongside the strategy, e.g. EXIT_LADDER=5:0.25,10:0.25
+	if cfg.exitLadder, err = parseExitLadder(os.Getenv("EXIT_LADDER")); err != nil {
 		panic(err)
 	}
+	if cfg.exitLadder != nil && !cfg.paperTrading {
+		fmt.Println("EXIT_LADDER needs PAPER_TRADING to track positions; ignoring it")
+		cfg.exitLadder = nil
+	}
 
-	runPriceCollection(db, true)
-}
+	// Stop-loss, trailing-stop and max-hold exits, e.g. STOP_LOSS_PCT=5 MAX_HOLD=3d
+	if cfg.stopRules, err = configuredStopRules(); err != nil {
+		panic(err)
+	}
+	if cfg.stopRules != nil {
+		fmt.Println("Stop rules:", cfg.stopRules)
+	}
 
-func runPriceCollection(db *sql.DB, showConsoleOutput bool) {
-	ticker := os.Getenv("TICKER")
-	if ticker == "" {
-		ticker = "XBT" // Default to BTC (Kraken uses XBT for Bitcoin)
+	// Real orders mirroring the paper fills, e.g. LIVE_TRADING=dry-run
+	if cfg.liveTrader, err = configuredLiveTrader(st); err != nil {
+		panic(err)
+	}
+	if cfg.liveTrader != nil {
+		if !cfg.paperTrading {
+			panic("LIVE_TRADING sizes orders from the paper portfolio; set PAPER_TRADING=true")
+		}
+		fmt.Println("Kraken order placement enabled:", cfg.liveTrader.Mode())
+		if cfg.liveTrader.Orders != nil {
+			go cfg.liveTrader.Orders.Run(context.Background())
+		}
 	}
 
-	sleepSeconds := 60 // default
-	if val := os.Getenv("SLEEP_SECONDS"); val != "" {
+	// Read moving average days (console chart range) from .env
+	cfg.movingAvgDays = 1 // default to 1 day
+	if val := os.Getenv("MOVING_AVG_DAYS"); val != "" {
 		if n, err := strconv.Atoi(val); err == nil && n > 0 {
-			sleepSeconds = n
+			cfg.movingAvgDays = n
 		}
 	}
 
-	changeThreshold := 10.0 // default
-	if val := os.Getenv("CHANGE_THRESHOLD"); val != "" {
-		if n, err := strconv.ParseFloat(val, 64); err == nil {
-			changeThreshold = n
-		}
+	// Select the exchange adapter to poll (kraken, kraken-ws, coinbase)
+	source, err := newPriceSource(os.Getenv("PRICE_SOURCE"), db)
+	if err != nil {
+		panic(err)
 	}
 
-	// Read moving average days from .env
-	movingAvgDays := 1 // default to 1 day
-	if val := os.Getenv("MOVING_AVG_DAYS"); val != "" {
-		if n, err := strconv.Atoi(val); err == nil && n > 0 {
-			movingAvgDays = n
+	// Roll up any ticks collected before candle aggregation existed
+	for _, ticker := range tickers {
+		if n, err := catchUpCandles(st, ticker); err != nil {
+			fmt.Println("Error rolling up", ticker, "candles:", err)
+		} else if n > 0 {
+			fmt.Printf("Rolled %d %s ticks into candles\n", n, ticker)
 		}
 	}
 
+	// Delete old ticks and minute candles, e.g. RETENTION_RAW_DAYS=30
+	retention, err := configuredRetention()
+	if err != nil {
+		panic(err)
+	}
+	if interval, lookback := strategy.History(); retention.CandleDays > 0 && interval < 60 &&
+		time.Duration(retention.CandleDays)*24*time.Hour < lookback {
+		panic(fmt.Sprintf("RETENTION_CANDLE_DAYS=%d deletes the %dm candles the strategy needs for %s", retention.CandleDays, interval, formatWindow(lookback)))
+	}
+	if retention.Enabled() {
+		go retentionLoop(db, retention)
+	}
+
 	for {
-		price, usedURL, err := getBTCPrice(ticker)
-		if err != nil {
-			fmt.Println("Error fetching price:", err, "url:", usedURL)
-			time.Sleep(time.Duration(sleepSeconds) * time.Second)
-			continue
+		for _, ticker := range tickers {
+			collectPrice(st, source, ticker, cfg)
 		}
-		// price = 116438.805 // Uncomment this line to test with a fixed price
+		time.Sleep(time.Duration(sleepSeconds) * time.Second)
+	}
+}
 
-		result, err := db.Exec(`INSERT INTO btc_price (price, timestamp) VALUES (?, ?)`, price, time.Now().UTC())
-		if err != nil {
-			panic(err)
+// collectorConfig holds the collector settings read from the environment.
+type collectorConfig struct {
+	movingAvgDays     int
+	strategy          Strategy
+	showConsoleOutput bool
+	paperTrading      bool
+	exitLadder        *ExitLadder
+	stopRules         *StopRules
+	liveTrader        *LiveTrader
+}
+
+// collectPrice fetches and stores one price for ticker, then runs the trading
+// algorithm over that symbol's history. Errors are logged and the tick skipped.
+func collectPrice(st store.Store, source PriceSource, ticker string, cfg collectorConfig) {
+	movingAvgDays := cfg.movingAvgDays
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	quote, err := source.Quote(ctx, ticker)
+	cancel()
+	if err != nil {
+		fmt.Println("Error fetching", ticker, "price from", source.Name()+":", err)
+		return
+	}
+	price := quote.Price
+	// price = 116438.805 // Uncomment this line to test with a fixed price
+
+	collectedAt := time.Now().UTC()
+	priceID, err := st.InsertPrice(ticker, price, collectedAt)
+	if err != nil {
+		panic(err)
+	}
+
+	// Roll the tick into the 1m/5m/1h/1d candles
+	if err := st.RollUpTicks(store.Price{ID: priceID, Symbol: ticker, Price: price, Timestamp: collectedAt}); err != nil {
+		fmt.Println("Error updating candles for", ticker+":", err)
+	}
+
+	// Call the trading algorithm to analyze the price
+	signal, err := TradingAlgorithm(st, cfg.strategy, ticker, price)
+	if err != nil {
+		fmt.Println("Error running trading algorithm for", ticker+":", err)
+		return
+	}
+
+	// Stop rules close the open position unless the strategy is already selling
+	if cfg.stopRules != nil && signal.Action != "SELL" {
+		if exit, err := stopSignal(st, cfg.stopRules, ticker, price, collectedAt, cfg.paperTrading); err != nil {
+			fmt.Println("Error checking stop rules for", ticker+":", err)
+		} else if exit != nil {
+			exit.MovingAverage, exit.PercentChange = signal.MovingAverage, signal.PercentChange
+			exit.FastWMA, exit.SlowWMA = signal.FastWMA, signal.SlowWMA
+			signal = exit
+		}
+	}
+
+	// The exit ladder takes profit on the open position while the strategy holds
+	if cfg.exitLadder != nil && signal.Action == "HOLD" {
+		if exit, err := ladderSignal(st, cfg.exitLadder, ticker, price); err != nil {
+			fmt.Println("Error checking exit ladder for", ticker+":", err)
+		} else if exit != nil {
+			exit.MovingAverage, exit.PercentChange = signal.MovingAverage, signal.PercentChange
+			exit.FastWMA, exit.SlowWMA = signal.FastWMA, signal.SlowWMA
+			signal = exit
 		}
+	}
 
-		priceID, _ := result.LastInsertId()
+	// Entry price of the position a SELL closes, from the latest BUY signal
+	prevBuyPrice, err := latestBuyPrice(st, ticker)
+	if err != nil {
+		fmt.Println("Error loading last buy price for", ticker+":", err)
+	}
+	if prevBuyPrice == 0 {
+		prevBuyPrice, _ = strconv.ParseFloat(os.Getenv("PREVIOUS_BUY_PRICE"), 64)
+	}
 
-		// Call the trading algorithm to analyze the price
-		signal, err := TradingAlgorithm(db, price, movingAvgDays, changeThreshold)
+	// Record trading signal if action is BUY or SELL, and act on it in the
+	// paper portfolio
+	var portfolio *PaperPortfolio
+	if signal.Action == "BUY" || signal.Action == "SELL" {
+		signalID, err := st.InsertSignal(store.Signal{
+			PriceID:   priceID,
+			Symbol:    ticker,
+			Action:    signal.Action,
+			Reason:    signal.Reason,
+			Price:     price,
+			Quantity:  signal.Quantity,
+			Timestamp: time.Now().UTC(),
+		})
 		if err != nil {
-			fmt.Println("Error running trading algorithm:", err)
-			time.Sleep(time.Duration(sleepSeconds) * time.Second)
-			continue
+			fmt.Println("Error recording trading signal:", err)
 		}
 
-		// Record trading signal if action is BUY or SELL
-		if signal.Action == "BUY" || signal.Action == "SELL" {
-			_, err := db.Exec(`INSERT INTO trading_signals (price_id, action, price, timestamp) VALUES (?, ?, ?, ?)`,
-				priceID, signal.Action, price, time.Now().UTC())
-			if err != nil {
-				fmt.Println("Error recording trading signal:", err)
+		// The kill switch stops paper and live trading alike, so the live
+		// account keeps mirroring the paper portfolio
+		halt, err := st.TradingHalt()
+		if err != nil {
+			fmt.Println("Error reading kill switch, signal not acted on:", err)
+		} else if halt.Halted {
+			fmt.Printf("Trading halted (%s), %s signal not acted on\n", halt.Reason, signal.Action)
+			if err := st.RejectSignal(signalID, "kill_switch: "+halt.Reason); err != nil {
+				fmt.Println("Error recording rejected signal:", err)
+			}
+		} else if cfg.paperTrading {
+			// With live trading the risk limits vet the fill before it is
+			// paper-traded, so a blocked order is not traded on paper either
+			var check func(*PaperFill) error
+			if cfg.liveTrader != nil {
+				check = func(fill *PaperFill) error { return cfg.liveTrader.Check(ticker, fill) }
+			}
+			fill, p, err := paperTrade(st, ticker, signal, signalID, collectedAt, check)
+			var violation *RiskViolation
+			if errors.As(err, &violation) {
+				fmt.Printf("Order blocked, %s %s: %s\n", signal.Action, ticker, violation)
+				if err := st.RejectSignal(signalID, violation.Error()); err != nil {
+					fmt.Println("Error recording rejected signal:", err)
+				}
+			} else if err != nil {
+				fmt.Println("Error paper trading", ticker+":", err)
+			} else if fill != nil {
+				fmt.Printf("Paper %s %.8f %s at $%.2f (fee $%.2f), cash $%.2f\n",
+					fill.Side, fill.Quantity, ticker, fill.Price, fill.Fee, fill.Cash)
+				if cfg.liveTrader != nil {
+					submitLiveOrder(cfg.liveTrader, ticker, signalID, fill)
+				}
 			}
+			portfolio = p
 		}
+	}
+	if cfg.paperTrading && portfolio == nil {
+		if portfolio, err = loadPaperPortfolio(st, ticker); err != nil {
+			fmt.Println("Error loading paper portfolio for", ticker+":", err)
+		}
+	}
 
-		// Get current time for output in Eastern Time
-		loc, err := time.LoadLocation("America/New_York")
-		if err != nil {
-			panic(err)
-		}
-		currentTime := time.Now().In(loc).Format("2006-01-02 15:04:05 MST")
-
-		// Use signal data from algorithm
-		percentChange := signal.PercentChange
-		recommend := signal.Recommendation
-		avgNDays := sql.NullFloat64{Float64: signal.MovingAverage, Valid: signal.MovingAverage > 0}
-
-		if recommend == "** SELL **" {
-			beep()
-		}
-
-		prevBuyAmount, _ := strconv.ParseFloat(os.Getenv("PREVIOUS_BUY_AMOUNT"), 64)
-		prevBuyPrice, _ := strconv.ParseFloat(os.Getenv("PREVIOUS_BUY_PRICE"), 64)
-		transactionFeePct, _ := strconv.ParseFloat(os.Getenv("TRANSACTION_FEE_PCT"), 64)
-
-		prevValueUSD := prevBuyAmount * prevBuyPrice
-		transactionFeeUSD := prevValueUSD * (transactionFeePct / 100)
-		newValueUSD := (prevBuyAmount * price) - transactionFeeUSD
-		profitUSD := newValueUSD - prevValueUSD
-
-		if showConsoleOutput {
-			p := message.NewPrinter(message.MatchLanguage("en"))
-			line := "\u2500"
-			p.Println(strings.Repeat(line, 105))
-			p.Printf("%s - %s $%0.2f, %dd avg $%0.2f, diff %.2f%% %s\n",
-				currentTime,
-				ticker,
-				price,
-				movingAvgDays,
-				avgNDays.Float64,
-				percentChange,
-				recommend,
-			)
-			if recommend == "** SELL **" {
-				p.Printf("Amount %.10f, Buy Value: $%.4f, Transaction Fee: $%.4f, Sell Value: $%.4f, Profit: $%f\n",
-					prevBuyAmount,
-					prevValueUSD,
-					transactionFeeUSD,
-					newValueUSD,
-					profitUSD,
-				)
-			}
-			p.Println(strings.Repeat(line, 105))
+	// Get current time for output in Eastern Time
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		panic(err)
+	}
+	currentTime := time.Now().In(loc).Format("2006-01-02 15:04:05 MST")
 
-			circle := "\u2022"
-			fmt.Printf("Price: \x1b[37m%s\x1b[0m %dd MA: \x1b[32m%s\x1b[0m Both: \x1b[33m%s\x1b[0m",
-				circle, movingAvgDays, circle, circle,
+	// Use signal data from algorithm
+	percentChange := signal.PercentChange
+	recommend := signal.Recommendation
+
+	if strings.HasPrefix(recommend, "** SELL") {
+		beep()
+	}
+
+	prevBuyAmount, _ := strconv.ParseFloat(os.Getenv("PREVIOUS_BUY_AMOUNT"), 64)
+	transactionFeePct, _ := strconv.ParseFloat(os.Getenv("TRANSACTION_FEE_PCT"), 64)
+
+	prevValueUSD := prevBuyAmount * prevBuyPrice
+	transactionFeeUSD := prevValueUSD * (transactionFeePct / 100)
+	newValueUSD := (prevBuyAmount * price) - transactionFeeUSD
+	profitUSD := newValueUSD - prevValueUSD
+
+	if cfg.showConsoleOutput {
+		p := message.NewPrinter(message.MatchLanguage("en"))
+		line := "\u2500"
+		p.Println(strings.Repeat(line, 105))
+		p.Printf("%s - %s $%0.2f, %s(%s) avg $%0.2f, diff %.2f%% %s\n",
+			currentTime,
+			ticker,
+			price,
+			cfg.strategy.Name(),
+			formatStrategyParams(cfg.strategy.Params()),
+			signal.MovingAverage,
+			percentChange,
+			recommend,
+		)
+		if signal.Action == "SELL" {
+			p.Printf("Amount %.10f, Buy Value: $%.4f, Transaction Fee: $%.4f, Sell Value: $%.4f, Profit: $%f\n",
+				prevBuyAmount,
+				prevValueUSD,
+				transactionFeeUSD,
+				newValueUSD,
+				profitUSD,
 			)
+		}
+		if portfolio != nil {
+			pl, plPct := portfolio.ProfitLoss(price)
+			p.Printf("Paper portfolio: cash $%.2f, %.8f %s, value $%.2f, P/L $%.2f (%+.2f%%)\n",
+				portfolio.Cash, portfolio.Quantity, ticker, portfolio.Value(price), pl, plPct)
+		}
+		p.Println(strings.Repeat(line, 105))
 
-			// Inline chart display after price output
-			queryChart := fmt.Sprintf(`SELECT price, timestamp FROM btc_price WHERE timestamp >= datetime('now', '-%d day') ORDER BY timestamp`, movingAvgDays)
-			rows, err := db.Query(queryChart)
-			if err == nil {
-				defer rows.Close()
-				var prices []float64
-				for rows.Next() {
-					var p float64
-					var t string
-					if err := rows.Scan(&p, &t); err == nil {
-						prices = append(prices, p)
-					}
-				}
-				if len(prices) > 0 {
-					min, max := prices[0], prices[0]
-					high, low := prices[0], prices[0]
-					for _, p := range prices {
-						if p < min {
-							min = p
-						}
-						if p > max {
-							max = p
-						}
-						if p < low {
-							low = p
-						}
-						if p > high {
-							high = p
-						}
-					}
-					chartWidth := 100
-					chartHeight := 20
-					step := 1
-					if len(prices) > chartWidth {
-						step = len(prices) / chartWidth
+		circle := "\u2022"
+		fmt.Printf("Price: \x1b[37m%s\x1b[0m %dd MA: \x1b[32m%s\x1b[0m Both: \x1b[33m%s\x1b[0m",
+			circle, movingAvgDays, circle, circle,
+		)
+
+		// Inline chart display after price output
+		history, err := st.PricesSince(ticker, time.Now().AddDate(0, 0, -movingAvgDays))
+		if err == nil {
+			prices := make([]float64, len(history))
+			for i, h := range history {
+				prices[i] = h.Price
+			}
+			if len(prices) > 0 {
+				min, max := prices[0], prices[0]
+				high, low := prices[0], prices[0]
+				for _, p := range prices {
+					if p < min {
+						min = p
 					}
-					chartData := make([]float64, 0, chartWidth)
-					for i := 0; i < len(prices); i += step {
-						chartData = append(chartData, prices[i])
+					if p > max {
+						max = p
 					}
-					ma := make([]float64, len(prices))
-					window := 24 * 60 / step
-					if window < 1 {
-						window = 1
+					if p < low {
+						low = p
 					}
-					for i := range prices {
-						start := i - window + 1
-						if start < 0 {
-							start = 0
-						}
-						sum := 0.0
-						for j := start; j <= i; j++ {
-							sum += prices[j]
-						}
-						ma[i] = sum / float64(i-start+1)
+					if p > high {
+						high = p
 					}
-					maChartData := make([]float64, 0, chartWidth)
-					for i := 0; i < len(ma); i += step {
-						maChartData = append(maChartData, ma[i])
-					}
-					// Print chart to console
-					for y := chartHeight - 1; y >= 0; y-- {
-						for x := 0; x < len(chartData); x++ {
-							priceNorm := (chartData[x] - min) / (max - min)
-							priceLevel := int(priceNorm * float64(chartHeight-1))
-							maNorm := (maChartData[x] - min) / (max - min)
-							maLevel := int(maNorm * float64(chartHeight-1))
-							if priceLevel == y && maLevel == y {
-								p.Printf("\x1b[33m%s\x1b[0m", circle) // yellow
-							} else if priceLevel == y {
-								p.Printf("\x1b[37m%s\x1b[0m", circle) // white
-							} else if maLevel == y {
-								p.Printf("\x1b[32m%s\x1b[0m", line) // green
-							} else {
-								p.Print(" ")
-							}
+				}
+				chartWidth := 100
+				chartHeight := 20
+				step := 1
+				if len(prices) > chartWidth {
+					step = len(prices) / chartWidth
+				}
+				chartData := make([]float64, 0, chartWidth)
+				for i := 0; i < len(prices); i += step {
+					chartData = append(chartData, prices[i])
+				}
+				window := 24 * 60 / step
+				ma := indicators.SMASeries(prices, window)
+				maChartData := make([]float64, 0, chartWidth)
+				for i := 0; i < len(ma); i += step {
+					maChartData = append(maChartData, ma[i])
+				}
+				// Print chart to console
+				for y := chartHeight - 1; y >= 0; y-- {
+					for x := 0; x < len(chartData); x++ {
+						priceNorm := (chartData[x] - min) / (max - min)
+						priceLevel := int(priceNorm * float64(chartHeight-1))
+						maNorm := (maChartData[x] - min) / (max - min)
+						maLevel := int(maNorm * float64(chartHeight-1))
+						if priceLevel == y && maLevel == y {
+							p.Printf("\x1b[33m%s\x1b[0m", circle) // yellow
+						} else if priceLevel == y {
+							p.Printf("\x1b[37m%s\x1b[0m", circle) // white
+						} else if maLevel == y {
+							p.Printf("\x1b[32m%s\x1b[0m", line) // green
+						} else {
+							p.Print(" ")
 						}
-						fmt.Println()
 					}
-					p.Printf("\n")
+					fmt.Println()
 				}
+				p.Printf("\n")
 			}
-			p.Println(strings.Repeat(line, 105), "\n")
-		} else {
-			// Just log price collection for web mode
-			fmt.Printf("[%s] Price collected: $%.2f\n", time.Now().Format("15:04:05"), price)
 		}
-
-		time.Sleep(time.Duration(sleepSeconds) * time.Second)
+		p.Println(strings.Repeat(line, 105), "\n")
+	} else {
+		// Just log price collection for web mode
+		fmt.Printf("[%s] %s price collected: $%.2f\n", time.Now().Format("15:04:05"), ticker, price)
 	}
 }
 
@@ -290,82 +443,37 @@ func beep() {
 	}
 }
 
-func computeWMA(prices []float64, window int) []float64 {
-	n := len(prices)
-	if n == 0 {
-		return nil
-	}
-	if window < 1 {
-		window = 1
-	}
-	res := make([]float64, n)
-	for i := 0; i < n; i++ {
-		start := i - window + 1
-		if start < 0 {
-			start = 0
-		}
-		var weightedSum, sumWeights float64
-		for j := start; j <= i; j++ {
-			weight := float64(j - start + 1)
-			weightedSum += prices[j] * weight
-			sumWeights += weight
-		}
-		if sumWeights == 0 {
-			res[i] = prices[i]
-		} else {
-			res[i] = weightedSum / sumWeights
-		}
-	}
-	return res
-}
-
 func webServer() {
 	// Set Gin to release mode for production
 	gin.SetMode(gin.ReleaseMode)
 
-	// Open database connection
-	db, err := sql.Open("sqlite", "file:btc_prices.db?cache=shared&mode=rwc")
+	// Open the database, applying any pending migrations
+	db, err := openDatabase()
 	if err != nil {
-		panic(err)
+		fmt.Println(err)
+		os.Exit(1)
 	}
 	defer db.Close()
 
-	// Create table if not exists
-	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS btc_price (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		price REAL,
-		timestamp DATETIME
-	)`)
-	if err != nil {
-		panic(err)
-	}
+	// Start price collection in background
+	go runPriceCollection(db, false)
 
-	// Create settings table
-	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS settings (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		initial_funds REAL DEFAULT 0,
-		transaction_fee_rate REAL DEFAULT 1.0,
-		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
-	)`)
-	if err != nil {
-		panic(err)
-	}
+	router := newRouter(store.New(db), configuredTickers())
 
-	// Create trading signals table
-	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS trading_signals (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		price_id INTEGER,
-		action TEXT,
-		price REAL,
-		timestamp DATETIME,
-		FOREIGN KEY(price_id) REFERENCES btc_price(id)
-	)`)
-	if err != nil {
-		panic(err)
-	}
+	// Start the server on port 8080
+	fmt.Println("Starting web server on http://localhost:8080")
+	router.Run(":8080")
+}
 
-	// Start price collection in background
-	go runPriceCollection(db, false)
+// newRouter builds the web dashboard and API, reading and writing through st.
+func newRouter(st store.Store, tickers []string) *gin.Engine {
+	// API requests without a symbol parameter use the first configured ticker
+	symbolParam := func(c *gin.Context) string {
+		if symbol := normalizeSymbol(c.Query("symbol")); symbol != "" {
+			return symbol
+		}
+		return tickers[0]
+	}
 
 	// Create a new Gin router
 	router := gin.Default()
@@ -378,24 +486,58 @@ func webServer() {
 		c.HTML(http.StatusOK, "index.html", nil)
 	})
 
+	// API endpoint to list collected symbols
+	router.GET("/api/symbols", func(c *gin.Context) {
+		symbols := append([]string{}, tickers...)
+		collected, err := st.Symbols()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		for _, symbol := range collected {
+			known := false
+			for _, s := range symbols {
+				if s == symbol {
+					known = true
+					break
+				}
+			}
+			if !known {
+				symbols = append(symbols, symbol)
+			}
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"symbols": symbols,
+			"default": tickers[0],
+		})
+	})
+
 	// API endpoint to get historical price data
 	router.GET("/api/prices", func(c *gin.Context) {
+		symbol := symbolParam(c)
 		daysStr := c.DefaultQuery("days", "1")
 		daysInt, _ := strconv.Atoi(daysStr)
 		if daysInt < 1 {
 			daysInt = 1
 		}
 
-		query := fmt.Sprintf(`SELECT id, price, timestamp FROM btc_price WHERE timestamp >= datetime('now', '-%d day') ORDER BY timestamp`, daysInt)
-		rows, err := db.Query(query)
+		// Ranges over a day are served as candle closes rather than every tick
+		since := time.Now().AddDate(0, 0, -daysInt)
+		interval := chartInterval(daysInt)
+		var history []store.Price
+		var err error
+		if interval == 0 {
+			history, err = st.PricesSince(symbol, since)
+		} else {
+			history, err = chartPrices(st, symbol, interval, since)
+		}
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
-		defer rows.Close()
 
 		type PricePoint struct {
-			ID        int     `json:"id"`
+			ID        int64   `json:"id"`
 			Price     float64 `json:"price"`
 			Timestamp string  `json:"timestamp"`
 		}
@@ -407,123 +549,338 @@ func webServer() {
 		}
 
 		var prices []PricePoint
-		var rawPrices []float64
-		for rows.Next() {
-			var p PricePoint
-			if err := rows.Scan(&p.ID, &p.Price, &p.Timestamp); err == nil {
-				prices = append(prices, p)
-				rawPrices = append(rawPrices, p.Price)
-			}
+		var times []time.Time
+		for _, h := range history {
+			prices = append(prices, PricePoint{ID: h.ID, Price: h.Price, Timestamp: h.Timestamp.Format(time.RFC3339Nano)})
+			times = append(times, h.Timestamp)
 		}
 
 		// Fetch trading signals for the same time range
-		signalQuery := fmt.Sprintf(`SELECT ts.action, ts.price, ts.price_id FROM trading_signals ts 
-			WHERE ts.timestamp >= datetime('now', '-%d day') ORDER BY ts.timestamp`, daysInt)
-		signalRows, err := db.Query(signalQuery)
 		var signals []Signal
-		if err == nil {
-			defer signalRows.Close()
-			for signalRows.Next() {
-				var action string
-				var price float64
-				var priceID int
-				if err := signalRows.Scan(&action, &price, &priceID); err == nil {
-					// Find matching index in prices array by price ID
+		if recorded, err := st.SignalsSince(symbol, since); err == nil {
+			for _, s := range recorded {
+				// Find matching index in prices array by price ID, or the
+				// candle the signal fell in
+				index := -1
+				if interval == 0 {
 					for i, p := range prices {
-						if p.ID == priceID {
-							signals = append(signals, Signal{
-								Index:  i,
-								Action: action,
-								Price:  price,
-							})
+						if p.ID == s.PriceID {
+							index = i
 							break
 						}
 					}
+				} else {
+					index = sort.Search(len(times), func(i int) bool { return times[i].After(s.Timestamp) }) - 1
+				}
+				if index >= 0 {
+					signals = append(signals, Signal{
+						Index:  index,
+						Action: s.Action,
+						Price:  s.Price,
+					})
 				}
 			}
 		}
 
-		// Estimate samples per day from returned data so we can compute window sizes for day-based WMAs
-		samplesPerDay := 1.0
-		if len(rawPrices) > 0 {
-			samplesPerDay = float64(len(rawPrices)) / float64(daysInt)
-			if samplesPerDay < 1.0 {
-				samplesPerDay = 1.0
+		// WMAs use time-based windows over candles (loading one slow window of
+		// extra history) and are mapped back onto each price point by timestamp
+		fast, slow := configuredWindows()
+		candles, err := st.CandlesSince(symbol, barInterval(fast), since.Add(-slow))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		fastSeries := wmaSeries(candles, fast)
+		slowSeries := wmaSeries(candles, slow)
+
+		// Points before the first candle have no WMA and are sent as null
+		wma7 := make([]*float64, len(prices))
+		wma30 := make([]*float64, len(prices))
+		j := 0
+		for i, t := range times {
+			for j+1 < len(candles) && !candles[j+1].Time.After(t) {
+				j++
+			}
+			if len(candles) > 0 && !candles[j].Time.After(t) {
+				wma7[i] = &fastSeries[j]
+				wma30[i] = &slowSeries[j]
 			}
 		}
 
-		// Window sizes in samples for 7-day and 30-day WMAs
-		window7 := int(samplesPerDay * 7.0)
-		window30 := int(samplesPerDay * 30.0)
-		if window7 < 1 {
-			window7 = 1
+		c.JSON(http.StatusOK, gin.H{
+			"symbol":   symbol,
+			"interval": interval,
+			"prices":   prices,
+			"wma7":     wma7,
+			"wma30":    wma30,
+			"fast":     formatWindow(fast),
+			"slow":     formatWindow(slow),
+			"signals":  signals,
+		})
+	})
+
+	// API endpoint to get OHLC candles, e.g. /api/candles?interval=1h&days=7
+	router.GET("/api/candles", func(c *gin.Context) {
+		symbol := symbolParam(c)
+		interval, ok := intervalNames[c.DefaultQuery("interval", "1h")]
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "unsupported interval " + c.Query("interval")})
+			return
 		}
-		if window30 < 1 {
-			window30 = 1
+		daysInt, _ := strconv.Atoi(c.DefaultQuery("days", "1"))
+		if daysInt < 1 {
+			daysInt = 1
 		}
-		if window7 > len(rawPrices) {
-			window7 = len(rawPrices)
+
+		candles, err := st.CandlesSince(symbol, interval, time.Now().AddDate(0, 0, -daysInt))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
 		}
-		if window30 > len(rawPrices) {
-			window30 = len(rawPrices)
+		if candles == nil {
+			candles = []Candle{}
 		}
+		c.JSON(http.StatusOK, gin.H{
+			"symbol":   symbol,
+			"interval": interval,
+			"candles":  candles,
+		})
+	})
 
-		// Compute WMAs (arrays aligned with prices)
-		var wma7, wma30 []float64
-		if len(rawPrices) > 0 {
-			wma7 = computeWMA(rawPrices, window7)
-			wma30 = computeWMA(rawPrices, window30)
-		} else {
-			wma7 = []float64{}
-			wma30 = []float64{}
+	// API endpoint to compute a technical indicator over candles, e.g.
+	// /api/indicators?name=macd&params=fast=12,slow=26,signal=9&interval=1h&days=30
+	router.GET("/api/indicators", func(c *gin.Context) {
+		symbol := symbolParam(c)
+		name := c.Query("name")
+		if name == "" {
+			c.JSON(http.StatusOK, gin.H{"indicators": indicatorNames()})
+			return
+		}
+		params, err := parseStrategyParams(c.Query("params"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		interval, ok := intervalNames[c.DefaultQuery("interval", "1h")]
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "unsupported interval " + c.Query("interval")})
+			return
+		}
+		daysInt, _ := strconv.Atoi(c.DefaultQuery("days", "1"))
+		if daysInt < 1 {
+			daysInt = 1
+		}
+
+		// Load extra bars before the range so the indicator has warmed up
+		from := time.Now().AddDate(0, 0, -daysInt)
+		candles, err := st.CandlesSince(symbol, interval, from.Add(-100*time.Duration(interval)*time.Minute))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		series, resolved, err := computeIndicator(name, params, candles)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		// Trim the warm-up bars
+		skip := 0
+		for skip < len(candles) && candles[skip].Time.Before(from) {
+			skip++
+		}
+		times := make([]string, 0, len(candles)-skip)
+		for _, candle := range candles[skip:] {
+			times = append(times, candle.Time.Format(time.RFC3339))
+		}
+		for k, v := range series {
+			series[k] = v[skip:]
 		}
 
 		c.JSON(http.StatusOK, gin.H{
-			"prices":  prices,
-			"wma7":    wma7,
-			"wma30":   wma30,
-			"signals": signals,
+			"symbol":   symbol,
+			"name":     name,
+			"params":   resolved,
+			"interval": interval,
+			"overlay":  indicatorSpecs[name].overlay,
+			"times":    times,
+			"series":   series,
+		})
+	})
+
+	// API endpoint to list registered strategies and the configured one
+	router.GET("/api/strategies", func(c *gin.Context) {
+		configured, err := configuredStrategy()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"strategies": strategyNames(),
+			"configured": gin.H{
+				"name":   configured.Name(),
+				"params": configured.Params(),
+			},
+		})
+	})
+
+	// API endpoint to evaluate a strategy now, e.g.
+	// /api/signal?strategy=wma_crossover&params=fast=4h,slow=24h
+	router.GET("/api/signal", func(c *gin.Context) {
+		symbol := symbolParam(c)
+		strategy, err := configuredStrategy()
+		if name := c.Query("strategy"); name != "" {
+			var params map[string]string
+			params, err = parseStrategyParams(c.Query("params"))
+			if err == nil {
+				strategy, err = newStrategy(name, params)
+			}
+		}
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		latest, err := st.LatestPrice(symbol)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		signal, err := TradingAlgorithm(st, strategy, symbol, latest.Price)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"symbol":               symbol,
+			"strategy":             strategy.Name(),
+			"params":               strategy.Params(),
+			"action":               signal.Action,
+			"price":                signal.CurrentPrice,
+			"moving_average":       signal.MovingAverage,
+			"percent_change":       signal.PercentChange,
+			"recommendation":       signal.Recommendation,
+			"insufficient_history": signal.InsufficientHistory,
 		})
 	})
 
 	// API endpoint to get latest price
 	router.GET("/api/latest", func(c *gin.Context) {
-		row := db.QueryRow(`SELECT price, timestamp FROM btc_price ORDER BY id DESC LIMIT 1`)
-		var price float64
-		var timestamp string
-		if err := row.Scan(&price, &timestamp); err != nil {
+		symbol := symbolParam(c)
+		latest, err := st.LatestPrice(symbol)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"symbol":    symbol,
+			"price":     latest.Price,
+			"timestamp": latest.Timestamp,
+		})
+	})
+
+	// API endpoint for the paper-trading portfolio: balance, open position,
+	// value at the latest price and recent fills
+	router.GET("/api/portfolio", func(c *gin.Context) {
+		symbol := symbolParam(c)
+		portfolio, err := loadPaperPortfolio(st, symbol)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		latest, err := st.LatestPrice(symbol)
+		if err != nil && err != store.ErrNotFound {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		price := latest.Price
+		fills, err := st.PaperFills(symbol, 50)
+		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
+		pl, plPct := portfolio.ProfitLoss(price)
 		c.JSON(http.StatusOK, gin.H{
-			"price":     price,
-			"timestamp": timestamp,
+			"symbol":         symbol,
+			"enabled":        paperTradingEnabled(),
+			"initial_funds":  portfolio.InitialFunds,
+			"cash":           portfolio.Cash,
+			"quantity":       portfolio.Quantity,
+			"entry_price":    portfolio.EntryPrice,
+			"price":          price,
+			"value":          portfolio.Value(price),
+			"profit_loss":    pl,
+			"profit_percent": plPct,
+			"fee_rate":       portfolio.FeeRate,
+			"fills":          fills,
 		})
 	})
 
-	// API endpoint to get settings
+	// API endpoint to get the symbol's recent exchange orders
+	router.GET("/api/orders", func(c *gin.Context) {
+		symbol := symbolParam(c)
+		orders, err := st.RecentOrders(symbol, 50)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"symbol": symbol, "orders": orders})
+	})
+
+	// API endpoint to get settings. Settings saved for the symbol win over
+	// settings saved without one.
 	router.GET("/api/settings", func(c *gin.Context) {
-		row := db.QueryRow(`SELECT initial_funds, transaction_fee_rate FROM settings ORDER BY id DESC LIMIT 1`)
-		var initialFunds float64
-		var transactionFeeRate float64
-		if err := row.Scan(&initialFunds, &transactionFeeRate); err != nil {
-			if err == sql.ErrNoRows {
-				// No settings yet, return defaults
-				c.JSON(http.StatusOK, gin.H{
-					"initial_funds":        0,
-					"transaction_fee_rate": 1.0,
-				})
-				return
-			}
+		symbol := symbolParam(c)
+		settings, err := st.LatestSettings(symbol)
+		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
 		c.JSON(http.StatusOK, gin.H{
-			"initial_funds":        initialFunds,
-			"transaction_fee_rate": transactionFeeRate,
+			"symbol":               symbol,
+			"initial_funds":        settings.InitialFunds,
+			"transaction_fee_rate": settings.FeeRate,
 		})
 	})
 
+	// API endpoints to read and set the kill switch. Halting cancels open
+	// orders. The API is unauthenticated, so it can only halt: resuming is
+	// left to the killswitch -resume command.
+	router.GET("/api/killswitch", func(c *gin.Context) {
+		halt, err := st.TradingHalt()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, halt)
+	})
+
+	router.POST("/api/killswitch", func(c *gin.Context) {
+		var input struct {
+			Halted bool   `json:"halted"`
+			Reason string `json:"reason"`
+		}
+		if err := c.BindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if !input.Halted {
+			c.JSON(http.StatusForbidden, gin.H{"error": "resume trading with the killswitch -resume command"})
+			return
+		}
+
+		orders, err := killSwitchOrders(st)
+		if err != nil {
+			fmt.Println("Open orders cannot be cancelled:", err)
+		}
+		cancelled, err := haltTrading(c.Request.Context(), st, orders, input.Reason)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "cancelled": cancelled})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"halted": true, "cancelled": cancelled})
+	})
+
 	// API endpoint to save settings
 	router.POST("/api/settings", func(c *gin.Context) {
 		var input struct {
@@ -535,9 +892,13 @@ func webServer() {
 			return
 		}
 
-		// Insert new settings record
-		_, err := db.Exec(`INSERT INTO settings (initial_funds, transaction_fee_rate, updated_at) VALUES (?, ?, ?)`,
-			input.InitialFunds, input.TransactionFeeRate, time.Now().UTC())
+		// Insert new settings record; an empty symbol applies to every symbol
+		symbol := normalizeSymbol(c.Query("symbol"))
+		err := st.SaveSettings(store.Settings{
+			Symbol:       symbol,
+			InitialFunds: input.InitialFunds,
+			FeeRate:      input.TransactionFeeRate,
+		})
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
@@ -545,12 +906,11 @@ func webServer() {
 
 		c.JSON(http.StatusOK, gin.H{
 			"message":              "Settings saved successfully",
+			"symbol":               symbol,
 			"initial_funds":        input.InitialFunds,
 			"transaction_fee_rate": input.TransactionFeeRate,
 		})
 	})
 
-	// Start the server on port 8080
-	fmt.Println("Starting web server on http://localhost:8080")
-	router.Run(":8080")
+	return router
 }
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"crypto-trader/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+// serveTestRouter sends a request to a router backed by st and decodes the
+// JSON response.
+func serveTestRouter(t *testing.T, st store.Store, method, target, body string) (int, map[string]interface{}) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	router := newRouter(st, []string{"XBT"})
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	var out map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &out); err != nil {
+		t.Fatalf("invalid JSON response %q: %v", rec.Body.String(), err)
+	}
+	return rec.Code, out
+}
+
+func TestRouter_LatestPrice(t *testing.T) {
+	st := store.NewMemory()
+	if code, _ := serveTestRouter(t, st, http.MethodGet, "/api/latest", ""); code != http.StatusInternalServerError {
+		t.Fatalf("expected 500 without prices, got %d", code)
+	}
+	st.InsertPrice("XBT", 65000, time.Now())
+	st.InsertPrice("ETH", 3000, time.Now())
+
+	code, out := serveTestRouter(t, st, http.MethodGet, "/api/latest?symbol=ETH", "")
+	if code != http.StatusOK || out["price"] != 3000.0 || out["symbol"] != "ETH" {
+		t.Fatalf("expected ETH at 3000, got %d %v", code, out)
+	}
+}
+
+func TestRouter_Settings(t *testing.T) {
+	st := store.NewMemory()
+	_, out := serveTestRouter(t, st, http.MethodGet, "/api/settings", "")
+	if out["initial_funds"] != 0.0 || out["transaction_fee_rate"] != 1.0 {
+		t.Fatalf("expected default settings, got %v", out)
+	}
+
+	code, _ := serveTestRouter(t, st, http.MethodPost, "/api/settings?symbol=BTC", `{"initial_funds": 1000, "transaction_fee_rate": 0.25}`)
+	if code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+	_, out = serveTestRouter(t, st, http.MethodGet, "/api/settings?symbol=XBT", "")
+	if out["initial_funds"] != 1000.0 || out["transaction_fee_rate"] != 0.25 {
+		t.Fatalf("expected the saved XBT settings, got %v", out)
+	}
+}
+
+func TestRouter_PricesWithSignals(t *testing.T) {
+	st := store.NewMemory()
+	now := time.Now().UTC()
+	st.InsertPrice("XBT", 100, now.Add(-2*time.Hour))
+	id, _ := st.InsertPrice("XBT", 101, now.Add(-time.Hour))
+	st.InsertPrice("XBT", 90, now.AddDate(0, 0, -3)) // outside the default 1 day
+	st.InsertSignal(store.Signal{PriceID: id, Symbol: "XBT", Action: "BUY", Price: 101, Timestamp: now.Add(-time.Hour)})
+
+	code, out := serveTestRouter(t, st, http.MethodGet, "/api/prices", "")
+	if code != http.StatusOK {
+		t.Fatalf("expected 200, got %d %v", code, out)
+	}
+	prices, _ := out["prices"].([]interface{})
+	signals, _ := out["signals"].([]interface{})
+	if len(prices) != 2 || len(signals) != 1 {
+		t.Fatalf("expected 2 prices and 1 signal, got %v", out)
+	}
+	if signal := signals[0].(map[string]interface{}); signal["index"] != 1.0 || signal["action"] != "BUY" {
+		t.Fatalf("expected the BUY on the second price, got %v", signal)
+	}
+}
+
+func TestRouter_PricesDownsampled(t *testing.T) {
+	st := store.NewMemory()
+	now := time.Now().UTC().Truncate(time.Hour)
+	for i := 0; i < 48; i++ {
+		st.AddCandles(store.Candle{Symbol: "XBT", Interval: 60, Time: now.Add(time.Duration(i-48) * time.Hour), Close: float64(100 + i)})
+	}
+	for i := 0; i < 100; i++ {
+		st.InsertPrice("XBT", 200, now.Add(time.Duration(i-100)*time.Minute))
+	}
+	st.InsertSignal(store.Signal{Symbol: "XBT", Action: "BUY", Price: 110, Timestamp: now.Add(-37*time.Hour - 30*time.Minute)})
+
+	code, out := serveTestRouter(t, st, http.MethodGet, "/api/prices?days=30", "")
+	if code != http.StatusOK || out["interval"] != 60.0 {
+		t.Fatalf("expected hourly prices, got %d %v", code, out["interval"])
+	}
+	prices, _ := out["prices"].([]interface{})
+	signals, _ := out["signals"].([]interface{})
+	if len(prices) != 49 || len(signals) != 1 {
+		t.Fatalf("expected 48 candles and the latest tick with 1 signal, got %d prices, %v", len(prices), signals)
+	}
+	if signal := signals[0].(map[string]interface{}); signal["index"] != 10.0 {
+		t.Fatalf("expected the BUY on its hourly candle, got %v", signal)
+	}
+}
+
+func TestRouter_Portfolio(t *testing.T) {
+	st := store.NewMemory()
+	opened := time.Now().UTC().Add(-time.Hour)
+	st.SaveSettings(store.Settings{InitialFunds: 1000, FeeRate: 0.1})
+	st.SetPaperAccount(store.PaperAccount{Symbol: "XBT", InitialFunds: 1000, Traded: true, Quantity: 10, EntryPrice: 100, EntryQuantity: 10, OpenedAt: opened})
+	st.AddPaperFills(store.PaperFill{Symbol: "XBT", Side: "BUY", Price: 100, Quantity: 10, Fee: 1, Holdings: 10, Timestamp: opened})
+	st.InsertPrice("XBT", 110, time.Now())
+
+	code, out := serveTestRouter(t, st, http.MethodGet, "/api/portfolio", "")
+	if code != http.StatusOK || out["value"] != 1100.0 || out["profit_loss"] != 100.0 {
+		t.Fatalf("expected $1100 with a $100 gain, got %d %v", code, out)
+	}
+	if fills, _ := out["fills"].([]interface{}); len(fills) != 1 {
+		t.Fatalf("expected 1 fill, got %v", out["fills"])
+	}
+
+	// ETH has not traded, so it starts from the settings
+	if _, out = serveTestRouter(t, st, http.MethodGet, "/api/portfolio?symbol=ETH", ""); out["cash"] != 1000.0 {
+		t.Fatalf("expected ETH to start with $1000, got %v", out)
+	}
+}
+
+func TestRouter_KillSwitch(t *testing.T) {
+	t.Setenv("KRAKEN_API_KEY", "")
+	t.Setenv("KRAKEN_API_SECRET", "")
+	st := store.NewMemory()
+
+	code, out := serveTestRouter(t, st, http.MethodPost, "/api/killswitch", `{"halted": true, "reason": "maintenance"}`)
+	if code != http.StatusOK || out["halted"] != true || out["cancelled"] != 0.0 {
+		t.Fatalf("expected trading halted, got %d %v", code, out)
+	}
+	if _, out = serveTestRouter(t, st, http.MethodGet, "/api/killswitch", ""); out["halted"] != true || out["reason"] != "maintenance" {
+		t.Fatalf("expected the halt reported, got %v", out)
+	}
+	// Resuming is left to the CLI
+	if code, _ = serveTestRouter(t, st, http.MethodPost, "/api/killswitch", `{"halted": false}`); code != http.StatusForbidden {
+		t.Fatalf("expected resume to be refused, got %d", code)
+	}
+	if halt, _ := st.TradingHalt(); !halt.Halted {
+		t.Fatalf("expected trading to stay halted, got %+v", halt)
+	}
+}
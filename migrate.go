@@ -0,0 +1,338 @@
+package main
+
+import (
+	"database/sql"
+	"embed"
+	"flag"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"crypto-trader/store"
+)
+
+// migrationFiles holds the schema migrations for each dialect, in
+// migrations/<dialect>/, named NNNN_name.up.sql with an optional
+// NNNN_name.down.sql. A migration without a down file cannot be reverted.
+// Both dialects carry the same versions.
+//
+//go:embed migrations/sqlite/*.sql migrations/postgres/*.sql
+var migrationFiles embed.FS
+
+// migration is one versioned schema change.
+type migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string // empty when irreversible
+}
+
+// loadMigrations returns the embedded migrations for dialect in version order.
+func loadMigrations(dialect store.Dialect) ([]migration, error) {
+	dir := path.Join("migrations", string(dialect))
+	entries, err := migrationFiles.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	byVersion := make(map[int]*migration)
+	for _, e := range entries {
+		file := e.Name()
+		base, direction, ok := strings.Cut(strings.TrimSuffix(file, ".sql"), ".")
+		num, name, ok2 := strings.Cut(base, "_")
+		version, err := strconv.Atoi(num)
+		if !ok || !ok2 || err != nil || version < 1 || (direction != "up" && direction != "down") {
+			return nil, fmt.Errorf("invalid migration file name %q", file)
+		}
+		body, err := migrationFiles.ReadFile(path.Join(dir, file))
+		if err != nil {
+			return nil, err
+		}
+		m := byVersion[version]
+		if m == nil {
+			m = &migration{Version: version, Name: name}
+			byVersion[version] = m
+		}
+		if m.Name != name {
+			return nil, fmt.Errorf("migration %d has two names: %s and %s", version, m.Name, name)
+		}
+		if direction == "up" {
+			m.Up = string(body)
+		} else {
+			m.Down = string(body)
+		}
+	}
+
+	var migrations []migration
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("migration %d_%s has no up file", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	for i, m := range migrations {
+		if m.Version != i+1 {
+			return nil, fmt.Errorf("migration versions must run 1..n, found %d at position %d", m.Version, i+1)
+		}
+	}
+	return migrations, nil
+}
+
+// createSchemaVersionTable creates schema_version, which records every
+// applied migration.
+func createSchemaVersionTable(db *sql.DB) error {
+	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS schema_version (
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at TIMESTAMP
+	)`)
+	return err
+}
+
+// schemaVersion returns the latest migration applied to db, 0 for none.
+func schemaVersion(db *sql.DB) (int, error) {
+	if err := createSchemaVersionTable(db); err != nil {
+		return 0, err
+	}
+	var version int
+	err := db.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_version`).Scan(&version)
+	return version, err
+}
+
+// tableExists reports whether db has a table named table.
+func tableExists(db *sql.DB, table string) (bool, error) {
+	var n int
+	err := db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?`, table).Scan(&n)
+	return n > 0, err
+}
+
+// adoptLegacySchema adds the columns that tables created before migrations
+// existed may lack, so the baseline migration can be applied over them.
+func adoptLegacySchema(db *sql.DB) error {
+	if err := ensureSymbolColumns(db); err != nil {
+		return err
+	}
+	for _, c := range []struct{ table, column, def string }{
+		{"trading_signals", "quantity", "REAL NOT NULL DEFAULT 0"},
+		{"trading_signals", "reason", "TEXT NOT NULL DEFAULT 'strategy'"},
+		{"trading_signals", "rejection", "TEXT NOT NULL DEFAULT ''"},
+		{"paper_positions", "entry_quantity", "REAL NOT NULL DEFAULT 0"},
+	} {
+		exists, err := tableExists(db, c.table)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			continue
+		}
+		if err := ensureColumn(db, c.table, c.column, c.def); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrateUp applies the migrations after db's current version up to target
+// (0 for the latest), each in its own transaction. It returns the
+// migrations applied.
+func migrateUp(db *sql.DB, target int) ([]migration, error) {
+	dialect := store.DialectOf(db)
+	migrations, err := loadMigrations(dialect)
+	if err != nil {
+		return nil, err
+	}
+	current, err := schemaVersion(db)
+	if err != nil {
+		return nil, err
+	}
+	if target == 0 {
+		target = len(migrations)
+	}
+	if current > len(migrations) {
+		return nil, fmt.Errorf("database schema version %d is newer than this build supports (%d); upgrade crypto-trader", current, len(migrations))
+	}
+	if target > len(migrations) {
+		return nil, fmt.Errorf("no migration %d (latest is %d)", target, len(migrations))
+	}
+
+	// SQLite databases from before migrations have btc_price but no
+	// recorded version
+	if current == 0 && dialect == store.SQLite {
+		legacy, err := tableExists(db, "btc_price")
+		if err != nil {
+			return nil, err
+		}
+		if legacy {
+			if err := adoptLegacySchema(db); err != nil {
+				return nil, fmt.Errorf("failed to adopt existing schema: %w", err)
+			}
+		}
+	}
+
+	var applied []migration
+	for _, m := range migrations[current:target] {
+		if err := runMigration(db, m.Version, m.Name, m.Up, true); err != nil {
+			return applied, fmt.Errorf("migration %d_%s: %w", m.Version, m.Name, err)
+		}
+		applied = append(applied, m)
+	}
+	return applied, nil
+}
+
+// migrateDown reverts the latest steps migrations, newest first. It stops
+// at a migration without a down file.
+func migrateDown(db *sql.DB, steps int) ([]migration, error) {
+	migrations, err := loadMigrations(store.DialectOf(db))
+	if err != nil {
+		return nil, err
+	}
+	current, err := schemaVersion(db)
+	if err != nil {
+		return nil, err
+	}
+	if current > len(migrations) {
+		return nil, fmt.Errorf("database schema version %d is newer than this build supports (%d); upgrade crypto-trader", current, len(migrations))
+	}
+
+	var reverted []migration
+	for v := current; v > 0 && len(reverted) < steps; v-- {
+		m := migrations[v-1]
+		if m.Down == "" {
+			return reverted, fmt.Errorf("migration %d_%s cannot be reverted", m.Version, m.Name)
+		}
+		if err := runMigration(db, m.Version, m.Name, m.Down, false); err != nil {
+			return reverted, fmt.Errorf("reverting migration %d_%s: %w", m.Version, m.Name, err)
+		}
+		reverted = append(reverted, m)
+	}
+	return reverted, nil
+}
+
+// runMigration executes script and records (up) or forgets (down) version
+// in one transaction.
+func runMigration(db *sql.DB, version int, name, script string, up bool) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(script); err != nil {
+		return err
+	}
+	if up {
+		_, err = tx.Exec(`INSERT INTO schema_version (version, name, applied_at) VALUES (?, ?, ?)`, version, name, time.Now().UTC())
+	} else {
+		_, err = tx.Exec(`DELETE FROM schema_version WHERE version = ?`, version)
+	}
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// openDatabase opens DATABASE_URL (btc_prices.db when unset) and applies any
+// pending migrations. It refuses a database migrated by a newer build. On
+// PostgreSQL with TIMESCALE=true, btc_price is made a TimescaleDB hypertable.
+func openDatabase() (*sql.DB, error) {
+	db, err := store.Open(os.Getenv("DATABASE_URL"))
+	if err != nil {
+		return nil, err
+	}
+	applied, err := migrateUp(db, 0)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	for _, m := range applied {
+		fmt.Printf("Applied migration %d_%s\n", m.Version, m.Name)
+	}
+	if os.Getenv("TIMESCALE") == "true" && store.DialectOf(db) == store.Postgres {
+		if err := enableTimescale(db); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("failed to enable TimescaleDB: %w", err)
+		}
+	}
+	return db, nil
+}
+
+// enableTimescale turns btc_price into a hypertable partitioned on
+// timestamp. It is safe to call on every start.
+func enableTimescale(db *sql.DB) error {
+	if _, err := db.Exec(`CREATE EXTENSION IF NOT EXISTS timescaledb`); err != nil {
+		return err
+	}
+	_, err := db.Exec(`SELECT create_hypertable('btc_price', 'timestamp', if_not_exists => TRUE, migrate_data => TRUE)`)
+	return err
+}
+
+// migrateCommand shows or changes the schema version: status (default),
+// up [-to N] or down [-steps N].
+func migrateCommand(args []string) {
+	action := "status"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		action, args = args[0], args[1:]
+	}
+	fs := flag.NewFlagSet("migrate "+action, flag.ExitOnError)
+	to := fs.Int("to", 0, "Version to migrate up to (default: latest)")
+	steps := fs.Int("steps", 1, "Number of migrations to revert")
+	fs.Parse(args)
+
+	db, err := store.Open(os.Getenv("DATABASE_URL"))
+	if err != nil {
+		panic(err)
+	}
+	defer db.Close()
+
+	switch action {
+	case "status":
+		migrations, err := loadMigrations(store.DialectOf(db))
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		current, err := schemaVersion(db)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		fmt.Printf("Schema version %d, latest %d\n", current, len(migrations))
+		for _, m := range migrations {
+			state := "pending"
+			if m.Version <= current {
+				state = "applied"
+			}
+			fmt.Printf("  %04d_%-30s %s\n", m.Version, m.Name, state)
+		}
+		if current > len(migrations) {
+			fmt.Println("The database was migrated by a newer build")
+		}
+	case "up":
+		applied, err := migrateUp(db, *to)
+		for _, m := range applied {
+			fmt.Printf("Applied migration %d_%s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		if len(applied) == 0 {
+			fmt.Println("Schema is up to date")
+		}
+	case "down":
+		reverted, err := migrateDown(db, *steps)
+		for _, m := range reverted {
+			fmt.Printf("Reverted migration %d_%s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	default:
+		fmt.Printf("unknown migrate action %q, expected status, up or down\n", action)
+		os.Exit(1)
+	}
+}
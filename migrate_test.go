@@ -0,0 +1,129 @@
+package main
+
+import (
+	"database/sql"
+	"strings"
+	"testing"
+
+	"crypto-trader/store"
+)
+
+// openMigratedTestDB returns an in-memory database at the latest schema.
+func openMigratedTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db := openTestDB(t)
+	if _, err := migrateUp(db, 0); err != nil {
+		t.Fatalf("migration failed: %v", err)
+	}
+	return db
+}
+
+func TestLoadMigrations_Ordered(t *testing.T) {
+	migrations, err := loadMigrations(store.SQLite)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(migrations) < 2 || migrations[0].Name != "baseline" || migrations[0].Down != "" {
+		t.Fatalf("expected an irreversible baseline first, got %+v", migrations[0])
+	}
+	for i, m := range migrations {
+		if m.Version != i+1 {
+			t.Fatalf("expected version %d, got %d", i+1, m.Version)
+		}
+	}
+}
+
+func TestLoadMigrations_DialectsMatch(t *testing.T) {
+	sqlite, _ := loadMigrations(store.SQLite)
+	postgres, err := loadMigrations(store.Postgres)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(postgres) != len(sqlite) {
+		t.Fatalf("expected %d postgres migrations, got %d", len(sqlite), len(postgres))
+	}
+	for i, m := range postgres {
+		if m.Name != sqlite[i].Name || (m.Down == "") != (sqlite[i].Down == "") {
+			t.Fatalf("expected postgres migration %d to match %s, got %s", m.Version, sqlite[i].Name, m.Name)
+		}
+	}
+}
+
+func TestMigrateUp_FreshDatabase(t *testing.T) {
+	db := openTestDB(t)
+	applied, err := migrateUp(db, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	migrations, _ := loadMigrations(store.SQLite)
+	if len(applied) != len(migrations) {
+		t.Fatalf("expected %d migrations applied, got %d", len(migrations), len(applied))
+	}
+	if v, _ := schemaVersion(db); v != len(migrations) {
+		t.Fatalf("expected version %d, got %d", len(migrations), v)
+	}
+	if again, err := migrateUp(db, 0); err != nil || len(again) != 0 {
+		t.Fatalf("expected nothing to apply, got %d, %v", len(again), err)
+	}
+}
+
+func TestMigrateUp_AdoptsLegacyDatabase(t *testing.T) {
+	db := openTestDB(t)
+	for _, ddl := range []string{
+		`CREATE TABLE btc_price (id INTEGER PRIMARY KEY AUTOINCREMENT, price REAL, timestamp DATETIME)`,
+		`CREATE TABLE settings (id INTEGER PRIMARY KEY AUTOINCREMENT, initial_funds REAL DEFAULT 0, transaction_fee_rate REAL DEFAULT 1.0, updated_at DATETIME DEFAULT CURRENT_TIMESTAMP)`,
+		`CREATE TABLE trading_signals (id INTEGER PRIMARY KEY AUTOINCREMENT, price_id INTEGER, action TEXT, price REAL, timestamp DATETIME)`,
+		`INSERT INTO btc_price (price, timestamp) VALUES (65000, '2024-01-01 00:00:00')`,
+	} {
+		if _, err := db.Exec(ddl); err != nil {
+			t.Fatalf("setup failed: %v", err)
+		}
+	}
+
+	if _, err := migrateUp(db, 0); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, c := range []struct{ table, column string }{
+		{"btc_price", "symbol"},
+		{"trading_signals", "reason"},
+		{"trading_signals", "rejection"},
+		{"paper_positions", "entry_quantity"},
+	} {
+		if has, _ := hasColumn(db, c.table, c.column); !has {
+			t.Fatalf("expected %s.%s after adoption", c.table, c.column)
+		}
+	}
+	var symbol string
+	if err := db.QueryRow(`SELECT symbol FROM btc_price`).Scan(&symbol); err != nil || symbol != "XBT" {
+		t.Fatalf("expected the existing price kept as XBT, got %q, %v", symbol, err)
+	}
+}
+
+func TestMigrateUp_RefusesNewerSchema(t *testing.T) {
+	db := openMigratedTestDB(t)
+	if _, err := db.Exec(`INSERT INTO schema_version (version, name) VALUES (999, 'future')`); err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+	if _, err := migrateUp(db, 0); err == nil || !strings.Contains(err.Error(), "newer") {
+		t.Fatalf("expected a newer schema error, got %v", err)
+	}
+}
+
+func TestMigrateDown_StopsAtIrreversibleBaseline(t *testing.T) {
+	db := openMigratedTestDB(t)
+	migrations, _ := loadMigrations(store.SQLite)
+
+	reverted, err := migrateDown(db, len(migrations))
+	if err == nil || !strings.Contains(err.Error(), "cannot be reverted") {
+		t.Fatalf("expected the baseline to be irreversible, got %v", err)
+	}
+	if len(reverted) != len(migrations)-1 {
+		t.Fatalf("expected %d migrations reverted, got %d", len(migrations)-1, len(reverted))
+	}
+	if v, _ := schemaVersion(db); v != 1 {
+		t.Fatalf("expected version 1, got %d", v)
+	}
+	if _, err := migrateUp(db, 0); err != nil {
+		t.Fatalf("expected migrations to re-apply, got %v", err)
+	}
+}
@@ -0,0 +1,135 @@
+-- The SQLite baseline in PostgreSQL types. Foreign keys on price_id are left
+-- out, as SQLite does not enforce them either, so btc_price can become a
+-- TimescaleDB hypertable (whose unique keys must include timestamp).
+
+CREATE TABLE IF NOT EXISTS btc_price (
+	id BIGSERIAL,
+	symbol TEXT NOT NULL DEFAULT 'XBT',
+	price DOUBLE PRECISION,
+	timestamp TIMESTAMPTZ NOT NULL,
+	PRIMARY KEY (id, timestamp)
+);
+CREATE INDEX IF NOT EXISTS idx_btc_price_symbol_timestamp ON btc_price (symbol, timestamp);
+
+CREATE TABLE IF NOT EXISTS settings (
+	id BIGSERIAL PRIMARY KEY,
+	symbol TEXT NOT NULL DEFAULT '',
+	initial_funds DOUBLE PRECISION DEFAULT 0,
+	transaction_fee_rate DOUBLE PRECISION DEFAULT 1.0,
+	updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS trading_signals (
+	id BIGSERIAL PRIMARY KEY,
+	price_id BIGINT,
+	symbol TEXT NOT NULL DEFAULT 'XBT',
+	action TEXT,
+	price DOUBLE PRECISION,
+	timestamp TIMESTAMPTZ,
+	quantity DOUBLE PRECISION NOT NULL DEFAULT 0,
+	reason TEXT NOT NULL DEFAULT 'strategy',
+	rejection TEXT NOT NULL DEFAULT ''
+);
+
+-- OHLC candles rolled up from ticks or backfilled from Kraken
+CREATE TABLE IF NOT EXISTS candles (
+	id BIGSERIAL PRIMARY KEY,
+	symbol TEXT NOT NULL,
+	interval INTEGER NOT NULL,
+	time TIMESTAMPTZ NOT NULL,
+	open DOUBLE PRECISION,
+	high DOUBLE PRECISION,
+	low DOUBLE PRECISION,
+	close DOUBLE PRECISION,
+	vwap DOUBLE PRECISION,
+	volume DOUBLE PRECISION,
+	count INTEGER,
+	UNIQUE(symbol, interval, time)
+);
+
+-- The last btc_price row rolled up into candles for each symbol
+CREATE TABLE IF NOT EXISTS candle_rollup (
+	symbol TEXT PRIMARY KEY,
+	price_id BIGINT NOT NULL
+);
+
+-- Paper-trading portfolio
+CREATE TABLE IF NOT EXISTS paper_balances (
+	symbol TEXT PRIMARY KEY,
+	initial_funds DOUBLE PRECISION NOT NULL,
+	cash DOUBLE PRECISION NOT NULL,
+	updated_at TIMESTAMPTZ
+);
+
+CREATE TABLE IF NOT EXISTS paper_positions (
+	symbol TEXT PRIMARY KEY,
+	quantity DOUBLE PRECISION NOT NULL DEFAULT 0,
+	entry_price DOUBLE PRECISION NOT NULL DEFAULT 0,
+	entry_quantity DOUBLE PRECISION NOT NULL DEFAULT 0,
+	opened_at TIMESTAMPTZ
+);
+
+CREATE TABLE IF NOT EXISTS paper_fills (
+	id BIGSERIAL PRIMARY KEY,
+	symbol TEXT NOT NULL,
+	side TEXT NOT NULL,
+	price DOUBLE PRECISION NOT NULL,
+	quantity DOUBLE PRECISION NOT NULL,
+	fee DOUBLE PRECISION NOT NULL,
+	cash DOUBLE PRECISION NOT NULL,
+	holdings DOUBLE PRECISION NOT NULL,
+	signal_id BIGINT,
+	timestamp TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS idx_paper_fills_symbol_timestamp ON paper_fills(symbol, timestamp);
+
+-- Exit ladder tiers sold per position, identified by symbol and opening time
+CREATE TABLE IF NOT EXISTS ladder_hits (
+	symbol TEXT NOT NULL,
+	opened_at TIMESTAMPTZ NOT NULL,
+	tier DOUBLE PRECISION NOT NULL,
+	price DOUBLE PRECISION NOT NULL,
+	quantity DOUBLE PRECISION NOT NULL,
+	timestamp TIMESTAMPTZ,
+	UNIQUE(symbol, opened_at, tier)
+);
+
+-- Exchange orders and their fills
+CREATE TABLE IF NOT EXISTS orders (
+	id BIGSERIAL PRIMARY KEY,
+	signal_id BIGINT REFERENCES trading_signals(id),
+	symbol TEXT NOT NULL,
+	pair TEXT NOT NULL,
+	side TEXT NOT NULL,
+	order_type TEXT NOT NULL,
+	volume DOUBLE PRECISION NOT NULL,
+	price DOUBLE PRECISION NOT NULL DEFAULT 0,
+	txid TEXT NOT NULL DEFAULT '',
+	status TEXT NOT NULL,
+	filled_volume DOUBLE PRECISION NOT NULL DEFAULT 0,
+	avg_price DOUBLE PRECISION NOT NULL DEFAULT 0,
+	cost DOUBLE PRECISION NOT NULL DEFAULT 0,
+	fee DOUBLE PRECISION NOT NULL DEFAULT 0,
+	error TEXT NOT NULL DEFAULT '',
+	created_at TIMESTAMPTZ,
+	updated_at TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS idx_orders_status ON orders(status);
+
+CREATE TABLE IF NOT EXISTS order_fills (
+	id BIGSERIAL PRIMARY KEY,
+	order_id BIGINT NOT NULL REFERENCES orders(id),
+	volume DOUBLE PRECISION NOT NULL,
+	price DOUBLE PRECISION NOT NULL,
+	cost DOUBLE PRECISION NOT NULL,
+	fee DOUBLE PRECISION NOT NULL,
+	timestamp TIMESTAMPTZ
+);
+
+-- Kill switch shared by every process using the database
+CREATE TABLE IF NOT EXISTS trading_halt (
+	id INTEGER PRIMARY KEY CHECK (id = 1),
+	halted BOOLEAN NOT NULL DEFAULT false,
+	reason TEXT NOT NULL DEFAULT '',
+	updated_at TIMESTAMPTZ
+);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_trading_signals_symbol_action;
+DROP INDEX IF EXISTS idx_trading_signals_price_id;
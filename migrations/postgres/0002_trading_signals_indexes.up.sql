@@ -0,0 +1,4 @@
+-- Signals are looked up per symbol (latest BUY, open position) and joined
+-- to prices by price_id for the dashboard chart
+CREATE INDEX IF NOT EXISTS idx_trading_signals_symbol_action ON trading_signals (symbol, action);
+CREATE INDEX IF NOT EXISTS idx_trading_signals_price_id ON trading_signals (price_id);
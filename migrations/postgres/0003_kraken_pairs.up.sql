@@ -0,0 +1,6 @@
+-- Kraken pair keys resolved from AssetPairs, cached across restarts
+CREATE TABLE IF NOT EXISTS kraken_pairs (
+	ticker TEXT PRIMARY KEY,
+	pair TEXT NOT NULL,
+	updated_at TIMESTAMPTZ
+);
@@ -0,0 +1,6 @@
+-- Where each candle came from: rolled up from collected ticks, or Kraken's
+-- OHLC data (backfill and OHLCVT imports). Ticks only update tick candles, so
+-- they never overwrite Kraken's volume, VWAP and trade count. Tick candles
+-- never have volume, so existing candles with volume came from Kraken.
+ALTER TABLE candles ADD COLUMN source TEXT NOT NULL DEFAULT 'ticks';
+UPDATE candles SET source = 'kraken' WHERE volume > 0;
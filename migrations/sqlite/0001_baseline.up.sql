@@ -0,0 +1,136 @@
+-- Schema as of the first migration. Databases created before migrations
+-- existed are brought up to it by adoptLegacySchema and stamped version 1.
+
+CREATE TABLE IF NOT EXISTS btc_price (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	symbol TEXT NOT NULL DEFAULT 'XBT',
+	price REAL,
+	timestamp DATETIME
+);
+CREATE INDEX IF NOT EXISTS idx_btc_price_symbol_timestamp ON btc_price (symbol, timestamp);
+
+CREATE TABLE IF NOT EXISTS settings (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	symbol TEXT NOT NULL DEFAULT '',
+	initial_funds REAL DEFAULT 0,
+	transaction_fee_rate REAL DEFAULT 1.0,
+	updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS trading_signals (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	price_id INTEGER,
+	symbol TEXT NOT NULL DEFAULT 'XBT',
+	action TEXT,
+	price REAL,
+	timestamp DATETIME,
+	quantity REAL NOT NULL DEFAULT 0,
+	reason TEXT NOT NULL DEFAULT 'strategy',
+	rejection TEXT NOT NULL DEFAULT '',
+	FOREIGN KEY(price_id) REFERENCES btc_price(id)
+);
+
+-- OHLC candles rolled up from ticks or backfilled from Kraken
+CREATE TABLE IF NOT EXISTS candles (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	symbol TEXT NOT NULL,
+	interval INTEGER NOT NULL,
+	time DATETIME NOT NULL,
+	open REAL,
+	high REAL,
+	low REAL,
+	close REAL,
+	vwap REAL,
+	volume REAL,
+	count INTEGER,
+	UNIQUE(symbol, interval, time)
+);
+
+-- The last btc_price row rolled up into candles for each symbol
+CREATE TABLE IF NOT EXISTS candle_rollup (
+	symbol TEXT PRIMARY KEY,
+	price_id INTEGER NOT NULL
+);
+
+-- Paper-trading portfolio
+CREATE TABLE IF NOT EXISTS paper_balances (
+	symbol TEXT PRIMARY KEY,
+	initial_funds REAL NOT NULL,
+	cash REAL NOT NULL,
+	updated_at DATETIME
+);
+
+CREATE TABLE IF NOT EXISTS paper_positions (
+	symbol TEXT PRIMARY KEY,
+	quantity REAL NOT NULL DEFAULT 0,
+	entry_price REAL NOT NULL DEFAULT 0,
+	entry_quantity REAL NOT NULL DEFAULT 0,
+	opened_at DATETIME
+);
+
+CREATE TABLE IF NOT EXISTS paper_fills (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	symbol TEXT NOT NULL,
+	side TEXT NOT NULL,
+	price REAL NOT NULL,
+	quantity REAL NOT NULL,
+	fee REAL NOT NULL,
+	cash REAL NOT NULL,
+	holdings REAL NOT NULL,
+	signal_id INTEGER,
+	timestamp DATETIME
+);
+CREATE INDEX IF NOT EXISTS idx_paper_fills_symbol_timestamp ON paper_fills(symbol, timestamp);
+
+-- Exit ladder tiers sold per position, identified by symbol and opening time
+CREATE TABLE IF NOT EXISTS ladder_hits (
+	symbol TEXT NOT NULL,
+	opened_at DATETIME NOT NULL,
+	tier REAL NOT NULL,
+	price REAL NOT NULL,
+	quantity REAL NOT NULL,
+	timestamp DATETIME,
+	UNIQUE(symbol, opened_at, tier)
+);
+
+-- Exchange orders and their fills
+CREATE TABLE IF NOT EXISTS orders (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	signal_id INTEGER,
+	symbol TEXT NOT NULL,
+	pair TEXT NOT NULL,
+	side TEXT NOT NULL,
+	order_type TEXT NOT NULL,
+	volume REAL NOT NULL,
+	price REAL NOT NULL DEFAULT 0,
+	txid TEXT NOT NULL DEFAULT '',
+	status TEXT NOT NULL,
+	filled_volume REAL NOT NULL DEFAULT 0,
+	avg_price REAL NOT NULL DEFAULT 0,
+	cost REAL NOT NULL DEFAULT 0,
+	fee REAL NOT NULL DEFAULT 0,
+	error TEXT NOT NULL DEFAULT '',
+	created_at DATETIME,
+	updated_at DATETIME,
+	FOREIGN KEY (signal_id) REFERENCES trading_signals(id)
+);
+CREATE INDEX IF NOT EXISTS idx_orders_status ON orders(status);
+
+CREATE TABLE IF NOT EXISTS order_fills (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	order_id INTEGER NOT NULL,
+	volume REAL NOT NULL,
+	price REAL NOT NULL,
+	cost REAL NOT NULL,
+	fee REAL NOT NULL,
+	timestamp DATETIME,
+	FOREIGN KEY (order_id) REFERENCES orders(id)
+);
+
+-- Kill switch shared by every process using the database
+CREATE TABLE IF NOT EXISTS trading_halt (
+	id INTEGER PRIMARY KEY CHECK (id = 1),
+	halted INTEGER NOT NULL DEFAULT 0,
+	reason TEXT NOT NULL DEFAULT '',
+	updated_at DATETIME
+);
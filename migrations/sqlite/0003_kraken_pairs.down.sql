@@ -0,0 +1 @@
+DROP TABLE IF EXISTS kraken_pairs;
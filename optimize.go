@@ -0,0 +1,426 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"crypto-trader/store"
+)
+
+// gridParam is one strategy parameter and the values to try for it.
+type gridParam struct {
+	Name   string
+	Values []string
+}
+
+// gridValueRe splits a grid value into its number and unit, e.g. "12h".
+var gridValueRe = regexp.MustCompile(`^(-?[0-9]*\.?[0-9]+)([a-z]*)$`)
+
+// parseGrid parses a parameter grid such as "fast=3d..20d:1d;slow=10d,20d,30d".
+// Parameters are separated by ';'. Each takes a comma-separated list of values
+// or an inclusive range start..end[:step]; range ends share a unit suffix and
+// the step defaults to 1 of that unit.
+func parseGrid(s string) ([]gridParam, error) {
+	var grid []gridParam
+	seen := make(map[string]bool)
+	for _, part := range strings.Split(s, ";") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name, spec, ok := strings.Cut(part, "=")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid grid parameter %q, expected name=values", part)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("grid parameter %q given twice", name)
+		}
+		seen[name] = true
+
+		var values []string
+		for _, v := range strings.Split(spec, ",") {
+			v = strings.TrimSpace(strings.ToLower(v))
+			if v == "" {
+				continue
+			}
+			if !strings.Contains(v, "..") {
+				values = append(values, v)
+				continue
+			}
+			expanded, err := expandGridRange(v)
+			if err != nil {
+				return nil, fmt.Errorf("grid parameter %s: %w", name, err)
+			}
+			values = append(values, expanded...)
+		}
+		if len(values) == 0 {
+			return nil, fmt.Errorf("grid parameter %s has no values", name)
+		}
+		grid = append(grid, gridParam{Name: name, Values: values})
+	}
+	if len(grid) == 0 {
+		return nil, fmt.Errorf("empty parameter grid")
+	}
+	return grid, nil
+}
+
+// expandGridRange expands "start..end[:step]" into its values.
+func expandGridRange(r string) ([]string, error) {
+	bounds, stepSpec, hasStep := strings.Cut(r, ":")
+	startSpec, endSpec, _ := strings.Cut(bounds, "..")
+
+	start, startUnit, err := splitGridValue(startSpec)
+	if err != nil {
+		return nil, err
+	}
+	end, endUnit, err := splitGridValue(endSpec)
+	if err != nil {
+		return nil, err
+	}
+	// A unit on either end applies to both, so "3..20d" means 3d to 20d
+	if startUnit == "" {
+		startUnit = endUnit
+	}
+	if endUnit == "" {
+		endUnit = startUnit
+	}
+	step, stepUnit := 1.0, startUnit
+	if hasStep {
+		if step, stepUnit, err = splitGridValue(stepSpec); err != nil {
+			return nil, err
+		}
+		if stepUnit == "" {
+			stepUnit = startUnit
+		}
+	}
+	if startUnit != endUnit || stepUnit != startUnit {
+		return nil, fmt.Errorf("range %q mixes units", r)
+	}
+	if step <= 0 || end < start {
+		return nil, fmt.Errorf("invalid range %q", r)
+	}
+
+	var values []string
+	for i := 0; ; i++ {
+		v := start + float64(i)*step
+		if v > end+step*1e-9 {
+			break
+		}
+		// Round away float noise from repeated steps (0.1+0.2...)
+		v = math.Round(v*1e9) / 1e9
+		values = append(values, strconv.FormatFloat(v, 'f', -1, 64)+startUnit)
+	}
+	return values, nil
+}
+
+func splitGridValue(s string) (float64, string, error) {
+	m := gridValueRe.FindStringSubmatch(strings.TrimSpace(s))
+	if m == nil {
+		return 0, "", fmt.Errorf("invalid grid value %q", s)
+	}
+	n, err := strconv.ParseFloat(m[1], 64)
+	if err != nil {
+		return 0, "", fmt.Errorf("invalid grid value %q", s)
+	}
+	return n, m[2], nil
+}
+
+// gridCombinations returns every combination of the grid's values merged over
+// base, in a stable order.
+func gridCombinations(grid []gridParam, base map[string]string) []map[string]string {
+	combos := []map[string]string{{}}
+	for k, v := range base {
+		combos[0][k] = v
+	}
+	for _, p := range grid {
+		next := make([]map[string]string, 0, len(combos)*len(p.Values))
+		for _, c := range combos {
+			for _, v := range p.Values {
+				combo := make(map[string]string, len(c)+1)
+				for k, cv := range c {
+					combo[k] = cv
+				}
+				combo[p.Name] = v
+				next = append(next, combo)
+			}
+		}
+		combos = next
+	}
+	return combos
+}
+
+// OptimizeRun is the outcome of backtesting one parameter combination.
+type OptimizeRun struct {
+	Params      string  `json:"params"`
+	Trades      int     `json:"trades"` // closed trades
+	FinalEquity float64 `json:"final_equity"`
+	TotalReturn float64 `json:"total_return"`
+	MaxDrawdown float64 `json:"max_drawdown"`
+	WinRate     float64 `json:"win_rate"`
+	Sharpe      float64 `json:"sharpe"`
+	Error       string  `json:"error,omitempty"` // why the combination was skipped
+
+	strategy Strategy
+	interval int
+	lookback time.Duration
+}
+
+// optimizeRankings maps -rank values to a "better than" comparison.
+var optimizeRankings = map[string]func(a, b *OptimizeRun) bool{
+	"return":   func(a, b *OptimizeRun) bool { return a.TotalReturn > b.TotalReturn },
+	"sharpe":   func(a, b *OptimizeRun) bool { return a.Sharpe > b.Sharpe },
+	"drawdown": func(a, b *OptimizeRun) bool { return a.MaxDrawdown < b.MaxDrawdown },
+	"winrate":  func(a, b *OptimizeRun) bool { return a.WinRate > b.WinRate },
+}
+
+// rankOptimizeRuns sorts runs best first by the named metric, with skipped
+// combinations last.
+func rankOptimizeRuns(runs []*OptimizeRun, rank string) {
+	better := optimizeRankings[rank]
+	sort.SliceStable(runs, func(i, j int) bool {
+		if (runs[i].Error == "") != (runs[j].Error == "") {
+			return runs[i].Error == ""
+		}
+		return better(runs[i], runs[j])
+	})
+}
+
+// runOptimize backtests every parameter combination of the named strategy in
+// parallel. history loads the replay data for a candle interval and lookback;
+// it is called once per distinct interval, with the longest lookback any
+// combination on that interval needs.
+func runOptimize(name string, combos []map[string]string, workers int, cfg BacktestConfig, symbol string,
+	history func(interval int, lookback time.Duration) (*backtestData, error)) ([]*OptimizeRun, error) {
+
+	runs := make([]*OptimizeRun, len(combos))
+	lookbacks := make(map[int]time.Duration)
+	for i, params := range combos {
+		run := &OptimizeRun{Params: formatStrategyParams(params)}
+		runs[i] = run
+		strategy, err := newStrategy(name, params)
+		if err != nil {
+			run.Error = err.Error()
+			continue
+		}
+		run.strategy = strategy
+		if resolved := formatStrategyParams(strategy.Params()); resolved != "" {
+			run.Params = resolved
+		}
+		run.interval, run.lookback = strategy.History()
+		if run.lookback > lookbacks[run.interval] {
+			lookbacks[run.interval] = run.lookback
+		}
+	}
+
+	data := make(map[int]*backtestData)
+	for interval, lookback := range lookbacks {
+		d, err := history(interval, lookback)
+		if err != nil {
+			return nil, err
+		}
+		data[interval] = d
+	}
+
+	if workers < 1 {
+		workers = 1
+	}
+	jobs := make(chan *OptimizeRun)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for run := range jobs {
+				r := runBacktest(run.strategy, symbol, data[run.interval], cfg)
+				run.Trades = len(r.ClosedTrades())
+				run.FinalEquity = r.FinalEquity
+				run.TotalReturn = r.TotalReturn
+				run.MaxDrawdown = r.MaxDrawdown
+				run.WinRate = r.WinRate
+				run.Sharpe = r.Sharpe
+			}
+		}()
+	}
+	for _, run := range runs {
+		if run.Error == "" {
+			jobs <- run
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	return runs, nil
+}
+
+// optimizeCommand implements `crypto-trader optimize`: it backtests a
+// strategy under every combination of a parameter grid and ranks the results.
+func optimizeCommand(args []string) {
+	fs := flag.NewFlagSet("optimize", flag.ExitOnError)
+	symbol := fs.String("symbol", configuredTickers()[0], "Symbol to optimize on (e.g. BTC, ETH)")
+	fromFlag := fs.String("from", "", "Start of the range, 2006-01-02 or RFC 3339 (default: -days before -to)")
+	toFlag := fs.String("to", "", "End of the range, 2006-01-02 or RFC 3339 (default: now)")
+	days := fs.Int("days", 30, "Days to replay when -from is not set")
+	strategyName := fs.String("strategy", "", "Strategy to optimize (default: STRATEGY setting)")
+	baseParams := fs.String("params", "", "Fixed parameters as key=value,key=value, overridden by the grid")
+	gridFlag := fs.String("grid", "fast=1d..7d:1d;slow=7d..30d:7d", "Parameter grid, e.g. fast=3d..20d:1d;slow=10d,30d,60d")
+	workers := fs.Int("workers", runtime.NumCPU(), "Backtests to run in parallel")
+	rank := fs.String("rank", "return", "Metric to rank by (return, sharpe, drawdown, winrate)")
+	top := fs.Int("top", 20, "Rows to print (0 for all)")
+	funds := fs.Float64("funds", 0, "Initial funds (default: settings table, else 10000)")
+	fee := fs.Float64("fee", -1, "Transaction fee percent per trade (default: settings table)")
+	ladder := fs.String("ladder", os.Getenv("EXIT_LADDER"), "Exit ladder tiers as gain:fraction,... (default: EXIT_LADDER setting)")
+	csvFile := fs.String("csv", "", "Write every run to this CSV file")
+	jsonFile := fs.String("json", "", "Write every run to this JSON file")
+	fs.Parse(args)
+
+	name := *strategyName
+	if name == "" {
+		if name = strings.TrimSpace(os.Getenv("STRATEGY")); name == "" {
+			name = "wma_crossover"
+		}
+	}
+	if _, ok := optimizeRankings[*rank]; !ok {
+		fmt.Println("Unknown -rank:", *rank)
+		os.Exit(1)
+	}
+	base, err := parseStrategyParams(*baseParams)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	grid, err := parseGrid(*gridFlag)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	from, to, err := backtestRange(*fromFlag, *toFlag, *days)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	sym := normalizeSymbol(*symbol)
+
+	db, err := openDatabase()
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	defer db.Close()
+
+	if _, err := catchUpCandles(store.New(db), sym); err != nil {
+		fmt.Println("Error aggregating candles:", err)
+		os.Exit(1)
+	}
+
+	cfg := backtestSettings(db, sym)
+	if *funds > 0 {
+		cfg.InitialFunds = *funds
+	}
+	if *fee >= 0 {
+		cfg.FeeRate = *fee
+	}
+	if cfg.Ladder, err = parseExitLadder(*ladder); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	combos := gridCombinations(grid, base)
+	fmt.Printf("Optimizing %s on %s, %s to %s: %d combinations, %d workers, %.2f%% fee\n",
+		name, sym, from.Format("2006-01-02"), to.Format("2006-01-02"), len(combos), *workers, cfg.FeeRate)
+
+	started := time.Now()
+	runs, err := runOptimize(name, combos, *workers, cfg, sym, func(interval int, lookback time.Duration) (*backtestData, error) {
+		data, err := loadBacktestHistory(db, sym, interval, lookback, from, to)
+		if err == nil && len(data.Prices) == 0 {
+			err = fmt.Errorf("no stored prices for %s between %s and %s", sym, from.Format(time.RFC3339), to.Format(time.RFC3339))
+		}
+		return data, err
+	})
+	if err != nil {
+		fmt.Println("Error loading history:", err)
+		os.Exit(1)
+	}
+	rankOptimizeRuns(runs, *rank)
+	fmt.Printf("Completed in %s\n\n", time.Since(started).Round(time.Millisecond))
+
+	printOptimizeRuns(runs, *top)
+
+	if *csvFile != "" {
+		if err := writeOptimizeCSV(*csvFile, runs); err != nil {
+			fmt.Println("Error writing CSV:", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Results written to %s\n", *csvFile)
+	}
+	if *jsonFile != "" {
+		out, err := json.MarshalIndent(runs, "", "  ")
+		if err == nil {
+			err = os.WriteFile(*jsonFile, out, 0o644)
+		}
+		if err != nil {
+			fmt.Println("Error writing JSON:", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Results written to %s\n", *jsonFile)
+	}
+}
+
+// printOptimizeRuns prints the ranked table, limited to top rows when top > 0.
+func printOptimizeRuns(runs []*OptimizeRun, top int) {
+	fmt.Printf("%4s  %-30s %7s %10s %10s %9s %8s\n", "rank", "params", "trades", "return", "drawdown", "win rate", "sharpe")
+	skipped := 0
+	for i, r := range runs {
+		if r.Error != "" {
+			skipped++
+			continue
+		}
+		if top > 0 && i >= top {
+			continue
+		}
+		fmt.Printf("%4d  %-30s %7d %9.2f%% %9.2f%% %8.1f%% %8.2f\n",
+			i+1, r.Params, r.Trades, r.TotalReturn*100, r.MaxDrawdown*100, r.WinRate*100, r.Sharpe)
+	}
+	if skipped > 0 {
+		fmt.Printf("\n%d invalid combinations skipped (e.g. %s: %s)\n", skipped, runs[len(runs)-1].Params, runs[len(runs)-1].Error)
+	}
+}
+
+// writeOptimizeCSV writes one row per run, skipped combinations included.
+func writeOptimizeCSV(path string, runs []*OptimizeRun) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := csv.NewWriter(f)
+	w.Write([]string{"params", "trades", "final_equity", "total_return", "max_drawdown", "win_rate", "sharpe", "error"})
+	for _, r := range runs {
+		w.Write([]string{
+			r.Params,
+			strconv.Itoa(r.Trades),
+			strconv.FormatFloat(r.FinalEquity, 'f', 2, 64),
+			strconv.FormatFloat(r.TotalReturn, 'f', 6, 64),
+			strconv.FormatFloat(r.MaxDrawdown, 'f', 6, 64),
+			strconv.FormatFloat(r.WinRate, 'f', 4, 64),
+			strconv.FormatFloat(r.Sharpe, 'f', 4, 64),
+			r.Error,
+		})
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"reflect"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestParseGrid_ListsAndRanges(t *testing.T) {
+	grid, err := parseGrid("fast=3..5d; slow=12h..36h:12h ;k=0.1..0.3:0.1,1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []gridParam{
+		{Name: "fast", Values: []string{"3d", "4d", "5d"}},
+		{Name: "slow", Values: []string{"12h", "24h", "36h"}},
+		{Name: "k", Values: []string{"0.1", "0.2", "0.3", "1"}},
+	}
+	if !reflect.DeepEqual(grid, want) {
+		t.Fatalf("expected %v, got %v", want, grid)
+	}
+
+	for _, bad := range []string{"", "fast", "fast=1d..3h", "fast=5..1", "fast=1..3:0", "fast=1d;fast=2d"} {
+		if _, err := parseGrid(bad); err == nil {
+			t.Fatalf("expected error for %q", bad)
+		}
+	}
+}
+
+func TestGridCombinations_CrossProductOverBase(t *testing.T) {
+	grid := []gridParam{{Name: "a", Values: []string{"1", "2"}}, {Name: "b", Values: []string{"x", "y", "z"}}}
+	combos := gridCombinations(grid, map[string]string{"c": "fixed", "a": "0"})
+	if len(combos) != 6 {
+		t.Fatalf("expected 6 combinations, got %d", len(combos))
+	}
+	if want := map[string]string{"a": "2", "b": "z", "c": "fixed"}; !reflect.DeepEqual(combos[5], want) {
+		t.Fatalf("expected %v, got %v", want, combos[5])
+	}
+}
+
+var registerBand sync.Once
+
+// registerBandStrategy registers bandStrategy as "band" with a "low" parameter.
+func registerBandStrategy() {
+	registerBand.Do(func() {
+		RegisterStrategy("band", func(params map[string]string) (Strategy, error) {
+			low, err := strconv.ParseFloat(params["low"], 64)
+			if err != nil {
+				return nil, err
+			}
+			return &bandStrategy{Low: low, High: 110}, nil
+		})
+	})
+}
+
+func TestRunOptimize_RanksRunsAndSkipsInvalid(t *testing.T) {
+	registerBandStrategy()
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	data := &backtestData{Start: start}
+	for i, p := range []float64{100, 90, 120, 80, 120} {
+		data.Prices = append(data.Prices, pricePoint{Time: start.Add(time.Duration(i) * time.Hour), Price: p})
+	}
+
+	loads := 0
+	combos := gridCombinations([]gridParam{{Name: "low", Values: []string{"85", "95", "oops"}}}, nil)
+	runs, err := runOptimize("band", combos, 4, BacktestConfig{InitialFunds: 1000}, "XBT", func(int, time.Duration) (*backtestData, error) {
+		loads++
+		return data, nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if loads != 1 {
+		t.Fatalf("expected history to load once, got %d", loads)
+	}
+	rankOptimizeRuns(runs, "return")
+
+	// low=95 buys at 90 and 80, low=85 only at 80
+	if runs[0].Params != "low=95" || runs[0].Trades != 2 || runs[1].Params != "low=85" || runs[1].Trades != 1 {
+		t.Fatalf("unexpected ranking: %+v, %+v", runs[0], runs[1])
+	}
+	if runs[2].Error == "" {
+		t.Fatalf("expected invalid combination to be skipped, got %+v", runs[2])
+	}
+}
@@ -0,0 +1,339 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"crypto-trader/store"
+)
+
+// Order states. An order starts pending, becomes submitted once Kraken
+// accepts it (or rejected if it does not), and moves through partial fills
+// to filled or cancelled. Dry-run orders that Kraken only checked end as
+// validated. An order whose submission failed on the way stays pending
+// until polling finds it at Kraken by its userref.
+const (
+	OrderPending         = "pending"
+	OrderSubmitted       = "submitted"
+	OrderPartiallyFilled = "partially_filled"
+	OrderFilled          = "filled"
+	OrderCancelled       = "cancelled"
+	OrderRejected        = "rejected"
+	OrderValidated       = "validated"
+)
+
+// orderTransitions lists the states each state may move to. States without
+// an entry are terminal.
+var orderTransitions = map[string][]string{
+	OrderPending:         {OrderSubmitted, OrderRejected, OrderValidated},
+	OrderSubmitted:       {OrderPartiallyFilled, OrderFilled, OrderCancelled},
+	OrderPartiallyFilled: {OrderPartiallyFilled, OrderFilled, OrderCancelled},
+}
+
+// canTransition reports whether an order in state from may move to to.
+func canTransition(from, to string) bool {
+	for _, s := range orderTransitions[from] {
+		if s == to {
+			return true
+		}
+	}
+	return false
+}
+
+// Order is an exchange order and its fill progress.
+type Order = store.Order
+
+// OrderFill is the part of an order executed between two status polls.
+type OrderFill = store.OrderFill
+
+// openOrders returns the orders that may still fill, oldest first.
+func openOrders(st store.Store) ([]Order, error) {
+	return st.OrdersByStatus(OrderSubmitted, OrderPartiallyFilled)
+}
+
+// pendingOrders returns the orders whose submission outcome is not known
+// yet, oldest first.
+func pendingOrders(st store.Store) ([]Order, error) {
+	return st.OrdersByStatus(OrderPending)
+}
+
+// orderUserRef is the userref an order is sent with: its ID, wrapped into
+// Kraken's positive int32 range.
+func orderUserRef(id int64) int32 {
+	return int32((id-1)%math.MaxInt32 + 1)
+}
+
+// OrderManager submits orders to Kraken, records them in the store and polls
+// open orders until they fill or are cancelled.
+type OrderManager struct {
+	st       store.Store
+	client   *KrakenPrivateClient
+	interval time.Duration
+
+	// Pending orders are looked up at Kraken once they are pendingGrace old,
+	// past any submission still in flight, and rejected when Kraken still
+	// does not know them after pendingTimeout.
+	pendingGrace   time.Duration
+	pendingTimeout time.Duration
+}
+
+// newOrderManager returns a manager polling every ORDER_POLL_SECONDS
+// (default 10).
+func newOrderManager(st store.Store, client *KrakenPrivateClient) *OrderManager {
+	interval := 10 * time.Second
+	if val := os.Getenv("ORDER_POLL_SECONDS"); val != "" {
+		if n, err := strconv.Atoi(val); err == nil && n > 0 {
+			interval = time.Duration(n) * time.Second
+		}
+	}
+	return &OrderManager{st: st, client: client, interval: interval, pendingGrace: time.Minute, pendingTimeout: 10 * time.Minute}
+}
+
+// Submit records req as a pending order for signalID and sends it with the
+// order's userref. The order ends submitted, rejected (with Kraken's error)
+// or, when req only validates, validated. When the request fails without an
+// answer from Kraken, e.g. on a timeout, the order may still have been
+// placed, so it stays pending with the error for Poll to reconcile. Neither
+// outcome is returned as an error.
+func (m *OrderManager) Submit(ctx context.Context, signalID int64, symbol string, req OrderRequest) (*Order, error) {
+	now := time.Now().UTC()
+	o := &Order{
+		SignalID:  signalID,
+		Symbol:    symbol,
+		Pair:      req.Pair,
+		Side:      req.Side,
+		OrderType: req.OrderType,
+		Volume:    req.Volume,
+		Price:     req.Price,
+		Status:    OrderPending,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if o.OrderType == "" {
+		o.OrderType = "market"
+	}
+	id, err := m.st.InsertOrder(*o)
+	if err != nil {
+		return nil, err
+	}
+	o.ID = id
+
+	req.UserRef = orderUserRef(o.ID)
+	result, err := m.client.AddOrder(ctx, req)
+	var apiErr *KrakenAPIError
+	switch {
+	case errors.As(err, &apiErr) || errors.Is(err, errInvalidOrder):
+		o.Status, o.Error = OrderRejected, err.Error()
+	case err != nil:
+		o.Error = err.Error()
+	case req.Validate:
+		o.Status = OrderValidated
+	case len(result.TxIDs) == 0:
+		o.Status, o.Error = OrderRejected, "no txid returned"
+	default:
+		o.Status, o.TxID = OrderSubmitted, result.TxIDs[0]
+	}
+	o.UpdatedAt = time.Now().UTC()
+	if err := m.st.UpdatePendingOrder(*o); err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+// Run polls open orders until ctx is done. Errors are logged and retried
+// on the next poll.
+func (m *OrderManager) Run(ctx context.Context) {
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+	for {
+		if err := m.Poll(ctx); err != nil {
+			fmt.Println("Error polling orders:", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Poll resolves pending orders and then queries Kraken for every open order
+// and reconciles the answers. An order that fails is logged and skipped so
+// the others are still reconciled; the failures are returned together.
+func (m *OrderManager) Poll(ctx context.Context) error {
+	errs := []error{m.resolvePending(ctx, time.Now().UTC(), m.pendingGrace)}
+	orders, err := openOrders(m.st)
+	if err != nil || len(orders) == 0 {
+		return errors.Join(append(errs, err)...)
+	}
+	txids := make([]string, len(orders))
+	for i, o := range orders {
+		txids[i] = o.TxID
+	}
+	states, err := m.client.QueryOrders(ctx, txids...)
+	if err != nil {
+		return errors.Join(append(errs, err)...)
+	}
+	for i := range orders {
+		state, ok := states[orders[i].TxID]
+		if !ok {
+			continue
+		}
+		if err := reconcileOrder(m.st, &orders[i], state, time.Now().UTC()); err != nil {
+			err = fmt.Errorf("order %d (%s): %w", orders[i].ID, orders[i].TxID, err)
+			fmt.Println("Error reconciling", err)
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// resolvePending looks up each pending order at least grace old at Kraken by
+// its userref. An order Kraken has is marked submitted with its txid and then
+// reconciled like any open order; one Kraken still does not have after
+// pendingTimeout never arrived and is rejected.
+func (m *OrderManager) resolvePending(ctx context.Context, now time.Time, grace time.Duration) error {
+	orders, err := pendingOrders(m.st)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for i := range orders {
+		o := &orders[i]
+		age := now.Sub(o.CreatedAt)
+		if age < grace {
+			continue
+		}
+		txid, state, err := m.findOrder(ctx, o)
+		if err != nil {
+			err = fmt.Errorf("order %d: %w", o.ID, err)
+			fmt.Println("Error looking up pending", err)
+			errs = append(errs, err)
+			continue
+		}
+		o.UpdatedAt = now
+		switch {
+		case txid != "":
+			o.Status, o.TxID = OrderSubmitted, txid
+		case age >= m.pendingTimeout:
+			o.Status = OrderRejected
+			o.Error = strings.TrimSuffix("not found at Kraken after "+o.Error, " after ")
+		default:
+			continue
+		}
+		if err := m.st.UpdatePendingOrder(*o); err != nil {
+			errs = append(errs, fmt.Errorf("order %d: %w", o.ID, err))
+			continue
+		}
+		if txid == "" {
+			continue
+		}
+		if err := reconcileOrder(m.st, o, state, now); err != nil {
+			err = fmt.Errorf("order %d (%s): %w", o.ID, o.TxID, err)
+			fmt.Println("Error reconciling", err)
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// findOrder returns the txid and state of the Kraken order placed for o,
+// found by userref among the open and then the closed orders, or an empty
+// txid if Kraken has none. Orders opened well before o, e.g. ones sharing
+// its userref from an earlier database, are ignored.
+func (m *OrderManager) findOrder(ctx context.Context, o *Order) (string, KrakenOrder, error) {
+	ref := orderUserRef(o.ID)
+	since := o.CreatedAt.Add(-time.Minute)
+	open, err := m.client.OpenOrders(ctx, ref)
+	if err != nil {
+		return "", KrakenOrder{}, err
+	}
+	closed, err := m.client.ClosedOrders(ctx, ref, since)
+	if err != nil {
+		return "", KrakenOrder{}, err
+	}
+	for _, orders := range []map[string]KrakenOrder{open, closed} {
+		for txid, k := range orders {
+			if k.UserRef == ref && k.Description.Type == o.Side && k.OpenTime >= float64(since.Unix()) {
+				return txid, k, nil
+			}
+		}
+	}
+	return "", KrakenOrder{}, nil
+}
+
+// krakenOrderStatus maps a Kraken order state to the order's next status.
+func krakenOrderStatus(k KrakenOrder, filled float64) string {
+	switch k.Status {
+	case "closed":
+		return OrderFilled
+	case "canceled", "expired":
+		return OrderCancelled
+	}
+	if filled > 0 {
+		return OrderPartiallyFilled
+	}
+	return OrderSubmitted
+}
+
+// reconcileOrder applies Kraken's view of o: volume executed since the last
+// poll is recorded as a fill, and the status moves on when the state machine
+// allows it. o is updated in place.
+func reconcileOrder(st store.Store, o *Order, k KrakenOrder, now time.Time) error {
+	filled, _ := strconv.ParseFloat(k.VolumeExec, 64)
+	cost, _ := strconv.ParseFloat(k.Cost, 64)
+	fee, _ := strconv.ParseFloat(k.Fee, 64)
+	avg, _ := strconv.ParseFloat(k.Price, 64)
+
+	status := krakenOrderStatus(k, filled)
+	if status != o.Status && !canTransition(o.Status, status) {
+		return fmt.Errorf("invalid transition %s -> %s", o.Status, status)
+	}
+	if status == o.Status && filled == o.FilledVolume {
+		return nil
+	}
+
+	var fill *OrderFill
+	if delta := filled - o.FilledVolume; delta > 0 {
+		deltaCost := cost - o.Cost
+		fill = &OrderFill{OrderID: o.ID, Volume: delta, Price: deltaCost / delta, Cost: deltaCost, Fee: fee - o.Fee, Timestamp: now}
+	}
+	next := *o
+	if status == OrderCancelled && next.Error == "" {
+		next.Error = k.Reason
+	}
+	next.Status, next.FilledVolume, next.AvgPrice, next.Cost, next.Fee, next.UpdatedAt = status, filled, avg, cost, fee, now
+	if err := st.UpdateOrder(next, fill); err != nil {
+		return err
+	}
+	*o = next
+	return nil
+}
+
+// CancelOpen cancels every open order and reconciles their final state. It
+// returns how many orders Kraken cancelled. Pending orders may already be
+// live, so they are looked up by userref first and cancelled if Kraken has
+// them.
+func (m *OrderManager) CancelOpen(ctx context.Context) (int, error) {
+	errs := []error{m.resolvePending(ctx, time.Now().UTC(), 0)}
+	orders, err := openOrders(m.st)
+	if err != nil {
+		return 0, errors.Join(append(errs, err)...)
+	}
+	cancelled := 0
+	for _, o := range orders {
+		n, err := m.client.CancelOrder(ctx, o.TxID)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("order %d (%s): %w", o.ID, o.TxID, err))
+			continue
+		}
+		cancelled += n
+	}
+	return cancelled, errors.Join(append(errs, m.Poll(ctx))...)
+}
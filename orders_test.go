@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"math"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"crypto-trader/store"
+)
+
+func TestCanTransition(t *testing.T) {
+	for _, c := range []struct {
+		from, to string
+		want     bool
+	}{
+		{OrderPending, OrderSubmitted, true},
+		{OrderSubmitted, OrderPartiallyFilled, true},
+		{OrderPartiallyFilled, OrderFilled, true},
+		{OrderPartiallyFilled, OrderCancelled, true},
+		{OrderSubmitted, OrderPending, false},
+		{OrderFilled, OrderCancelled, false},
+		{OrderRejected, OrderSubmitted, false},
+	} {
+		if got := canTransition(c.from, c.to); got != c.want {
+			t.Fatalf("expected %s -> %s allowed=%v, got %v", c.from, c.to, c.want, got)
+		}
+	}
+}
+
+func TestOrderManager_TracksOrderToFilled(t *testing.T) {
+	db := openMigratedTestDB(t)
+
+	// Kraken fills the order in two steps, then reports it closed
+	states := []string{
+		`{"status": "open", "vol": "0.02", "vol_exec": "0.005", "cost": "325.00", "fee": "0.85", "price": "65000.0"}`,
+		`{"status": "open", "vol": "0.02", "vol_exec": "0.005", "cost": "325.00", "fee": "0.85", "price": "65000.0"}`,
+		`{"status": "closed", "vol": "0.02", "vol_exec": "0.02", "cost": "1306.00", "fee": "3.40", "price": "65300.0"}`,
+	}
+	polls := 0
+	client := newTestKrakenPrivate(t, func(method string, form url.Values) string {
+		switch method {
+		case "AddOrder":
+			if form.Get("pair") == "BADUSD" {
+				return `{"error": ["EQuery:Unknown asset pair"]}`
+			}
+			return `{"error": [], "result": {"descr": {"order": "buy"}, "txid": ["OTEST1"]}}`
+		case "QueryOrders":
+			state := states[polls]
+			polls++
+			return `{"error": [], "result": {"OTEST1": ` + state + `}}`
+		}
+		return `{"error": ["EGeneral:Unknown method"]}`
+	})
+	m := newOrderManager(store.New(db), client)
+	ctx := context.Background()
+
+	rejected, err := m.Submit(ctx, 0, "BAD", OrderRequest{Pair: "BADUSD", Side: "buy", Volume: 1})
+	if err != nil || rejected.Status != OrderRejected || rejected.Error == "" {
+		t.Fatalf("expected a rejected order with Kraken's error, got %+v, %v", rejected, err)
+	}
+
+	o, err := m.Submit(ctx, 42, "XBT", OrderRequest{Pair: "XBTUSD", Side: "buy", Volume: 0.02})
+	if err != nil || o.Status != OrderSubmitted || o.TxID != "OTEST1" {
+		t.Fatalf("expected a submitted order, got %+v, %v", o, err)
+	}
+
+	for range states {
+		if err := m.Poll(ctx); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if err := m.Poll(ctx); err != nil || polls != len(states) {
+		t.Fatalf("expected filled orders to stop being polled, got %d polls, %v", polls, err)
+	}
+
+	orders, err := store.New(db).RecentOrders("XBT", 10)
+	if err != nil || len(orders) != 1 {
+		t.Fatalf("expected one XBT order, got %v, %v", orders, err)
+	}
+	got := orders[0]
+	if got.Status != OrderFilled || got.SignalID != 42 || got.FilledVolume != 0.02 || got.AvgPrice != 65300 {
+		t.Fatalf("expected order filled at $65300 for signal 42, got %+v", got)
+	}
+
+	fills, err := store.New(db).OrderFills(got.ID)
+	if err != nil || len(fills) != 2 {
+		t.Fatalf("expected two fills, got %v, %v", fills, err)
+	}
+	if fills[0].Volume != 0.005 || fills[0].Price != 65000 {
+		t.Fatalf("expected first fill 0.005 at $65000, got %+v", fills[0])
+	}
+	if math.Abs(fills[1].Volume-0.015) > 1e-12 || math.Abs(fills[1].Price-65400) > 1e-6 || math.Abs(fills[1].Fee-2.55) > 1e-9 {
+		t.Fatalf("expected second fill 0.015 at $65400 with $2.55 fee, got %+v", fills[1])
+	}
+}
+
+func TestOrderManager_TransportErrorStaysPendingUntilFound(t *testing.T) {
+	db := openMigratedTestDB(t)
+
+	// Kraken places both orders but the AddOrder answers never arrive intact;
+	// only the first order is known to OpenOrders afterwards
+	var userrefs []string
+	state := `{"status": "open", "userref": 1, "descr": {"type": "buy"},
+		"vol": "0.02", "vol_exec": "0.01", "cost": "650.00", "fee": "1.70", "price": "65000.0", "opentm": 4102444800}`
+	client := newTestKrakenPrivate(t, func(method string, form url.Values) string {
+		switch method {
+		case "AddOrder":
+			userrefs = append(userrefs, form.Get("userref"))
+			return `<html>502 Bad Gateway</html>`
+		case "OpenOrders":
+			if form.Get("userref") != "1" {
+				return `{"error": [], "result": {"open": {}}}`
+			}
+			return `{"error": [], "result": {"open": {"OTEST1": ` + state + `}}}`
+		case "QueryOrders":
+			return `{"error": [], "result": {"OTEST1": ` + state + `}}`
+		case "ClosedOrders":
+			return `{"error": [], "result": {"closed": {}, "count": 0}}`
+		}
+		return `{"error": ["EGeneral:Unknown method"]}`
+	})
+	m := newOrderManager(store.New(db), client)
+	ctx := context.Background()
+
+	found, err := m.Submit(ctx, 0, "XBT", OrderRequest{Pair: "XBTUSD", Side: "buy", Volume: 0.02})
+	if err != nil || found.Status != OrderPending || found.Error == "" {
+		t.Fatalf("expected a pending order with the transport error, got %+v, %v", found, err)
+	}
+	lost, _ := m.Submit(ctx, 0, "XBT", OrderRequest{Pair: "XBTUSD", Side: "buy", Volume: 0.02})
+	if len(userrefs) != 2 || userrefs[0] != "1" || userrefs[1] != "2" {
+		t.Fatalf("expected orders sent with userrefs 1 and 2, got %v", userrefs)
+	}
+
+	// Too young to look up: a submission may still be in flight
+	if err := m.Poll(ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if orders, _ := pendingOrders(store.New(db)); len(orders) != 2 {
+		t.Fatalf("expected both orders still pending, got %+v", orders)
+	}
+
+	m.pendingGrace = 0
+	if err := m.Poll(ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	orders, _ := store.New(db).RecentOrders("XBT", 10)
+	if got := orders[1]; got.ID != found.ID || got.Status != OrderPartiallyFilled || got.TxID != "OTEST1" || got.FilledVolume != 0.01 {
+		t.Fatalf("expected the found order partially filled as OTEST1, got %+v", got)
+	}
+	if got := orders[0]; got.ID != lost.ID || got.Status != OrderPending {
+		t.Fatalf("expected the lost order to stay pending before the timeout, got %+v", got)
+	}
+
+	m.pendingTimeout = 0
+	if err := m.Poll(ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if orders, _ = store.New(db).RecentOrders("XBT", 10); orders[0].Status != OrderRejected {
+		t.Fatalf("expected the order Kraken never got to be rejected, got %+v", orders[0])
+	}
+}
+
+func TestOrderManager_PollContinuesPastFailedOrder(t *testing.T) {
+	db := openMigratedTestDB(t)
+	client := newTestKrakenPrivate(t, func(method string, form url.Values) string {
+		if method != "QueryOrders" {
+			return `{"error": ["EGeneral:Unknown method"]}`
+		}
+		// OBAD1 reports no fills although one was recorded, which the state
+		// machine refuses
+		return `{"error": [], "result": {
+			"OBAD1": {"status": "open", "vol": "0.02", "vol_exec": "0", "cost": "0", "fee": "0", "price": "0"},
+			"OGOOD1": {"status": "closed", "vol": "0.01", "vol_exec": "0.01", "cost": "650.00", "fee": "1.70", "price": "65000.0"}}}`
+	})
+	now := time.Now().UTC()
+	db.Exec(`INSERT INTO orders (symbol, pair, side, order_type, volume, txid, status, filled_volume, created_at, updated_at) VALUES ('XBT', 'XBTUSD', 'buy', 'market', 0.02, 'OBAD1', ?, 0.01, ?, ?)`,
+		OrderPartiallyFilled, now, now)
+	db.Exec(`INSERT INTO orders (symbol, pair, side, order_type, volume, txid, status, created_at, updated_at) VALUES ('XBT', 'XBTUSD', 'buy', 'market', 0.01, 'OGOOD1', ?, ?, ?)`,
+		OrderSubmitted, now, now)
+
+	err := newOrderManager(store.New(db), client).Poll(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "OBAD1") {
+		t.Fatalf("expected the OBAD1 failure returned, got %v", err)
+	}
+	orders, _ := store.New(db).RecentOrders("XBT", 10)
+	if orders[0].TxID != "OGOOD1" || orders[0].Status != OrderFilled {
+		t.Fatalf("expected OGOOD1 reconciled despite OBAD1, got %+v", orders[0])
+	}
+}
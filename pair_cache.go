@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const defaultPairCacheTTL = 24 * time.Hour
+
+// pairEntry is a resolved Kraken pair key and when it was looked up. An empty
+// pair records that Kraken lists no pair for the ticker.
+type pairEntry struct {
+	pair      string
+	updatedAt time.Time
+}
+
+// krakenPairCache remembers which Kraken pair key (e.g. "XXBTZUSD") belongs to
+// each asset code so the AssetPairs payload is only downloaded once per TTL
+// rather than on every tick. Entries are persisted in the kraken_pairs table so
+// they survive restarts and AssetPairs outages; stale entries keep being served
+// while a background refresh runs. Tickers Kraken has no pair for are
+// remembered in memory for the same TTL, so they do not refetch on every tick.
+type krakenPairCache struct {
+	db    *sql.DB // optional; nil keeps the cache in memory only
+	ttl   time.Duration
+	fetch func(ctx context.Context) ([]byte, error)
+
+	mu         sync.Mutex
+	entries    map[string]pairEntry
+	loaded     bool
+	refreshing bool
+}
+
+// newKrakenPairCache returns a cache over db, which must be migrated (the
+// kraken_pairs table comes from migration 0003).
+func newKrakenPairCache(db *sql.DB, ttl time.Duration, fetch func(ctx context.Context) ([]byte, error)) *krakenPairCache {
+	if ttl <= 0 {
+		ttl = defaultPairCacheTTL
+	}
+	return &krakenPairCache{
+		db:      db,
+		ttl:     ttl,
+		fetch:   fetch,
+		entries: make(map[string]pairEntry),
+	}
+}
+
+// load reads persisted pairs into memory. Callers must hold c.mu.
+func (c *krakenPairCache) load() {
+	if c.loaded || c.db == nil {
+		c.loaded = true
+		return
+	}
+	c.loaded = true
+
+	rows, err := c.db.Query(`SELECT ticker, pair, updated_at FROM kraken_pairs`)
+	if err != nil {
+		fmt.Println("Error loading cached Kraken pairs:", err)
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var ticker, pair string
+		var updatedAt time.Time
+		if err := rows.Scan(&ticker, &pair, &updatedAt); err != nil {
+			continue
+		}
+		c.entries[ticker] = pairEntry{pair: pair, updatedAt: updatedAt}
+	}
+}
+
+// Resolve returns the pair key for ticker. A fresh entry is returned as-is, a
+// stale entry is returned immediately while a refresh runs in the background,
+// and a missing entry is fetched synchronously. An empty string means the pair
+// could not be resolved.
+func (c *krakenPairCache) Resolve(ctx context.Context, ticker string) string {
+	c.mu.Lock()
+	c.load()
+	entry, ok := c.entries[ticker]
+	if ok {
+		if time.Since(entry.updatedAt) > c.ttl && !c.refreshing {
+			c.refreshing = true
+			go func() {
+				ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+				defer cancel()
+				if err := c.Refresh(ctx); err != nil {
+					fmt.Println("Error refreshing Kraken pairs, keeping cached values:", err)
+				}
+			}()
+		}
+		c.mu.Unlock()
+		return entry.pair
+	}
+	c.mu.Unlock()
+
+	if err := c.refresh(ctx, ticker); err != nil {
+		return ""
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.entries[ticker].pair
+}
+
+// Refresh downloads AssetPairs once and re-resolves every cached ticker.
+func (c *krakenPairCache) Refresh(ctx context.Context) error {
+	defer func() {
+		c.mu.Lock()
+		c.refreshing = false
+		c.mu.Unlock()
+	}()
+	return c.refresh(ctx, "")
+}
+
+// refresh resolves every known ticker plus extra (if non-empty) from a single
+// AssetPairs download and persists the results.
+func (c *krakenPairCache) refresh(ctx context.Context, extra string) error {
+	body, err := c.fetch(ctx)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	tickers := make([]string, 0, len(c.entries)+1)
+	for t := range c.entries {
+		tickers = append(tickers, t)
+	}
+	if _, ok := c.entries[extra]; extra != "" && !ok {
+		tickers = append(tickers, extra)
+	}
+	c.mu.Unlock()
+
+	now := time.Now().UTC()
+	for _, t := range tickers {
+		pair := detectKrakenPair(t, body)
+		c.mu.Lock()
+		if entry := c.entries[t]; pair == "" && entry.pair != "" {
+			// Keep serving the last known pair
+			c.mu.Unlock()
+			continue
+		}
+		c.entries[t] = pairEntry{pair: pair, updatedAt: now}
+		c.mu.Unlock()
+		if pair == "" {
+			continue
+		}
+
+		if c.db != nil {
+			_, err := c.db.Exec(`INSERT INTO kraken_pairs (ticker, pair, updated_at) VALUES (?, ?, ?)
+				ON CONFLICT(ticker) DO UPDATE SET pair = excluded.pair, updated_at = excluded.updated_at`, t, pair, now)
+			if err != nil {
+				fmt.Println("Error saving Kraken pair:", err)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func openTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatalf("failed to open db: %v", err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestKrakenPairCache_FetchesOnceAndPersists(t *testing.T) {
+	db := openMigratedTestDB(t)
+	fetches := 0
+	fetch := func(ctx context.Context) ([]byte, error) {
+		fetches++
+		return []byte(`{"result": {"XXBTZUSD": {"altname": "XBTUSD"}}}`), nil
+	}
+	cache := newKrakenPairCache(db, time.Hour, fetch)
+	for i := 0; i < 3; i++ {
+		if got := cache.Resolve(context.Background(), "XBT"); got != "XXBTZUSD" {
+			t.Fatalf("expected XXBTZUSD, got %s", got)
+		}
+	}
+	if fetches != 1 {
+		t.Fatalf("expected 1 AssetPairs fetch, got %d", fetches)
+	}
+
+	// A new cache over the same database must not need the network at all
+	offline := func(ctx context.Context) ([]byte, error) { return nil, errors.New("offline") }
+	reloaded := newKrakenPairCache(db, time.Hour, offline)
+	if got := reloaded.Resolve(context.Background(), "XBT"); got != "XXBTZUSD" {
+		t.Fatalf("expected persisted XXBTZUSD, got %s", got)
+	}
+}
+
+func TestKrakenPairCache_ServesStaleDuringOutage(t *testing.T) {
+	cache := newKrakenPairCache(nil, time.Hour, func(ctx context.Context) ([]byte, error) {
+		return nil, errors.New("offline")
+	})
+	cache.entries["XBT"] = pairEntry{pair: "XXBTZUSD", updatedAt: time.Now().Add(-48 * time.Hour)}
+	cache.loaded = true
+
+	if got := cache.Resolve(context.Background(), "XBT"); got != "XXBTZUSD" {
+		t.Fatalf("expected stale XXBTZUSD, got %s", got)
+	}
+	if err := cache.Refresh(context.Background()); err == nil {
+		t.Fatalf("expected refresh error during outage")
+	}
+	if got := cache.Resolve(context.Background(), "XBT"); got != "XXBTZUSD" {
+		t.Fatalf("expected stale XXBTZUSD after failed refresh, got %s", got)
+	}
+}
+
+func TestKrakenPairCache_RemembersUnknownTicker(t *testing.T) {
+	db := openMigratedTestDB(t)
+	var fetches atomic.Int32
+	cache := newKrakenPairCache(db, time.Hour, func(ctx context.Context) ([]byte, error) {
+		fetches.Add(1)
+		return []byte(`{"result": {"XXBTZUSD": {"altname": "XBTUSD"}}}`), nil
+	})
+	for i := 0; i < 3; i++ {
+		if got := cache.Resolve(context.Background(), "NOPE"); got != "" {
+			t.Fatalf("expected no pair, got %s", got)
+		}
+	}
+	if n := fetches.Load(); n != 1 {
+		t.Fatalf("expected 1 AssetPairs fetch, got %d", n)
+	}
+
+	// Once the miss is stale it is looked up again in the background
+	cache.mu.Lock()
+	cache.entries["NOPE"] = pairEntry{updatedAt: time.Now().Add(-2 * time.Hour)}
+	cache.mu.Unlock()
+	if got := cache.Resolve(context.Background(), "NOPE"); got != "" {
+		t.Fatalf("expected no pair, got %s", got)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for fetches.Load() < 2 {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the stale miss to be refetched")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"crypto-trader/store"
+)
+
+// PaperPortfolio is the virtual account a symbol paper-trades with, ported
+// from crypto_sim.py: cash, holdings and the entry price of the open
+// position. Each symbol has its own account, persisted in paper_balances and
+// paper_positions, with every trade recorded in paper_fills.
+type PaperPortfolio struct {
+	Symbol        string
+	InitialFunds  float64
+	Cash          float64
+	Quantity      float64
+	EntryPrice    float64
+	EntryQuantity float64   // quantity bought, before any partial sells
+	OpenedAt      time.Time // zero when flat
+	FeeRate       float64   // percent, from settings.transaction_fee_rate
+}
+
+// PaperFill is one simulated trade.
+type PaperFill = store.PaperFill
+
+// paperTradingEnabled reports whether the collector paper-trades signals
+// (PAPER_TRADING, default true).
+func paperTradingEnabled() bool {
+	switch strings.ToLower(strings.TrimSpace(os.Getenv("PAPER_TRADING"))) {
+	case "0", "false", "no", "off":
+		return false
+	}
+	return true
+}
+
+// loadPaperPortfolio reads symbol's account without writing anything. The
+// account starts from settings.initial_funds, and follows changes to it until
+// the first trade stores its balance. The fee rate always comes from the
+// current settings.
+func loadPaperPortfolio(st store.Store, symbol string) (*PaperPortfolio, error) {
+	settings, err := st.LatestSettings(symbol)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read settings: %w", err)
+	}
+	a, err := st.PaperAccount(symbol)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read paper account: %w", err)
+	}
+	p := &PaperPortfolio{
+		Symbol:        symbol,
+		InitialFunds:  a.InitialFunds,
+		Cash:          a.Cash,
+		Quantity:      a.Quantity,
+		EntryPrice:    a.EntryPrice,
+		EntryQuantity: a.EntryQuantity,
+		OpenedAt:      a.OpenedAt,
+		FeeRate:       settings.FeeRate,
+	}
+	if !a.Traded {
+		p.InitialFunds, p.Cash = settings.InitialFunds, settings.InitialFunds
+	}
+	return p, nil
+}
+
+// Value returns cash plus holdings at price.
+func (p *PaperPortfolio) Value(price float64) float64 {
+	return p.Cash + p.Quantity*price
+}
+
+// ProfitLoss returns the gain over the initial funds at price, in dollars and
+// percent.
+func (p *PaperPortfolio) ProfitLoss(price float64) (float64, float64) {
+	pl := p.Value(price) - p.InitialFunds
+	if p.InitialFunds <= 0 {
+		return pl, 0
+	}
+	return pl, pl / p.InitialFunds * 100
+}
+
+// Buy spends all cash on symbol at price, less the fee. It returns nil when
+// there is no cash to spend.
+func (p *PaperPortfolio) Buy(st store.Store, price float64, signalID int64, ts time.Time) (*PaperFill, error) {
+	next, fill, err := p.buy(price, signalID, ts)
+	if err != nil || fill == nil {
+		return nil, err
+	}
+	return p.apply(st, next, fill, 0)
+}
+
+// buy returns the account state and fill Buy would store, without storing
+// them.
+func (p *PaperPortfolio) buy(price float64, signalID int64, ts time.Time) (*PaperPortfolio, *PaperFill, error) {
+	if price <= 0 {
+		return nil, nil, fmt.Errorf("price must be positive")
+	}
+	if p.Cash <= 0 {
+		return nil, nil, nil
+	}
+	fee := p.Cash * p.FeeRate / 100
+	qty := (p.Cash - fee) / price
+
+	next := *p
+	if next.Quantity == 0 {
+		next.OpenedAt = ts
+		next.EntryPrice = price
+		next.EntryQuantity = 0
+	} else {
+		// Adding to a position averages the entry price
+		next.EntryPrice = (next.Quantity*next.EntryPrice + qty*price) / (next.Quantity + qty)
+	}
+	next.Quantity += qty
+	next.EntryQuantity += qty
+	next.Cash = 0
+	return &next, &PaperFill{Side: "BUY", Price: price, Quantity: qty, Fee: fee, SignalID: signalID, Timestamp: ts}, nil
+}
+
+// Sell sells fraction (0-1] of the holdings at price, less the fee. A sell
+// taking an exit ladder tier marks ladderTier as sold along with the fill; 0
+// means no tier. It returns nil when nothing is held.
+func (p *PaperPortfolio) Sell(st store.Store, price, fraction, ladderTier float64, signalID int64, ts time.Time) (*PaperFill, error) {
+	next, fill, err := p.sell(price, fraction, signalID, ts)
+	if err != nil || fill == nil {
+		return nil, err
+	}
+	return p.apply(st, next, fill, ladderTier)
+}
+
+// sell returns the account state and fill Sell would store, without storing
+// them.
+func (p *PaperPortfolio) sell(price, fraction float64, signalID int64, ts time.Time) (*PaperPortfolio, *PaperFill, error) {
+	if price <= 0 {
+		return nil, nil, fmt.Errorf("price must be positive")
+	}
+	if fraction <= 0 || fraction > 1 {
+		return nil, nil, fmt.Errorf("fraction must be between 0 and 1")
+	}
+	if p.Quantity <= 0 {
+		return nil, nil, nil
+	}
+	qty := p.Quantity * fraction
+	gross := qty * price
+	fee := gross * p.FeeRate / 100
+
+	next := *p
+	next.Cash += gross - fee
+	next.Quantity -= qty
+	if fraction == 1 {
+		next.Quantity, next.EntryPrice, next.EntryQuantity, next.OpenedAt = 0, 0, 0, time.Time{}
+	}
+	return &next, &PaperFill{Side: "SELL", Price: price, Quantity: qty, Fee: fee, SignalID: signalID, Timestamp: ts}, nil
+}
+
+// apply stores the account state next, the fill that produced it and the
+// exit ladder tier it took, if any, in one transaction, then updates p. The
+// first fill creates the balance from the funds the account started with.
+func (p *PaperPortfolio) apply(st store.Store, next *PaperPortfolio, fill *PaperFill, ladderTier float64) (*PaperFill, error) {
+	fill.Symbol = p.Symbol
+	fill.Cash, fill.Holdings = next.Cash, next.Quantity
+
+	var hit *store.LadderHit
+	if ladderTier > 0 {
+		hit = &store.LadderHit{Symbol: p.Symbol, OpenedAt: p.OpenedAt, Tier: ladderTier,
+			Price: fill.Price, Quantity: fill.Quantity, Timestamp: fill.Timestamp}
+	}
+	id, err := st.RecordPaperFill(store.PaperAccount{
+		Symbol:        p.Symbol,
+		InitialFunds:  next.InitialFunds,
+		Cash:          next.Cash,
+		Quantity:      next.Quantity,
+		EntryPrice:    next.EntryPrice,
+		EntryQuantity: next.EntryQuantity,
+		OpenedAt:      next.OpenedAt,
+	}, *fill, hit)
+	if err != nil {
+		return nil, err
+	}
+	fill.ID = id
+	*p = *next
+	return fill, nil
+}
+
+// paperTrade acts on a BUY or SELL signal for symbol: BUY invests all cash,
+// SELL sells signal.Quantity, or the whole position when it is 0. Partial
+// sells from the exit ladder mark their tier as sold in the same
+// transaction. When check is set it is run on the proposed fill first, and
+// an error from it leaves the account untouched and is returned. It returns
+// the fill, or nil if the signal did not trade.
+func paperTrade(st store.Store, symbol string, signal *TradingSignal, signalID int64, ts time.Time, check func(*PaperFill) error) (*PaperFill, *PaperPortfolio, error) {
+	p, err := loadPaperPortfolio(st, symbol)
+	if err != nil {
+		return nil, nil, err
+	}
+	var next *PaperPortfolio
+	var fill *PaperFill
+	var ladderTier float64
+	switch signal.Action {
+	case "BUY":
+		next, fill, err = p.buy(signal.CurrentPrice, signalID, ts)
+	case "SELL":
+		fraction := 1.0
+		if signal.Quantity > 0 && p.Quantity > 0 && signal.Quantity < p.Quantity {
+			fraction = signal.Quantity / p.Quantity
+		}
+		next, fill, err = p.sell(signal.CurrentPrice, fraction, signalID, ts)
+		ladderTier = signal.ExitTier
+	}
+	if err != nil || fill == nil {
+		return nil, p, err
+	}
+	if check != nil {
+		if err := check(fill); err != nil {
+			return nil, p, err
+		}
+	}
+	fill, err = p.apply(st, next, fill, ladderTier)
+	return fill, p, err
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"crypto-trader/store"
+)
+
+func TestPaperPortfolio_StartsFromSettingsUntilFirstTrade(t *testing.T) {
+	db := openMigratedTestDB(t)
+	db.Exec(`INSERT INTO settings (symbol, initial_funds, transaction_fee_rate) VALUES ('', 500, 0.5)`)
+
+	p, err := loadPaperPortfolio(store.New(db), "XBT")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if p.Cash != 500 || p.FeeRate != 0.5 {
+		t.Fatalf("expected $500 cash at 0.5%% fee, got %+v", p)
+	}
+	var balances int
+	db.QueryRow(`SELECT COUNT(*) FROM paper_balances`).Scan(&balances)
+	if balances != 0 {
+		t.Fatalf("expected loading to write no balance, got %d rows", balances)
+	}
+
+	// A symbol-specific setting wins, and is picked up while no trade exists
+	db.Exec(`INSERT INTO settings (symbol, initial_funds, transaction_fee_rate) VALUES ('XBT', 1000, 0.1)`)
+	if p, _ = loadPaperPortfolio(store.New(db), "XBT"); p.Cash != 1000 || p.InitialFunds != 1000 || p.FeeRate != 0.1 {
+		t.Fatalf("expected $1000 cash at 0.1%% fee, got %+v", p)
+	}
+
+	if _, err := p.Buy(store.New(db), 100, 0, time.Now()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	db.Exec(`INSERT INTO settings (symbol, initial_funds) VALUES ('XBT', 2000)`)
+	if p, _ = loadPaperPortfolio(store.New(db), "XBT"); p.InitialFunds != 1000 || p.Cash != 0 {
+		t.Fatalf("expected the traded account to keep its funds, got %+v", p)
+	}
+}
+
+func TestPaperTrade_BuySellChargesFeesAndPersists(t *testing.T) {
+	db := openMigratedTestDB(t)
+	db.Exec(`INSERT INTO settings (initial_funds, transaction_fee_rate) VALUES (1000, 1)`)
+	ts := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	fill, p, err := paperTrade(store.New(db), "XBT", &TradingSignal{Action: "BUY", CurrentPrice: 100}, 7, ts, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if fill == nil || fill.Fee != 10 || math.Abs(fill.Quantity-9.9) > 1e-12 || p.Cash != 0 || p.EntryPrice != 100 {
+		t.Fatalf("unexpected buy: fill %+v, portfolio %+v", fill, p)
+	}
+
+	// A second BUY has no cash to spend
+	if fill, _, _ := paperTrade(store.New(db), "XBT", &TradingSignal{Action: "BUY", CurrentPrice: 90}, 8, ts.Add(time.Hour), nil); fill != nil {
+		t.Fatalf("expected no fill without cash, got %+v", fill)
+	}
+
+	fill, p, err = paperTrade(store.New(db), "XBT", &TradingSignal{Action: "SELL", CurrentPrice: 120}, 9, ts.Add(2*time.Hour), nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	wantCash := 9.9 * 120 * 0.99
+	if math.Abs(p.Cash-wantCash) > 1e-9 || p.Quantity != 0 || !p.OpenedAt.IsZero() {
+		t.Fatalf("unexpected portfolio after sell: %+v", p)
+	}
+
+	// State survives a reload
+	reloaded, err := loadPaperPortfolio(store.New(db), "XBT")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if math.Abs(reloaded.Cash-wantCash) > 1e-9 || reloaded.Quantity != 0 {
+		t.Fatalf("expected cash %.4f after reload, got %+v", wantCash, reloaded)
+	}
+	fills, err := store.New(db).PaperFills("XBT", 10)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(fills) != 2 || fills[0].Side != "SELL" || fills[1].SignalID != 7 {
+		t.Fatalf("unexpected fills: %+v", fills)
+	}
+	if _, pct := reloaded.ProfitLoss(120); math.Abs(pct-(wantCash/1000-1)*100) > 1e-9 {
+		t.Fatalf("unexpected profit percent %v", pct)
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"crypto-trader/store"
+)
+
+// openPostgresTestDB returns a migrated PostgreSQL database in a fresh schema
+// of TEST_DATABASE_URL, dropped when the test ends. The tests are skipped
+// when TEST_DATABASE_URL is unset; see the README for a local container.
+func openPostgresTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+	admin, err := store.Open(url)
+	if err != nil {
+		t.Fatalf("failed to open db: %v", err)
+	}
+	t.Cleanup(func() { admin.Close() })
+	schema := fmt.Sprintf("test_%d", time.Now().UnixNano())
+	if _, err := admin.Exec(`CREATE SCHEMA ` + schema); err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+	t.Cleanup(func() { admin.Exec(`DROP SCHEMA ` + schema + ` CASCADE`) })
+
+	sep := "?"
+	if strings.Contains(url, "?") {
+		sep = "&"
+	}
+	db, err := store.Open(url + sep + "search_path=" + schema)
+	if err != nil {
+		t.Fatalf("failed to open db: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if _, err := migrateUp(db, 0); err != nil {
+		t.Fatalf("migration failed: %v", err)
+	}
+	return db
+}
+
+func TestPostgres_Migrations(t *testing.T) {
+	db := openPostgresTestDB(t)
+	migrations, _ := loadMigrations(store.Postgres)
+	if v, _ := schemaVersion(db); v != len(migrations) {
+		t.Fatalf("expected version %d, got %d", len(migrations), v)
+	}
+	if _, err := migrateDown(db, len(migrations)); err == nil {
+		t.Fatalf("expected the baseline to be irreversible")
+	}
+	if _, err := migrateUp(db, 0); err != nil {
+		t.Fatalf("expected migrations to re-apply, got %v", err)
+	}
+}
+
+func TestPostgres_Queries(t *testing.T) {
+	db := openPostgresTestDB(t)
+	st := store.New(db)
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	id, err := st.InsertPrice("XBT", 100, start)
+	if err != nil || id == 0 {
+		t.Fatalf("expected a price id, got %d, %v", id, err)
+	}
+	st.InsertPrice("XBT", 105, start.Add(time.Minute))
+	if latest, err := st.LatestPrice("XBT"); err != nil || latest.Price != 105 {
+		t.Fatalf("expected 105, got %+v, %v", latest, err)
+	}
+	if _, err := st.InsertSignal(store.Signal{PriceID: id, Symbol: "XBT", Action: "BUY", Price: 100, Timestamp: start}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if signals, err := st.SignalsSince("XBT", start); err != nil || len(signals) != 1 || signals[0].Reason != "strategy" {
+		t.Fatalf("expected one strategy signal, got %+v, %v", signals, err)
+	}
+	st.SaveSettings(store.Settings{Symbol: "XBT", InitialFunds: 1000, FeeRate: 0.2})
+	if settings, err := st.LatestSettings("XBT"); err != nil || settings.InitialFunds != 1000 {
+		t.Fatalf("expected the saved settings, got %+v, %v", settings, err)
+	}
+
+	for i, price := range []float64{100, 110, 90, 95} {
+		if err := store.New(db).RollUpTicks(store.Price{ID: int64(i + 1), Symbol: "XBT", Price: price, Timestamp: start.Add(time.Duration(i) * time.Second)}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	candles, err := st.CandlesSince("XBT", 1, start)
+	if err != nil || len(candles) != 1 {
+		t.Fatalf("expected one 1m candle, got %+v, %v", candles, err)
+	}
+	if c := candles[0]; c.Open != 100 || c.High != 110 || c.Low != 90 || c.Close != 95 || c.Count != 4 {
+		t.Fatalf("unexpected candle %+v", c)
+	}
+	var rolledUp int64
+	if err := db.QueryRow(`SELECT price_id FROM candle_rollup WHERE symbol = 'XBT'`).Scan(&rolledUp); err != nil || rolledUp != 4 {
+		t.Fatalf("expected ticks rolled up to price 4, got %d, %v", rolledUp, err)
+	}
+
+	if err := store.New(db).SetTradingHalt(true, "test"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if halt, err := store.New(db).TradingHalt(); err != nil || !halt.Halted || halt.Reason != "test" {
+		t.Fatalf("expected trading halted, got %+v, %v", halt, err)
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Quote is a single price observation returned by a PriceSource.
+type Quote struct {
+	Symbol    string
+	Price     float64 // last traded price
+	Bid       float64
+	Ask       float64
+	Volume    float64   // 24h volume in the base asset
+	Timestamp time.Time // exchange timestamp, or fetch time if the exchange doesn't report one
+	Source    string    // URL or description of where the quote came from
+}
+
+// PriceSource is implemented by every exchange adapter the collector can poll.
+type PriceSource interface {
+	Name() string
+	Quote(ctx context.Context, symbol string) (*Quote, error)
+}
+
+// priceSources holds the constructors for every known exchange adapter, keyed by
+// the name used in the PRICE_SOURCE setting. Adapters may use db for caching.
+var priceSources = map[string]func(db *sql.DB) (PriceSource, error){
+	"kraken": func(db *sql.DB) (PriceSource, error) {
+		return NewKrakenSource(db, krakenPairTTL()), nil
+	},
+	"kraken-ws": func(db *sql.DB) (PriceSource, error) {
+		return NewKrakenStream(NewKrakenSource(db, krakenPairTTL())), nil
+	},
+	"coinbase": func(db *sql.DB) (PriceSource, error) { return NewCoinbaseSource(), nil },
+}
+
+// krakenPairTTL reads how long resolved Kraken asset pairs stay cached.
+func krakenPairTTL() time.Duration {
+	if val := os.Getenv("KRAKEN_PAIR_TTL_HOURS"); val != "" {
+		if n, err := strconv.Atoi(val); err == nil && n > 0 {
+			return time.Duration(n) * time.Hour
+		}
+	}
+	return defaultPairCacheTTL
+}
+
+// newPriceSource returns the adapter registered under name. An empty name
+// selects Kraken.
+func newPriceSource(name string, db *sql.DB) (PriceSource, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" {
+		name = "kraken"
+	}
+	ctor, ok := priceSources[name]
+	if !ok {
+		var names []string
+		for n := range priceSources {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("unknown price source %q (available: %s)", name, strings.Join(names, ", "))
+	}
+	return ctor(db)
+}
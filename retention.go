@@ -0,0 +1,195 @@
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"crypto-trader/store"
+)
+
+// RetentionPolicy says how long raw ticks and minute candles are kept. Older
+// data survives in the coarser candles: ticks in the 1m/5m/1h/1d candles
+// they were rolled into, minute candles in the hourly and daily ones.
+type RetentionPolicy struct {
+	RawDays    int // btc_price rows older than this are deleted; 0 keeps them
+	CandleDays int // 1m and 5m candles older than this are deleted; 0 keeps them
+}
+
+// Enabled reports whether the policy deletes anything.
+func (p RetentionPolicy) Enabled() bool {
+	return p.RawDays > 0 || p.CandleDays > 0
+}
+
+// RetentionResult is what applyRetention did for one symbol.
+type RetentionResult struct {
+	Symbol         string
+	PricesDeleted  int64
+	PricesKept     int64 // past the cutoff but referenced by a signal
+	CandlesDeleted int64
+}
+
+// configuredRetention reads RETENTION_RAW_DAYS and RETENTION_CANDLE_DAYS.
+func configuredRetention() (RetentionPolicy, error) {
+	var p RetentionPolicy
+	for _, f := range []struct {
+		env string
+		dst *int
+	}{
+		{"RETENTION_RAW_DAYS", &p.RawDays},
+		{"RETENTION_CANDLE_DAYS", &p.CandleDays},
+	} {
+		val := strings.TrimSpace(os.Getenv(f.env))
+		if val == "" {
+			continue
+		}
+		n, err := strconv.Atoi(val)
+		if err != nil || n < 0 {
+			return p, fmt.Errorf("invalid %s %q", f.env, val)
+		}
+		*f.dst = n
+	}
+	return p, nil
+}
+
+// applyRetention deletes the data policy no longer keeps for every symbol.
+// A tick is only deleted once it has been rolled up into candles, and never
+// when a trading signal references it or it is part of an open position
+// (trailing stops need the high since entry). It does not vacuum.
+func applyRetention(db *sql.DB, policy RetentionPolicy, now time.Time) ([]RetentionResult, error) {
+	symbols, err := store.New(db).Symbols()
+	if err != nil {
+		return nil, err
+	}
+	var results []RetentionResult
+	for _, symbol := range symbols {
+		r := RetentionResult{Symbol: symbol}
+		if policy.RawDays > 0 {
+			if r.PricesDeleted, r.PricesKept, err = deleteOldTicks(db, symbol, now.AddDate(0, 0, -policy.RawDays)); err != nil {
+				return results, fmt.Errorf("failed to delete %s ticks: %w", symbol, err)
+			}
+		}
+		if policy.CandleDays > 0 {
+			res, err := db.Exec(`DELETE FROM candles WHERE symbol = ? AND interval < 60 AND time < ?`,
+				symbol, now.AddDate(0, 0, -policy.CandleDays).UTC())
+			if err != nil {
+				return results, fmt.Errorf("failed to delete %s candles: %w", symbol, err)
+			}
+			r.CandlesDeleted, _ = res.RowsAffected()
+		}
+		results = append(results, r)
+	}
+	return results, nil
+}
+
+// deleteOldTicks deletes symbol's rolled-up ticks from before cutoff and
+// returns how many were deleted and how many signals kept.
+func deleteOldTicks(db *sql.DB, symbol string, cutoff time.Time) (deleted, kept int64, err error) {
+	// Keep the ticks of the position the stop rules track, whether it comes
+	// from the paper portfolio or from the signals
+	for _, paper := range []bool{true, false} {
+		pos, err := openPosition(store.New(db), symbol, paper)
+		if err != nil {
+			return 0, 0, err
+		}
+		if pos != nil && pos.EntryTime.Before(cutoff) {
+			cutoff = pos.EntryTime
+		}
+	}
+
+	// Ticks after the last one rolled up only exist as raw rows so far
+	var rolledUp int64
+	err = db.QueryRow(`SELECT price_id FROM candle_rollup WHERE symbol = ?`, symbol).Scan(&rolledUp)
+	if err == sql.ErrNoRows {
+		return 0, 0, nil
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+
+	res, err := db.Exec(`DELETE FROM btc_price WHERE symbol = ? AND timestamp < ? AND id <= ?
+		AND id NOT IN (SELECT price_id FROM trading_signals WHERE price_id IS NOT NULL)`,
+		symbol, cutoff.UTC(), rolledUp)
+	if err != nil {
+		return 0, 0, err
+	}
+	deleted, _ = res.RowsAffected()
+	err = db.QueryRow(`SELECT COUNT(*) FROM btc_price WHERE symbol = ? AND timestamp < ? AND id <= ?`,
+		symbol, cutoff.UTC(), rolledUp).Scan(&kept)
+	return deleted, kept, err
+}
+
+// vacuumDatabase returns the space freed by deleted rows to the file system
+// (SQLite) or to the tables (PostgreSQL).
+func vacuumDatabase(db *sql.DB) error {
+	if store.DialectOf(db) == store.Postgres {
+		_, err := db.Exec(`VACUUM ANALYZE btc_price, candles`)
+		return err
+	}
+	_, err := db.Exec(`VACUUM`)
+	return err
+}
+
+// runRetention applies policy and vacuums, printing what was deleted.
+func runRetention(db *sql.DB, policy RetentionPolicy, now time.Time) error {
+	results, err := applyRetention(db, policy, now)
+	var total int64
+	for _, r := range results {
+		total += r.PricesDeleted + r.CandlesDeleted
+		if r.PricesDeleted+r.PricesKept+r.CandlesDeleted > 0 {
+			fmt.Printf("Retention %s: %d ticks deleted (%d kept for signals), %d minute candles deleted\n",
+				r.Symbol, r.PricesDeleted, r.PricesKept, r.CandlesDeleted)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if total == 0 {
+		return nil
+	}
+	return vacuumDatabase(db)
+}
+
+// retentionLoop runs the retention policy now and then once a day.
+func retentionLoop(db *sql.DB, policy RetentionPolicy) {
+	for {
+		if err := runRetention(db, policy, time.Now().UTC()); err != nil {
+			fmt.Println("Error applying retention:", err)
+		}
+		time.Sleep(24 * time.Hour)
+	}
+}
+
+// retentionCommand applies the retention policy once, e.g.
+// retention -raw-days 30 -candle-days 365.
+func retentionCommand(args []string) {
+	policy, err := configuredRetention()
+	if err != nil {
+		panic(err)
+	}
+	fs := flag.NewFlagSet("retention", flag.ExitOnError)
+	rawDays := fs.Int("raw-days", policy.RawDays, "Days of raw ticks to keep (0 keeps all)")
+	candleDays := fs.Int("candle-days", policy.CandleDays, "Days of 1m and 5m candles to keep (0 keeps all)")
+	fs.Parse(args)
+	policy = RetentionPolicy{RawDays: *rawDays, CandleDays: *candleDays}
+	if !policy.Enabled() {
+		fmt.Println("Nothing to do: set -raw-days or -candle-days (or RETENTION_RAW_DAYS / RETENTION_CANDLE_DAYS)")
+		os.Exit(1)
+	}
+
+	db, err := openDatabase()
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	defer db.Close()
+
+	if err := runRetention(db, policy, time.Now().UTC()); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+}
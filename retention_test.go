@@ -0,0 +1,83 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"crypto-trader/store"
+)
+
+func TestApplyRetention_KeepsReferencedAndRecentTicks(t *testing.T) {
+	db := openMigratedTestDB(t)
+	st := store.New(db)
+	now := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	var ids []int64
+	for i, age := range []int{40, 35, 31, 5} {
+		ts := now.AddDate(0, 0, -age)
+		id, _ := st.InsertPrice("XBT", float64(100+i), ts)
+		if err := store.New(db).RollUpTicks(store.Price{ID: id, Symbol: "XBT", Price: float64(100 + i), Timestamp: ts}); err != nil {
+			t.Fatalf("setup failed: %v", err)
+		}
+		ids = append(ids, id)
+	}
+	// Not rolled up into candles yet
+	st.InsertPrice("XBT", 99, now.AddDate(0, 0, -45))
+	st.InsertSignal(store.Signal{PriceID: ids[1], Symbol: "XBT", Action: "SELL", Price: 101, Timestamp: now.AddDate(0, 0, -35)})
+
+	results, err := applyRetention(db, RetentionPolicy{RawDays: 30}, now)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(results) != 1 || results[0].PricesDeleted != 2 || results[0].PricesKept != 1 {
+		t.Fatalf("expected 2 ticks deleted and 1 kept, got %+v", results)
+	}
+	remaining, _ := st.PricesSince("XBT", time.Time{})
+	if len(remaining) != 3 || remaining[1].ID != ids[1] || remaining[2].ID != ids[3] {
+		t.Fatalf("expected the unrolled, referenced and recent ticks, got %+v", remaining)
+	}
+	if candles, _ := st.CandlesSince("XBT", 1440, time.Time{}); len(candles) != 4 {
+		t.Fatalf("expected the daily candles kept, got %d", len(candles))
+	}
+	if err := vacuumDatabase(db); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestApplyRetention_KeepsOpenPositionTicks(t *testing.T) {
+	db := openMigratedTestDB(t)
+	st := store.New(db)
+	now := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	entry := now.AddDate(0, 0, -20)
+	for i, ts := range []time.Time{now.AddDate(0, 0, -25), entry, now.AddDate(0, 0, -15), now} {
+		id, _ := st.InsertPrice("XBT", float64(100+10*i), ts)
+		store.New(db).RollUpTicks(store.Price{ID: id, Symbol: "XBT", Price: float64(100 + 10*i), Timestamp: ts})
+		if ts.Equal(entry) {
+			st.InsertSignal(store.Signal{PriceID: id, Symbol: "XBT", Action: "BUY", Price: 110, Timestamp: entry})
+		}
+	}
+
+	if _, err := applyRetention(db, RetentionPolicy{RawDays: 7, CandleDays: 10}, now); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if pos, _ := openPosition(store.New(db), "XBT", false); pos == nil || pos.High != 130 {
+		t.Fatalf("expected the high since entry kept, got %+v", pos)
+	}
+	if remaining, _ := st.PricesSince("XBT", time.Time{}); len(remaining) != 3 {
+		t.Fatalf("expected the ticks since entry kept, got %+v", remaining)
+	}
+	if minutes, _ := st.CandlesSince("XBT", 1, time.Time{}); len(minutes) != 1 {
+		t.Fatalf("expected only the recent 1m candle, got %+v", minutes)
+	}
+	if hours, _ := st.CandlesSince("XBT", 60, time.Time{}); len(hours) != 4 {
+		t.Fatalf("expected every hourly candle kept, got %+v", hours)
+	}
+}
+
+func TestChartInterval(t *testing.T) {
+	for days, want := range map[int]int{1: 0, 2: 5, 7: 5, 30: 60, 365: 1440} {
+		if got := chartInterval(days); got != want {
+			t.Fatalf("expected %d days at %dm, got %dm", days, want, got)
+		}
+	}
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"crypto-trader/store"
+)
+
+// RiskLimits are the pre-trade checks every live order must pass before it
+// is sent. Zero values disable a limit. Sells only have to pass the kill
+// switch and the symbol allow-list: the order size, rate, position size and
+// daily loss limits only block buys, so exits are never held back by them.
+type RiskLimits struct {
+	MaxPosition      float64         // USD value of the position after a buy
+	MaxOrderNotional float64         // USD value of a single order
+	MaxDailyLoss     float64         // USD lost by the portfolio since UTC midnight
+	MaxTradesPerHour int             // orders sent in the last hour, sells included
+	AllowedSymbols   map[string]bool // nil allows every symbol
+
+	// CountFills counts the trades of the last hour in paper_fills instead of
+	// orders, for dry runs without credentials that record no orders.
+	CountFills bool
+}
+
+// RiskViolation is a failed pre-trade check.
+type RiskViolation struct {
+	Rule    string // kill_switch, symbol, max_order_usd, max_position_usd, max_daily_loss_usd, max_trades_per_hour
+	Message string
+}
+
+func (v *RiskViolation) Error() string {
+	return v.Rule + ": " + v.Message
+}
+
+// configuredRiskLimits reads RISK_MAX_POSITION_USD, RISK_MAX_ORDER_USD,
+// RISK_MAX_DAILY_LOSS_USD, RISK_MAX_TRADES_PER_HOUR and
+// RISK_ALLOWED_SYMBOLS.
+func configuredRiskLimits() (*RiskLimits, error) {
+	r := &RiskLimits{}
+	for _, f := range []struct {
+		env string
+		dst *float64
+	}{
+		{"RISK_MAX_POSITION_USD", &r.MaxPosition},
+		{"RISK_MAX_ORDER_USD", &r.MaxOrderNotional},
+		{"RISK_MAX_DAILY_LOSS_USD", &r.MaxDailyLoss},
+	} {
+		val := strings.TrimSpace(os.Getenv(f.env))
+		if val == "" {
+			continue
+		}
+		n, err := strconv.ParseFloat(val, 64)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid %s %q", f.env, val)
+		}
+		*f.dst = n
+	}
+	if val := strings.TrimSpace(os.Getenv("RISK_MAX_TRADES_PER_HOUR")); val != "" {
+		n, err := strconv.Atoi(val)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid RISK_MAX_TRADES_PER_HOUR %q", val)
+		}
+		r.MaxTradesPerHour = n
+	}
+	if val := strings.TrimSpace(os.Getenv("RISK_ALLOWED_SYMBOLS")); val != "" {
+		r.AllowedSymbols = make(map[string]bool)
+		for _, s := range strings.Split(val, ",") {
+			if s = normalizeSymbol(s); s != "" {
+				r.AllowedSymbols[s] = true
+			}
+		}
+	}
+	return r, nil
+}
+
+// Check runs the pre-trade checks for order on symbol at price, and returns
+// the first one that fails, or nil.
+func (r *RiskLimits) Check(st store.Store, symbol string, order OrderRequest, price float64, now time.Time) (*RiskViolation, error) {
+	halt, err := st.TradingHalt()
+	if err != nil {
+		return nil, err
+	}
+	if halt.Halted {
+		return &RiskViolation{"kill_switch", "trading halted: " + halt.Reason}, nil
+	}
+	if r.AllowedSymbols != nil && !r.AllowedSymbols[symbol] {
+		return &RiskViolation{"symbol", symbol + " is not in RISK_ALLOWED_SYMBOLS"}, nil
+	}
+	if order.Side != "buy" {
+		return nil, nil
+	}
+	notional := order.Volume * price
+	if r.MaxOrderNotional > 0 && notional > r.MaxOrderNotional {
+		return &RiskViolation{"max_order_usd", fmt.Sprintf("order $%.2f over limit $%.2f", notional, r.MaxOrderNotional)}, nil
+	}
+	if r.MaxTradesPerHour > 0 {
+		n, err := r.tradesSince(st, now.Add(-time.Hour))
+		if err != nil {
+			return nil, err
+		}
+		if n >= r.MaxTradesPerHour {
+			return &RiskViolation{"max_trades_per_hour", fmt.Sprintf("%d orders in the last hour, limit %d", n, r.MaxTradesPerHour)}, nil
+		}
+	}
+	if r.MaxPosition > 0 {
+		held, err := liveExposure(st, symbol)
+		if err != nil {
+			return nil, err
+		}
+		if value := (held + order.Volume) * price; value > r.MaxPosition {
+			return &RiskViolation{"max_position_usd", fmt.Sprintf("position would be $%.2f, limit $%.2f", value, r.MaxPosition)}, nil
+		}
+	}
+	if r.MaxDailyLoss > 0 {
+		loss, err := dailyLoss(st, symbol, price, now)
+		if err != nil {
+			return nil, err
+		}
+		if loss >= r.MaxDailyLoss {
+			return &RiskViolation{"max_daily_loss_usd", fmt.Sprintf("lost $%.2f today, limit $%.2f", loss, r.MaxDailyLoss)}, nil
+		}
+	}
+	return nil, nil
+}
+
+// tradesSince returns how many orders, or with CountFills paper fills, were
+// made since since. Orders Kraken rejected do not count.
+func (r *RiskLimits) tradesSince(st store.Store, since time.Time) (int, error) {
+	if r.CountFills {
+		fills, err := st.PaperFillsSince("", since)
+		return len(fills), err
+	}
+	orders, err := st.OrdersSince("", since)
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, o := range orders {
+		if o.Status != OrderRejected {
+			n++
+		}
+	}
+	return n, nil
+}
+
+// liveExposure returns the quantity of symbol held through orders: filled
+// buys less filled sells, plus what open buys may still add.
+func liveExposure(st store.Store, symbol string) (float64, error) {
+	orders, err := st.OrdersSince(symbol, time.Time{})
+	if err != nil {
+		return 0, err
+	}
+	var held float64
+	for _, o := range orders {
+		switch {
+		case o.Side != "buy":
+			held -= o.FilledVolume
+		case o.Status == OrderSubmitted || o.Status == OrderPartiallyFilled:
+			held += o.Volume
+		default:
+			held += o.FilledVolume
+		}
+	}
+	return held, nil
+}
+
+// dailyLoss returns how much the paper portfolio, which live orders mirror,
+// has lost since UTC midnight at price. Gains count as no loss.
+func dailyLoss(st store.Store, symbol string, price float64, now time.Time) (float64, error) {
+	p, err := loadPaperPortfolio(st, symbol)
+	if err != nil {
+		return 0, err
+	}
+	midnight := now.UTC().Truncate(24 * time.Hour)
+
+	startCash, startHoldings := p.InitialFunds, 0.0
+	fill, err := st.PaperFillBefore(symbol, midnight)
+	if err == nil {
+		startCash, startHoldings = fill.Cash, fill.Holdings
+	} else if err != store.ErrNotFound {
+		return 0, err
+	}
+	startPrice := price
+	if startHoldings > 0 {
+		tick, err := st.PriceBefore(symbol, midnight)
+		if err == nil {
+			startPrice = tick.Price
+		} else if err != store.ErrNotFound {
+			return 0, err
+		}
+	}
+
+	loss := startCash + startHoldings*startPrice - p.Value(price)
+	if loss < 0 {
+		loss = 0
+	}
+	return loss, nil
+}
+
+// haltTrading sets the kill switch and cancels every open order through
+// orders (which may be nil when live trading is off). It returns how many
+// orders were cancelled.
+func haltTrading(ctx context.Context, st store.Store, orders *OrderManager, reason string) (int, error) {
+	if reason == "" {
+		reason = "kill switch"
+	}
+	if err := st.SetTradingHalt(true, reason); err != nil {
+		return 0, err
+	}
+	if orders == nil {
+		return 0, nil
+	}
+	return orders.CancelOpen(ctx)
+}
+
+// killSwitchOrders returns the order manager the kill switch cancels open
+// orders through. Credentials are used whenever they are set, even if
+// LIVE_TRADING has since been turned off; without them it returns nil.
+func killSwitchOrders(st store.Store) (*OrderManager, error) {
+	key, secret := os.Getenv("KRAKEN_API_KEY"), os.Getenv("KRAKEN_API_SECRET")
+	if key == "" && secret == "" {
+		return nil, nil
+	}
+	client, err := NewKrakenPrivateClient(key, secret)
+	if err != nil {
+		return nil, err
+	}
+	return newOrderManager(st, client), nil
+}
+
+// killSwitchCommand halts trading and cancels open orders, or with -resume
+// lets trading continue.
+func killSwitchCommand(args []string) {
+	fs := flag.NewFlagSet("killswitch", flag.ExitOnError)
+	reason := fs.String("reason", "", "Why trading is halted, shown in rejected signals")
+	resume := fs.Bool("resume", false, "Clear the kill switch and resume trading")
+	fs.Parse(args)
+
+	db, err := openDatabase()
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	defer db.Close()
+	st := store.New(db)
+
+	if *resume {
+		if err := st.SetTradingHalt(false, ""); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		fmt.Println("Trading resumed")
+		return
+	}
+
+	orders, err := killSwitchOrders(st)
+	if err != nil {
+		fmt.Println("Open orders cannot be cancelled:", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	n, err := haltTrading(ctx, st, orders, *reason)
+	if err != nil {
+		fmt.Println("Error halting trading:", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Trading halted, %d open orders cancelled\n", n)
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"crypto-trader/store"
+)
+
+func TestRiskLimits_Check(t *testing.T) {
+	db := openMigratedTestDB(t)
+	now := time.Date(2026, 8, 2, 12, 0, 0, 0, time.UTC)
+	buy := OrderRequest{Pair: "XBTUSD", Side: "buy", Volume: 0.01}
+	sell := OrderRequest{Pair: "XBTUSD", Side: "sell", Volume: 0.01}
+
+	rule := func(r *RiskLimits, symbol string, order OrderRequest, price float64) string {
+		t.Helper()
+		v, err := r.Check(store.New(db), symbol, order, price, now)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if v == nil {
+			return ""
+		}
+		return v.Rule
+	}
+
+	if got := rule(&RiskLimits{}, "XBT", buy, 50000); got != "" {
+		t.Fatalf("expected no limits to pass, got %s", got)
+	}
+	if got := rule(&RiskLimits{AllowedSymbols: map[string]bool{"ETH": true}}, "XBT", sell, 50000); got != "symbol" {
+		t.Fatalf("expected symbol rule, got %q", got)
+	}
+	if got := rule(&RiskLimits{MaxOrderNotional: 400}, "XBT", buy, 50000); got != "max_order_usd" {
+		t.Fatalf("expected the $500 order over $400 to fail, got %q", got)
+	}
+	if got := rule(&RiskLimits{MaxOrderNotional: 400}, "XBT", sell, 50000); got != "" {
+		t.Fatalf("expected sells to pass the order size limit, got %s", got)
+	}
+
+	// A filled buy of 0.02 plus this 0.01 is $1500 at $50000
+	db.Exec(`INSERT INTO orders (symbol, pair, side, order_type, volume, status, filled_volume, created_at) VALUES ('XBT', 'XBTUSD', 'buy', 'market', 0.02, ?, 0.02, ?)`,
+		OrderFilled, now.Add(-10*time.Minute))
+	limits := &RiskLimits{MaxPosition: 1000}
+	if got := rule(limits, "XBT", buy, 50000); got != "max_position_usd" {
+		t.Fatalf("expected max_position_usd, got %q", got)
+	}
+	if got := rule(limits, "XBT", sell, 50000); got != "" {
+		t.Fatalf("expected sells to pass the position limit, got %s", got)
+	}
+	if got := rule(&RiskLimits{MaxTradesPerHour: 1}, "XBT", buy, 50000); got != "max_trades_per_hour" {
+		t.Fatalf("expected max_trades_per_hour, got %q", got)
+	}
+	if got := rule(&RiskLimits{MaxTradesPerHour: 1}, "XBT", sell, 50000); got != "" {
+		t.Fatalf("expected sells to pass the trade rate limit, got %s", got)
+	}
+
+	// Without recorded orders the paper fills of the last hour count
+	fills := &RiskLimits{MaxTradesPerHour: 1, CountFills: true}
+	if got := rule(fills, "XBT", buy, 50000); got != "" {
+		t.Fatalf("expected no fills in the last hour to pass, got %s", got)
+	}
+	db.Exec(`INSERT INTO paper_fills (symbol, side, price, quantity, fee, cash, holdings, timestamp) VALUES ('ETH', 'BUY', 3000, 1, 0, 0, 1, ?)`, now.Add(-30*time.Minute))
+	if got := rule(fills, "XBT", buy, 50000); got != "max_trades_per_hour" {
+		t.Fatalf("expected the fill to count against the limit, got %q", got)
+	}
+
+	// The paper portfolio went into the day holding 0.02 at $50000 and the
+	// price has since fallen to $45000
+	db.Exec(`INSERT INTO settings (initial_funds, transaction_fee_rate) VALUES (1000, 0)`)
+	db.Exec(`INSERT INTO paper_fills (symbol, side, price, quantity, fee, cash, holdings, timestamp) VALUES ('XBT', 'BUY', 50000, 0.02, 0, 0, 0.02, ?)`, now.Add(-24*time.Hour))
+	db.Exec(`INSERT INTO paper_positions (symbol, quantity, entry_price, entry_quantity, opened_at) VALUES ('XBT', 0.02, 50000, 0.02, ?)`, now.Add(-24*time.Hour))
+	db.Exec(`INSERT INTO paper_balances (symbol, initial_funds, cash) VALUES ('XBT', 1000, 0)`)
+	db.Exec(`INSERT INTO btc_price (symbol, price, timestamp) VALUES ('XBT', 50000, ?)`, now.Add(-13*time.Hour))
+	if loss, err := dailyLoss(store.New(db), "XBT", 45000, now); err != nil || loss != 100 {
+		t.Fatalf("expected a $100 loss today, got %v, %v", loss, err)
+	}
+	if got := rule(&RiskLimits{MaxDailyLoss: 100}, "XBT", buy, 45000); got != "max_daily_loss_usd" {
+		t.Fatalf("expected max_daily_loss_usd, got %q", got)
+	}
+
+	if err := store.New(db).SetTradingHalt(true, "maintenance"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := rule(&RiskLimits{}, "XBT", sell, 50000); got != "kill_switch" {
+		t.Fatalf("expected kill_switch, got %q", got)
+	}
+}
+
+func TestHaltTrading_CancelsOpenOrders(t *testing.T) {
+	db := openMigratedTestDB(t)
+	cancelled := map[string]bool{}
+	client := newTestKrakenPrivate(t, func(method string, form url.Values) string {
+		switch method {
+		case "CancelOrder":
+			cancelled[form.Get("txid")] = true
+			return `{"error": [], "result": {"count": 1}}`
+		case "QueryOrders":
+			canceled := `{"status": "canceled", "reason": "User requested", "vol": "0.01", "vol_exec": "0", "cost": "0", "fee": "0", "price": "0"}`
+			return `{"error": [], "result": {"OOPEN1": ` + canceled + `, "OPEND1": ` + canceled + `}}`
+		case "OpenOrders":
+			// The pending order (ID 3) did reach Kraken
+			if form.Get("userref") != "3" {
+				return `{"error": [], "result": {"open": {}}}`
+			}
+			return `{"error": [], "result": {"open": {"OPEND1": {"status": "open", "userref": 3, "descr": {"type": "buy"},
+				"vol": "0.01", "vol_exec": "0", "cost": "0", "fee": "0", "price": "0", "opentm": 4102444800}}}}`
+		case "ClosedOrders":
+			return `{"error": [], "result": {"closed": {}, "count": 0}}`
+		}
+		return `{"error": ["EGeneral:Unknown method"]}`
+	})
+	db.Exec(`INSERT INTO orders (symbol, pair, side, order_type, volume, txid, status, created_at, updated_at) VALUES ('XBT', 'XBTUSD', 'buy', 'limit', 0.01, 'OOPEN1', ?, ?, ?)`,
+		OrderSubmitted, time.Now().UTC(), time.Now().UTC())
+	db.Exec(`INSERT INTO orders (symbol, pair, side, order_type, volume, txid, status, created_at, updated_at) VALUES ('XBT', 'XBTUSD', 'buy', 'market', 0.01, 'ODONE1', ?, ?, ?)`,
+		OrderFilled, time.Now().UTC(), time.Now().UTC())
+	db.Exec(`INSERT INTO orders (symbol, pair, side, order_type, volume, status, error, created_at, updated_at) VALUES ('XBT', 'XBTUSD', 'buy', 'market', 0.01, ?, 'timeout', ?, ?)`,
+		OrderPending, time.Now().UTC(), time.Now().UTC())
+
+	n, err := haltTrading(context.Background(), store.New(db), newOrderManager(store.New(db), client), "")
+	if err != nil || n != 2 || !cancelled["OOPEN1"] || !cancelled["OPEND1"] || cancelled["ODONE1"] {
+		t.Fatalf("expected the open and the pending order to be cancelled, got %d %v, %v", n, cancelled, err)
+	}
+	if halt, _ := store.New(db).TradingHalt(); !halt.Halted || halt.Reason != "kill switch" {
+		t.Fatalf("expected trading halted, got %+v", halt)
+	}
+	if orders, _ := openOrders(store.New(db)); len(orders) != 0 {
+		t.Fatalf("expected no open orders after the halt, got %+v", orders)
+	}
+}
+
+// scriptedStrategy returns its actions in turn, then holds.
+type scriptedStrategy struct {
+	actions []string
+}
+
+func (s *scriptedStrategy) Name() string                  { return "scripted" }
+func (s *scriptedStrategy) Params() map[string]string     { return nil }
+func (s *scriptedStrategy) History() (int, time.Duration) { return 60, time.Hour }
+func (s *scriptedStrategy) Evaluate(series Series) *TradingSignal {
+	action := "HOLD"
+	if len(s.actions) > 0 {
+		action, s.actions = s.actions[0], s.actions[1:]
+	}
+	return &TradingSignal{Action: action, CurrentPrice: series.Price}
+}
+
+func TestCollectPrice_RiskBlockedBuyIsNotPaperTraded(t *testing.T) {
+	db := openMigratedTestDB(t)
+	db.Exec(`INSERT INTO settings (initial_funds, transaction_fee_rate) VALUES (1000, 0)`)
+	var sent []string
+	client := newTestKrakenPrivate(t, func(method string, form url.Values) string {
+		sent = append(sent, method+" "+form.Get("type"))
+		return `{"error": [], "result": {"descr": {"order": "order"}, "txid": ["OTEST1"]}}`
+	})
+	trader := &LiveTrader{Client: client, Orders: newOrderManager(store.New(db), client), Risk: &RiskLimits{MaxOrderNotional: 500}, st: store.New(db)}
+	cfg := collectorConfig{strategy: &scriptedStrategy{actions: []string{"BUY", "SELL"}}, paperTrading: true, liveTrader: trader}
+
+	// The $1000 buy is over the order limit; the following sell then has
+	// nothing to sell on paper, so no order goes out for either
+	collectPrice(store.New(db), staticSource{price: 100}, "XBT", cfg)
+	collectPrice(store.New(db), staticSource{price: 110}, "XBT", cfg)
+
+	if len(sent) != 0 {
+		t.Fatalf("expected no orders sent, got %v", sent)
+	}
+	p, err := loadPaperPortfolio(store.New(db), "XBT")
+	if err != nil || p.Cash != 1000 || p.Quantity != 0 {
+		t.Fatalf("expected the paper account untouched, got %+v, %v", p, err)
+	}
+	if fills, _ := store.New(db).PaperFills("XBT", 10); len(fills) != 0 {
+		t.Fatalf("expected no paper fills, got %+v", fills)
+	}
+	signals, err := store.New(db).RecentSignals("XBT", 10)
+	if err != nil || len(signals) != 2 {
+		t.Fatalf("expected two signals, got %+v, %v", signals, err)
+	}
+	if buy := signals[1]; buy.Action != "BUY" || !strings.HasPrefix(buy.Rejection, "max_order_usd") {
+		t.Fatalf("expected the buy rejected by max_order_usd, got %+v", buy)
+	}
+	if sell := signals[0]; sell.Action != "SELL" || sell.Rejection != "" {
+		t.Fatalf("expected the sell recorded without a rejection, got %+v", sell)
+	}
+}
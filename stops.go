@@ -0,0 +1,260 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"crypto-trader/indicators"
+	"crypto-trader/store"
+)
+
+// StopRules are the downside exits checked on every tick while a position is
+// open. Zero values disable a rule.
+type StopRules struct {
+	StopLoss    float64       // exit when price falls this many percent below entry
+	TrailingPct float64       // exit when price falls this many percent below the high since entry
+	TrailingATR float64       // exit when price falls this many ATRs below the high since entry
+	ATRPeriod   int           // bars in the ATR
+	ATRInterval int           // candle interval (minutes) the ATR is computed on
+	MaxHold     time.Duration // exit once the position has been held this long
+}
+
+// Position is the open position the stop rules protect: the paper position
+// or the latest BUY signal, and the highest price seen since.
+type Position struct {
+	EntryPrice float64
+	EntryTime  time.Time
+	High       float64
+}
+
+// configuredStopRules reads the stop rules from STOP_LOSS_PCT,
+// TRAILING_STOP_PCT, TRAILING_STOP_ATR, ATR_PERIOD, ATR_INTERVAL and
+// MAX_HOLD. It returns nil when no rule is enabled.
+func configuredStopRules() (*StopRules, error) {
+	r := &StopRules{ATRPeriod: 14, ATRInterval: 60}
+	for _, f := range []struct {
+		env string
+		dst *float64
+	}{
+		{"STOP_LOSS_PCT", &r.StopLoss},
+		{"TRAILING_STOP_PCT", &r.TrailingPct},
+		{"TRAILING_STOP_ATR", &r.TrailingATR},
+	} {
+		val := strings.TrimSpace(os.Getenv(f.env))
+		if val == "" {
+			continue
+		}
+		n, err := strconv.ParseFloat(val, 64)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid %s %q", f.env, val)
+		}
+		*f.dst = n
+	}
+	if val := strings.TrimSpace(os.Getenv("ATR_PERIOD")); val != "" {
+		n, err := strconv.Atoi(val)
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("invalid ATR_PERIOD %q", val)
+		}
+		r.ATRPeriod = n
+	}
+	if val := strings.TrimSpace(os.Getenv("ATR_INTERVAL")); val != "" {
+		n, ok := intervalNames[val]
+		if !ok {
+			return nil, fmt.Errorf("invalid ATR_INTERVAL %q", val)
+		}
+		r.ATRInterval = n
+	}
+	if val := strings.TrimSpace(os.Getenv("MAX_HOLD")); val != "" {
+		d, err := parseWindow(val)
+		if err != nil {
+			return nil, fmt.Errorf("invalid MAX_HOLD: %w", err)
+		}
+		r.MaxHold = d
+	}
+	if r.StopLoss == 0 && r.TrailingPct == 0 && r.TrailingATR == 0 && r.MaxHold == 0 {
+		return nil, nil
+	}
+	return r, nil
+}
+
+// String describes the enabled rules.
+func (r *StopRules) String() string {
+	var parts []string
+	if r.StopLoss > 0 {
+		parts = append(parts, fmt.Sprintf("stop loss %v%%", r.StopLoss))
+	}
+	if r.TrailingPct > 0 {
+		parts = append(parts, fmt.Sprintf("trailing stop %v%%", r.TrailingPct))
+	}
+	if r.TrailingATR > 0 {
+		parts = append(parts, fmt.Sprintf("trailing stop %vx ATR(%d, %dm)", r.TrailingATR, r.ATRPeriod, r.ATRInterval))
+	}
+	if r.MaxHold > 0 {
+		parts = append(parts, "max hold "+formatWindow(r.MaxHold))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Check returns the reason and description of the first rule that fires
+// for pos at price, or "" if none does. atr is only used by the ATR
+// trailing stop; pass 0 when it is not available.
+func (r *StopRules) Check(pos Position, price, atr float64, now time.Time) (reason, detail string) {
+	high := pos.High
+	if price > high {
+		high = price
+	}
+	if r.StopLoss > 0 {
+		if stop := pos.EntryPrice * (1 - r.StopLoss/100); price <= stop {
+			return "stop_loss", fmt.Sprintf("price $%.2f at or below stop $%.2f (%v%% under entry $%.2f)", price, stop, r.StopLoss, pos.EntryPrice)
+		}
+	}
+	if r.TrailingPct > 0 {
+		if stop := high * (1 - r.TrailingPct/100); price <= stop {
+			return "trailing_stop", fmt.Sprintf("price $%.2f at or below trailing stop $%.2f (%v%% under high $%.2f)", price, stop, r.TrailingPct, high)
+		}
+	}
+	if r.TrailingATR > 0 && atr > 0 {
+		if stop := high - r.TrailingATR*atr; price <= stop {
+			return "trailing_stop", fmt.Sprintf("price $%.2f at or below trailing stop $%.2f (%vx ATR $%.2f under high $%.2f)", price, stop, r.TrailingATR, atr, high)
+		}
+	}
+	if r.MaxHold > 0 && !pos.EntryTime.IsZero() {
+		if held := now.Sub(pos.EntryTime); held >= r.MaxHold {
+			return "max_hold", fmt.Sprintf("held %s, max %s", held.Truncate(time.Minute), formatWindow(r.MaxHold))
+		}
+	}
+	return "", ""
+}
+
+// openPosition returns symbol's open position, or nil when flat. With paper
+// trading (which live trading mirrors) it is the paper position, which only
+// exists once a buy filled. Otherwise it comes from trading_signals: the
+// latest BUY, unless a later SELL closed the whole position (partial exit
+// ladder sells leave it open). Signals the risk limits rejected never filled
+// and are ignored.
+func openPosition(st store.Store, symbol string, paper bool) (*Position, error) {
+	if paper {
+		a, err := st.PaperAccount(symbol)
+		if err != nil || a.Quantity <= 0 {
+			return nil, err
+		}
+		return positionSince(st, symbol, a.EntryPrice, a.OpenedAt)
+	}
+
+	buy, err := st.LatestBuy(symbol)
+	if err == store.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	signals, err := st.SignalsSince(symbol, buy.Timestamp)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range signals {
+		if s.ID > buy.ID && s.Action == "SELL" && s.Quantity == 0 && s.Rejection == "" {
+			return nil, nil
+		}
+	}
+
+	return positionSince(st, symbol, buy.Price, buy.Timestamp)
+}
+
+// positionSince returns the position entered at entryPrice at entryTime,
+// with the highest price since.
+func positionSince(st store.Store, symbol string, entryPrice float64, entryTime time.Time) (*Position, error) {
+	high, err := st.HighSince(symbol, entryTime)
+	if err != nil {
+		return nil, err
+	}
+	pos := &Position{EntryPrice: entryPrice, EntryTime: entryTime, High: entryPrice}
+	if high > pos.High {
+		pos.High = high
+	}
+	return pos, nil
+}
+
+// stopRejected reports whether the latest stop SELL for the position entered
+// at entryTime was rejected since the kill switch last changed. Such a stop
+// is not signalled again on every tick; resuming trading lets it fire anew.
+func stopRejected(st store.Store, symbol string, entryTime time.Time) (bool, error) {
+	signals, err := st.SignalsSince(symbol, entryTime)
+	if err != nil {
+		return false, err
+	}
+	var last *store.Signal
+	for i, s := range signals {
+		switch s.Reason {
+		case "stop_loss", "trailing_stop", "max_hold":
+			last = &signals[i]
+		}
+	}
+	if last == nil || last.Rejection == "" {
+		return false, nil
+	}
+	halt, err := st.TradingHalt()
+	if err != nil {
+		return false, err
+	}
+	return last.Timestamp.After(halt.UpdatedAt), nil
+}
+
+// latestATR returns the ATR over the last period candles of interval for
+// symbol, or 0 when there are not enough candles yet.
+func latestATR(st store.Store, symbol string, interval, period int, now time.Time) (float64, error) {
+	step := time.Duration(interval) * time.Minute
+	candles, err := st.CandlesSince(symbol, interval, now.Add(-time.Duration(period+1)*step))
+	if err != nil {
+		return 0, err
+	}
+	if len(candles) < period {
+		return 0, nil
+	}
+	high, low, close := candleHLC(candles)
+	atr := indicators.ATRSeries(high, low, close, period)
+	return atr[len(atr)-1], nil
+}
+
+// stopSignal checks symbol's open position against the stop rules and
+// returns a SELL signal for the whole position if one fires, or nil. A stop
+// already rejected for the position is not signalled again.
+func stopSignal(st store.Store, rules *StopRules, symbol string, price float64, now time.Time, paper bool) (*TradingSignal, error) {
+	pos, err := openPosition(st, symbol, paper)
+	if err != nil || pos == nil {
+		return nil, err
+	}
+	var atr float64
+	if rules.TrailingATR > 0 {
+		if atr, err = latestATR(st, symbol, rules.ATRInterval, rules.ATRPeriod, now); err != nil {
+			return nil, err
+		}
+	}
+	reason, detail := rules.Check(*pos, price, atr, now)
+	if reason == "" {
+		return nil, nil
+	}
+	if rejected, err := stopRejected(st, symbol, pos.EntryTime); err != nil || rejected {
+		return nil, err
+	}
+	return &TradingSignal{
+		Action:         "SELL",
+		Reason:         reason,
+		CurrentPrice:   price,
+		Recommendation: fmt.Sprintf("** SELL (%s: %s) **", strings.ReplaceAll(reason, "_", " "), detail),
+	}, nil
+}
+
+// latestBuyPrice returns the price of symbol's latest BUY signal that was
+// not rejected, or 0 if there is none.
+func latestBuyPrice(st store.Store, symbol string) (float64, error) {
+	buy, err := st.LatestBuy(symbol)
+	if err == store.ErrNotFound {
+		return 0, nil
+	}
+	return buy.Price, err
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"crypto-trader/store"
+)
+
+func TestStopRules_CheckOrder(t *testing.T) {
+	entry := time.Date(2026, 8, 1, 0, 0, 0, 0, time.UTC)
+	pos := Position{EntryPrice: 100, EntryTime: entry, High: 120}
+	rules := &StopRules{StopLoss: 5, TrailingPct: 10, MaxHold: 48 * time.Hour}
+
+	if reason, _ := rules.Check(pos, 110, 0, entry.Add(time.Hour)); reason != "" {
+		t.Fatalf("expected no exit at 110, got %s", reason)
+	}
+	if reason, _ := rules.Check(pos, 108, 0, entry.Add(time.Hour)); reason != "trailing_stop" {
+		t.Fatalf("expected trailing_stop 10%% under the 120 high, got %q", reason)
+	}
+	if reason, _ := rules.Check(pos, 95, 0, entry.Add(time.Hour)); reason != "stop_loss" {
+		t.Fatalf("expected stop_loss to win over trailing_stop, got %q", reason)
+	}
+	if reason, _ := rules.Check(pos, 115, 0, entry.Add(48*time.Hour)); reason != "max_hold" {
+		t.Fatalf("expected max_hold after 48h, got %q", reason)
+	}
+
+	// An ATR stop of 2x ATR 3 sits at 114 under the 120 high
+	atr := &StopRules{TrailingATR: 2}
+	if reason, _ := atr.Check(pos, 115, 3, entry); reason != "" {
+		t.Fatalf("expected no exit above the ATR stop, got %s", reason)
+	}
+	if reason, _ := atr.Check(pos, 114, 3, entry); reason != "trailing_stop" {
+		t.Fatalf("expected trailing_stop at the ATR stop, got %q", reason)
+	}
+	if reason, _ := atr.Check(pos, 50, 0, entry); reason != "" {
+		t.Fatalf("expected the ATR stop to wait for an ATR, got %s", reason)
+	}
+}
+
+func TestConfiguredStopRules(t *testing.T) {
+	t.Setenv("STOP_LOSS_PCT", "")
+	t.Setenv("TRAILING_STOP_PCT", "")
+	t.Setenv("TRAILING_STOP_ATR", "")
+	t.Setenv("MAX_HOLD", "")
+	if rules, err := configuredStopRules(); rules != nil || err != nil {
+		t.Fatalf("expected no rules when unset, got %v, %v", rules, err)
+	}
+
+	t.Setenv("TRAILING_STOP_ATR", "2.5")
+	t.Setenv("ATR_INTERVAL", "4h")
+	t.Setenv("MAX_HOLD", "3d")
+	rules, err := configuredStopRules()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if rules.TrailingATR != 2.5 || rules.ATRInterval != 240 || rules.ATRPeriod != 14 || rules.MaxHold != 72*time.Hour {
+		t.Fatalf("expected 2.5x ATR(14, 4h) and 3d max hold, got %+v", rules)
+	}
+
+	t.Setenv("STOP_LOSS_PCT", "five")
+	if _, err := configuredStopRules(); err == nil {
+		t.Fatalf("expected error for invalid STOP_LOSS_PCT")
+	}
+}
+
+func TestOpenPosition_FromLatestBuySignal(t *testing.T) {
+	db := openMigratedTestDB(t)
+
+	if pos, err := openPosition(store.New(db), "XBT", false); pos != nil || err != nil {
+		t.Fatalf("expected no position without signals, got %v, %v", pos, err)
+	}
+
+	start := time.Date(2026, 8, 1, 0, 0, 0, 0, time.UTC)
+	db.Exec(`INSERT INTO trading_signals (symbol, action, price, timestamp) VALUES ('XBT', 'BUY', 100, ?)`, start)
+	for i, price := range []float64{90, 100, 125, 110} {
+		db.Exec(`INSERT INTO btc_price (symbol, price, timestamp) VALUES ('XBT', ?, ?)`, price, start.Add(time.Duration(i-1)*time.Hour))
+	}
+
+	pos, err := openPosition(store.New(db), "XBT", false)
+	if err != nil || pos == nil {
+		t.Fatalf("expected an open position, got %v, %v", pos, err)
+	}
+	if pos.EntryPrice != 100 || !pos.EntryTime.Equal(start) || pos.High != 125 {
+		t.Fatalf("expected entry $100 with a $125 high, got %+v", pos)
+	}
+
+	// A partial ladder sell leaves the position open, a full sell closes it
+	db.Exec(`INSERT INTO trading_signals (symbol, action, reason, price, quantity, timestamp) VALUES ('XBT', 'SELL', 'exit_ladder', 125, 0.5, ?)`, start.Add(time.Hour))
+	if pos, _ = openPosition(store.New(db), "XBT", false); pos == nil {
+		t.Fatalf("expected the position to stay open after a partial sell")
+	}
+	db.Exec(`INSERT INTO trading_signals (symbol, action, reason, price, timestamp) VALUES ('XBT', 'SELL', 'stop_loss', 110, ?)`, start.Add(2*time.Hour))
+	if pos, _ = openPosition(store.New(db), "XBT", false); pos != nil {
+		t.Fatalf("expected the position to be closed, got %+v", pos)
+	}
+	if price, _ := latestBuyPrice(store.New(db), "XBT"); price != 100 {
+		t.Fatalf("expected last buy price 100, got %v", price)
+	}
+}
+
+func TestOpenPosition_IgnoresRejectedSignals(t *testing.T) {
+	db := openMigratedTestDB(t)
+
+	start := time.Date(2026, 8, 1, 0, 0, 0, 0, time.UTC)
+	db.Exec(`INSERT INTO trading_signals (symbol, action, price, timestamp, rejection) VALUES ('XBT', 'BUY', 100, ?, 'max_order_usd')`, start)
+	if pos, err := openPosition(store.New(db), "XBT", false); pos != nil || err != nil {
+		t.Fatalf("expected a rejected buy not to open a position, got %v, %v", pos, err)
+	}
+	if price, _ := latestBuyPrice(store.New(db), "XBT"); price != 0 {
+		t.Fatalf("expected no last buy price, got %v", price)
+	}
+
+	// A rejected sell does not close the position a filled buy opened
+	db.Exec(`INSERT INTO trading_signals (symbol, action, price, timestamp) VALUES ('XBT', 'BUY', 90, ?)`, start.Add(time.Hour))
+	db.Exec(`INSERT INTO trading_signals (symbol, action, price, timestamp, rejection) VALUES ('XBT', 'SELL', 95, ?, 'kill_switch')`, start.Add(2*time.Hour))
+	pos, err := openPosition(store.New(db), "XBT", false)
+	if err != nil || pos == nil || pos.EntryPrice != 90 {
+		t.Fatalf("expected the $90 position to stay open, got %+v, %v", pos, err)
+	}
+}
+
+func TestOpenPosition_FromPaperPosition(t *testing.T) {
+	st := store.NewMemory()
+	opened := time.Now().UTC().Add(-time.Hour)
+	st.InsertSignal(store.Signal{Symbol: "XBT", Action: "BUY", Price: 100, Timestamp: opened})
+
+	// The buy signal never filled on paper, so there is nothing to protect
+	if pos, err := openPosition(st, "XBT", true); pos != nil || err != nil {
+		t.Fatalf("expected no paper position, got %+v, %v", pos, err)
+	}
+
+	st.SetPaperAccount(store.PaperAccount{Symbol: "XBT", Traded: true, Quantity: 1, EntryPrice: 95, EntryQuantity: 1, OpenedAt: opened})
+	st.InsertPrice("XBT", 120, opened.Add(time.Minute))
+	pos, err := openPosition(st, "XBT", true)
+	if err != nil || pos == nil || pos.EntryPrice != 95 || !pos.EntryTime.Equal(opened) || pos.High != 120 {
+		t.Fatalf("expected the $95 paper position with a $120 high, got %+v, %v", pos, err)
+	}
+}
+
+func TestStopSignal_RejectedStopNotRepeated(t *testing.T) {
+	st := store.NewMemory()
+	opened := time.Now().UTC().Add(-time.Hour)
+	st.SetPaperAccount(store.PaperAccount{Symbol: "XBT", Traded: true, Quantity: 1, EntryPrice: 100, EntryQuantity: 1, OpenedAt: opened})
+	rules := &StopRules{StopLoss: 5}
+
+	if exit, err := stopSignal(st, rules, "XBT", 90, time.Now(), true); err != nil || exit == nil || exit.Reason != "stop_loss" {
+		t.Fatalf("expected a stop_loss exit, got %+v, %v", exit, err)
+	}
+
+	// The kill switch rejects the stop; it is not signalled again while halted
+	st.SetTradingHalt(true, "maintenance")
+	time.Sleep(time.Millisecond)
+	st.InsertSignal(store.Signal{Symbol: "XBT", Action: "SELL", Reason: "stop_loss", Price: 90, Rejection: "kill_switch: maintenance", Timestamp: time.Now()})
+	if exit, err := stopSignal(st, rules, "XBT", 89, time.Now(), true); exit != nil || err != nil {
+		t.Fatalf("expected the rejected stop not to repeat, got %+v, %v", exit, err)
+	}
+
+	time.Sleep(time.Millisecond)
+	st.SetTradingHalt(false, "")
+	if exit, _ := stopSignal(st, rules, "XBT", 89, time.Now(), true); exit == nil {
+		t.Fatalf("expected the stop to fire again once trading resumed")
+	}
+}
@@ -0,0 +1,585 @@
+package store
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Memory is an in-memory Store for tests.
+type Memory struct {
+	mu          sync.Mutex
+	prices      []Price
+	signals     []Signal
+	settings    []Settings
+	candles     []Candle
+	tickCandles map[candleKey]bool // candles rolled up from ticks
+	rolledUp    map[string]int64   // last tick rolled up, by symbol
+	accounts    map[string]PaperAccount
+	fills       []PaperFill
+	ladderHits  []LadderHit
+	orders      []Order
+	orderFills  []OrderFill
+	halt        TradingHalt
+}
+
+// candleKey identifies a candle.
+type candleKey struct {
+	symbol   string
+	interval int
+	time     int64
+}
+
+func keyOf(c Candle) candleKey {
+	return candleKey{c.Symbol, c.Interval, c.Time.UnixNano()}
+}
+
+var _ Store = (*Memory)(nil)
+
+// NewMemory returns an empty Memory store.
+func NewMemory() *Memory {
+	return &Memory{}
+}
+
+// SetPaperAccount stores a's paper account, replacing any for its symbol.
+func (m *Memory) SetPaperAccount(a PaperAccount) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.accounts == nil {
+		m.accounts = make(map[string]PaperAccount)
+	}
+	m.accounts[a.Symbol] = a
+}
+
+// AddPaperFills stores fills, numbering them in order.
+func (m *Memory) AddPaperFills(fills ...PaperFill) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, f := range fills {
+		f.ID = int64(len(m.fills) + 1)
+		m.fills = append(m.fills, f)
+	}
+}
+
+// AddLadderHit marks tier as sold for symbol's position opened at openedAt.
+func (m *Memory) AddLadderHit(symbol string, openedAt time.Time, tier float64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.ladderHits = append(m.ladderHits, LadderHit{Symbol: symbol, OpenedAt: openedAt.UTC(), Tier: tier})
+}
+
+// AddOrders stores orders, numbering them in order.
+func (m *Memory) AddOrders(orders ...Order) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, o := range orders {
+		o.ID = int64(len(m.orders) + 1)
+		m.orders = append(m.orders, o)
+	}
+}
+
+// AddCandles stores Kraken candles, replacing any with the same symbol,
+// interval and open time.
+func (m *Memory) AddCandles(candles ...Candle) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.upsertCandles(candles)
+}
+
+// upsertCandles stores Kraken candles and returns how many were new. Callers
+// must hold m.mu.
+func (m *Memory) upsertCandles(candles []Candle) int {
+	inserted := 0
+	for _, c := range candles {
+		c.Time = c.Time.UTC()
+		if i := m.candleIndex(keyOf(c)); i >= 0 {
+			m.candles[i] = c
+		} else {
+			m.candles = append(m.candles, c)
+			inserted++
+		}
+		delete(m.tickCandles, keyOf(c))
+	}
+	sort.SliceStable(m.candles, func(i, j int) bool { return m.candles[i].Time.Before(m.candles[j].Time) })
+	return inserted
+}
+
+// candleIndex returns the index of the candle with key k, or -1. Callers must
+// hold m.mu.
+func (m *Memory) candleIndex(k candleKey) int {
+	for i, c := range m.candles {
+		if keyOf(c) == k {
+			return i
+		}
+	}
+	return -1
+}
+
+func (m *Memory) InsertPrice(symbol string, price float64, ts time.Time) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	p := Price{ID: int64(len(m.prices) + 1), Symbol: symbol, Price: price, Timestamp: ts.UTC()}
+	m.prices = append(m.prices, p)
+	return p.ID, nil
+}
+
+func (m *Memory) LatestPrice(symbol string) (Price, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := len(m.prices) - 1; i >= 0; i-- {
+		if m.prices[i].Symbol == symbol {
+			return m.prices[i], nil
+		}
+	}
+	return Price{}, ErrNotFound
+}
+
+func (m *Memory) PricesSince(symbol string, since time.Time) ([]Price, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var prices []Price
+	for _, p := range m.prices {
+		if p.Symbol == symbol && !p.Timestamp.Before(since) {
+			prices = append(prices, p)
+		}
+	}
+	sort.SliceStable(prices, func(i, j int) bool { return prices[i].Timestamp.Before(prices[j].Timestamp) })
+	return prices, nil
+}
+
+func (m *Memory) PricesBetween(symbol string, from, to time.Time) ([]Price, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var prices []Price
+	for _, p := range m.prices {
+		if p.Symbol == symbol && !p.Timestamp.Before(from) && !p.Timestamp.After(to) {
+			prices = append(prices, p)
+		}
+	}
+	sort.SliceStable(prices, func(i, j int) bool { return prices[i].Timestamp.Before(prices[j].Timestamp) })
+	return prices, nil
+}
+
+func (m *Memory) PriceBefore(symbol string, t time.Time) (Price, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var latest Price
+	found := false
+	for _, p := range m.prices {
+		if p.Symbol == symbol && p.Timestamp.Before(t) && (!found || !p.Timestamp.Before(latest.Timestamp)) {
+			latest, found = p, true
+		}
+	}
+	if !found {
+		return Price{}, ErrNotFound
+	}
+	return latest, nil
+}
+
+func (m *Memory) RecentPrices(symbol string, limit int) ([]Price, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var prices []Price
+	for i := len(m.prices) - 1; i >= 0 && len(prices) < limit; i-- {
+		if m.prices[i].Symbol == symbol {
+			prices = append(prices, m.prices[i])
+		}
+	}
+	return prices, nil
+}
+
+func (m *Memory) Symbols() ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	seen := make(map[string]bool)
+	var symbols []string
+	for _, p := range m.prices {
+		if !seen[p.Symbol] {
+			seen[p.Symbol] = true
+			symbols = append(symbols, p.Symbol)
+		}
+	}
+	sort.Strings(symbols)
+	return symbols, nil
+}
+
+func (m *Memory) HighSince(symbol string, since time.Time) (float64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var high float64
+	for _, p := range m.prices {
+		if p.Symbol == symbol && !p.Timestamp.Before(since) && p.Price > high {
+			high = p.Price
+		}
+	}
+	return high, nil
+}
+
+func (m *Memory) InsertSignal(s Signal) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if s.Reason == "" {
+		s.Reason = "strategy"
+	}
+	s.ID = 1
+	if len(m.signals) > 0 {
+		s.ID = m.signals[len(m.signals)-1].ID + 1
+	}
+	s.Timestamp = s.Timestamp.UTC()
+	m.signals = append(m.signals, s)
+	return s.ID, nil
+}
+
+func (m *Memory) SignalsSince(symbol string, since time.Time) ([]Signal, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var signals []Signal
+	for _, s := range m.signals {
+		if s.Symbol == symbol && !s.Timestamp.Before(since) {
+			signals = append(signals, s)
+		}
+	}
+	sort.SliceStable(signals, func(i, j int) bool { return signals[i].Timestamp.Before(signals[j].Timestamp) })
+	return signals, nil
+}
+
+func (m *Memory) RecentSignals(symbol string, limit int) ([]Signal, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var signals []Signal
+	for i := len(m.signals) - 1; i >= 0 && len(signals) < limit; i-- {
+		if m.signals[i].Symbol == symbol {
+			signals = append(signals, m.signals[i])
+		}
+	}
+	return signals, nil
+}
+
+func (m *Memory) LatestBuy(symbol string) (Signal, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := len(m.signals) - 1; i >= 0; i-- {
+		if s := m.signals[i]; s.Symbol == symbol && s.Action == "BUY" && s.Rejection == "" {
+			return s, nil
+		}
+	}
+	return Signal{}, ErrNotFound
+}
+
+func (m *Memory) RejectSignal(id int64, rejection string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := range m.signals {
+		if m.signals[i].ID == id {
+			m.signals[i].Rejection = rejection
+		}
+	}
+	return nil
+}
+
+func (m *Memory) DeleteSignalsAt(priceIDs ...int64) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	at := make(map[int64]bool)
+	for _, id := range priceIDs {
+		at[id] = true
+	}
+	kept := m.signals[:0]
+	for _, s := range m.signals {
+		if !at[s.PriceID] || (s.Action != "BUY" && s.Action != "SELL") {
+			kept = append(kept, s)
+		}
+	}
+	n := len(m.signals) - len(kept)
+	m.signals = kept
+	return n, nil
+}
+
+func (m *Memory) SaveSettings(s Settings) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if s.UpdatedAt.IsZero() {
+		s.UpdatedAt = time.Now()
+	}
+	s.UpdatedAt = s.UpdatedAt.UTC()
+	m.settings = append(m.settings, s)
+	return nil
+}
+
+func (m *Memory) LatestSettings(symbol string) (Settings, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	fallback := Settings{FeeRate: DefaultFeeRate}
+	found := false
+	for i := len(m.settings) - 1; i >= 0; i-- {
+		s := m.settings[i]
+		if s.Symbol == symbol {
+			return s, nil
+		}
+		if s.Symbol == "" && !found {
+			fallback, found = s, true
+		}
+	}
+	return fallback, nil
+}
+
+func (m *Memory) CandlesSince(symbol string, interval int, since time.Time) ([]Candle, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var candles []Candle
+	for _, c := range m.candles {
+		if c.Symbol == symbol && c.Interval == interval && !c.Time.Before(since) {
+			candles = append(candles, c)
+		}
+	}
+	return candles, nil
+}
+
+func (m *Memory) OldestCandleTime(symbol string, interval int) (time.Time, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, c := range m.candles {
+		if c.Symbol == symbol && c.Interval == interval {
+			return c.Time, nil
+		}
+	}
+	return time.Time{}, nil
+}
+
+func (m *Memory) LatestCandle(symbol string, interval int) (Candle, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := len(m.candles) - 1; i >= 0; i-- {
+		if c := m.candles[i]; c.Symbol == symbol && c.Interval == interval {
+			return c, nil
+		}
+	}
+	return Candle{}, ErrNotFound
+}
+
+func (m *Memory) UpsertCandles(candles []Candle) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.upsertCandles(candles), nil
+}
+
+func (m *Memory) RollUpTicks(ticks ...Price) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.tickCandles == nil {
+		m.tickCandles = make(map[candleKey]bool)
+	}
+	if m.rolledUp == nil {
+		m.rolledUp = make(map[string]int64)
+	}
+	for _, p := range ticks {
+		for _, interval := range TickIntervals {
+			bucket := p.Timestamp.UTC().Truncate(time.Duration(interval) * time.Minute)
+			k := candleKey{p.Symbol, interval, bucket.UnixNano()}
+			i := m.candleIndex(k)
+			switch {
+			case i < 0:
+				m.candles = append(m.candles, Candle{Symbol: p.Symbol, Interval: interval, Time: bucket,
+					Open: p.Price, High: p.Price, Low: p.Price, Close: p.Price, Count: 1})
+				m.tickCandles[k] = true
+			case m.tickCandles[k]:
+				c := &m.candles[i]
+				c.High, c.Low = max(c.High, p.Price), min(c.Low, p.Price)
+				c.Close = p.Price
+				c.Count++
+			}
+		}
+		if p.ID > m.rolledUp[p.Symbol] {
+			m.rolledUp[p.Symbol] = p.ID
+		}
+	}
+	sort.SliceStable(m.candles, func(i, j int) bool { return m.candles[i].Time.Before(m.candles[j].Time) })
+	return nil
+}
+
+func (m *Memory) UnrolledPrices(symbol string) ([]Price, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var prices []Price
+	for _, p := range m.prices {
+		if p.Symbol == symbol && p.ID > m.rolledUp[symbol] {
+			prices = append(prices, p)
+		}
+	}
+	return prices, nil
+}
+
+func (m *Memory) PaperAccount(symbol string) (PaperAccount, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	a := m.accounts[symbol]
+	a.Symbol = symbol
+	return a, nil
+}
+
+func (m *Memory) PaperFills(symbol string, limit int) ([]PaperFill, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var fills []PaperFill
+	for i := len(m.fills) - 1; i >= 0 && len(fills) < limit; i-- {
+		if m.fills[i].Symbol == symbol {
+			fills = append(fills, m.fills[i])
+		}
+	}
+	return fills, nil
+}
+
+func (m *Memory) PaperFillsSince(symbol string, since time.Time) ([]PaperFill, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var fills []PaperFill
+	for _, f := range m.fills {
+		if (symbol == "" || f.Symbol == symbol) && !f.Timestamp.Before(since) {
+			fills = append(fills, f)
+		}
+	}
+	return fills, nil
+}
+
+func (m *Memory) PaperFillBefore(symbol string, t time.Time) (PaperFill, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := len(m.fills) - 1; i >= 0; i-- {
+		if f := m.fills[i]; f.Symbol == symbol && f.Timestamp.Before(t) {
+			return f, nil
+		}
+	}
+	return PaperFill{}, ErrNotFound
+}
+
+func (m *Memory) RecordPaperFill(a PaperAccount, f PaperFill, hit *LadderHit) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.accounts == nil {
+		m.accounts = make(map[string]PaperAccount)
+	}
+	a.Traded = true
+	m.accounts[a.Symbol] = a
+	f.ID = int64(len(m.fills) + 1)
+	f.Symbol = a.Symbol
+	f.Timestamp = f.Timestamp.UTC()
+	m.fills = append(m.fills, f)
+	if hit != nil {
+		h := *hit
+		h.OpenedAt = h.OpenedAt.UTC()
+		m.ladderHits = append(m.ladderHits, h)
+	}
+	return f.ID, nil
+}
+
+func (m *Memory) LadderHits(symbol string, openedAt time.Time) (map[float64]bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	hit := make(map[float64]bool)
+	for _, h := range m.ladderHits {
+		if h.Symbol == symbol && h.OpenedAt.Equal(openedAt) {
+			hit[h.Tier] = true
+		}
+	}
+	return hit, nil
+}
+
+func (m *Memory) RecentOrders(symbol string, limit int) ([]Order, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var orders []Order
+	for i := len(m.orders) - 1; i >= 0 && len(orders) < limit; i-- {
+		if m.orders[i].Symbol == symbol {
+			orders = append(orders, m.orders[i])
+		}
+	}
+	return orders, nil
+}
+
+func (m *Memory) OrdersByStatus(statuses ...string) ([]Order, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var orders []Order
+	for _, o := range m.orders {
+		for _, status := range statuses {
+			if o.Status == status {
+				orders = append(orders, o)
+				break
+			}
+		}
+	}
+	return orders, nil
+}
+
+func (m *Memory) OrdersSince(symbol string, since time.Time) ([]Order, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var orders []Order
+	for _, o := range m.orders {
+		if (symbol == "" || o.Symbol == symbol) && !o.CreatedAt.Before(since) {
+			orders = append(orders, o)
+		}
+	}
+	return orders, nil
+}
+
+func (m *Memory) InsertOrder(o Order) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	o.ID = int64(len(m.orders) + 1)
+	m.orders = append(m.orders, o)
+	return o.ID, nil
+}
+
+func (m *Memory) UpdatePendingOrder(o Order) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := range m.orders {
+		if stored := &m.orders[i]; stored.ID == o.ID && stored.Status == orderPending {
+			stored.Status, stored.TxID, stored.Error, stored.UpdatedAt = o.Status, o.TxID, o.Error, o.UpdatedAt
+		}
+	}
+	return nil
+}
+
+func (m *Memory) UpdateOrder(o Order, fill *OrderFill) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if fill != nil {
+		f := *fill
+		f.ID, f.OrderID = int64(len(m.orderFills)+1), o.ID
+		m.orderFills = append(m.orderFills, f)
+	}
+	for i := range m.orders {
+		if stored := &m.orders[i]; stored.ID == o.ID {
+			stored.Status, stored.FilledVolume, stored.AvgPrice = o.Status, o.FilledVolume, o.AvgPrice
+			stored.Cost, stored.Fee, stored.Error, stored.UpdatedAt = o.Cost, o.Fee, o.Error, o.UpdatedAt
+		}
+	}
+	return nil
+}
+
+func (m *Memory) OrderFills(orderID int64) ([]OrderFill, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var fills []OrderFill
+	for _, f := range m.orderFills {
+		if f.OrderID == orderID {
+			fills = append(fills, f)
+		}
+	}
+	return fills, nil
+}
+
+func (m *Memory) TradingHalt() (TradingHalt, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.halt, nil
+}
+
+func (m *Memory) SetTradingHalt(halted bool, reason string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.halt = TradingHalt{Halted: halted, Reason: reason, UpdatedAt: time.Now().UTC()}
+	return nil
+}
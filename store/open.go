@@ -0,0 +1,41 @@
+package store
+
+import (
+	"database/sql"
+	"strings"
+
+	"github.com/jackc/pgx/v5/stdlib"
+	_ "modernc.org/sqlite"
+)
+
+// DefaultSQLiteDSN is the local database used when DATABASE_URL is unset.
+const DefaultSQLiteDSN = "file:btc_prices.db?cache=shared&mode=rwc"
+
+// Dialect names the database engine behind a *sql.DB.
+type Dialect string
+
+const (
+	SQLite   Dialect = "sqlite"
+	Postgres Dialect = "postgres"
+)
+
+// Open connects to url: a postgres:// or postgresql:// URL selects
+// PostgreSQL, anything else is a SQLite DSN (DefaultSQLiteDSN when empty).
+// Queries are written once with ? placeholders for both engines.
+func Open(url string) (*sql.DB, error) {
+	if strings.HasPrefix(url, "postgres://") || strings.HasPrefix(url, "postgresql://") {
+		return openPostgres(url)
+	}
+	if url == "" {
+		url = DefaultSQLiteDSN
+	}
+	return sql.Open("sqlite", strings.TrimPrefix(url, "sqlite:"))
+}
+
+// DialectOf reports which engine db was opened on.
+func DialectOf(db *sql.DB) Dialect {
+	if _, ok := db.Driver().(*stdlib.Driver); ok {
+		return Postgres
+	}
+	return SQLite
+}
@@ -0,0 +1,38 @@
+package store
+
+import "testing"
+
+func TestRebind_NumbersPlaceholders(t *testing.T) {
+	for query, want := range map[string]string{
+		`SELECT 1`: `SELECT 1`,
+		`SELECT id FROM btc_price WHERE symbol = ? AND id > ? LIMIT ?`: `SELECT id FROM btc_price WHERE symbol = $1 AND id > $2 LIMIT $3`,
+		`SELECT '?', "a?b" FROM t WHERE x = ?`:                         `SELECT '?', "a?b" FROM t WHERE x = $1`,
+		"SELECT x -- why?\nFROM t WHERE y = ?":                         "SELECT x -- why?\nFROM t WHERE y = $1",
+		`INSERT INTO settings (symbol) VALUES ('it''s ?') RETURNING ?`: `INSERT INTO settings (symbol) VALUES ('it''s ?') RETURNING $1`,
+	} {
+		if got := rebind(query); got != want {
+			t.Fatalf("expected %q, got %q", want, got)
+		}
+	}
+}
+
+func TestOpen_SelectsDialect(t *testing.T) {
+	db, err := Open("sqlite::memory:")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer db.Close()
+	if d := DialectOf(db); d != SQLite {
+		t.Fatalf("expected sqlite, got %s", d)
+	}
+
+	// Opening does not connect, so no server is needed
+	pg, err := Open("postgres://trader@localhost:5432/trader")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer pg.Close()
+	if d := DialectOf(pg); d != Postgres {
+		t.Fatalf("expected postgres, got %s", d)
+	}
+}
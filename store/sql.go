@@ -0,0 +1,566 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// SQLStore implements Store on the btc_prices.db schema.
+type SQLStore struct {
+	db *sql.DB
+}
+
+var _ Store = (*SQLStore)(nil)
+
+// New returns a Store backed by db, which must already be migrated.
+func New(db *sql.DB) *SQLStore {
+	return &SQLStore{db: db}
+}
+
+// orderPending is the status of an order whose submission outcome is not
+// known yet.
+const orderPending = "pending"
+
+// placeholders returns n comma-separated ? placeholders.
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+func (s *SQLStore) InsertPrice(symbol string, price float64, ts time.Time) (int64, error) {
+	var id int64
+	err := s.db.QueryRow(`INSERT INTO btc_price (symbol, price, timestamp) VALUES (?, ?, ?) RETURNING id`, symbol, price, ts.UTC()).Scan(&id)
+	return id, err
+}
+
+func (s *SQLStore) LatestPrice(symbol string) (Price, error) {
+	p := Price{Symbol: symbol}
+	err := s.db.QueryRow(`SELECT id, price, timestamp FROM btc_price WHERE symbol = ? ORDER BY id DESC LIMIT 1`, symbol).
+		Scan(&p.ID, &p.Price, &p.Timestamp)
+	if err == sql.ErrNoRows {
+		return Price{}, ErrNotFound
+	}
+	return p, err
+}
+
+func (s *SQLStore) PricesSince(symbol string, since time.Time) ([]Price, error) {
+	return s.queryPrices(`SELECT id, price, timestamp FROM btc_price WHERE symbol = ? AND timestamp >= ? ORDER BY timestamp`,
+		symbol, symbol, since.UTC())
+}
+
+func (s *SQLStore) PricesBetween(symbol string, from, to time.Time) ([]Price, error) {
+	return s.queryPrices(`SELECT id, price, timestamp FROM btc_price WHERE symbol = ? AND timestamp >= ? AND timestamp <= ? ORDER BY timestamp`,
+		symbol, symbol, from.UTC(), to.UTC())
+}
+
+func (s *SQLStore) PriceBefore(symbol string, t time.Time) (Price, error) {
+	prices, err := s.queryPrices(`SELECT id, price, timestamp FROM btc_price WHERE symbol = ? AND timestamp < ? ORDER BY timestamp DESC LIMIT 1`,
+		symbol, symbol, t.UTC())
+	if err != nil {
+		return Price{}, err
+	}
+	if len(prices) == 0 {
+		return Price{}, ErrNotFound
+	}
+	return prices[0], nil
+}
+
+func (s *SQLStore) RecentPrices(symbol string, limit int) ([]Price, error) {
+	return s.queryPrices(`SELECT id, price, timestamp FROM btc_price WHERE symbol = ? ORDER BY id DESC LIMIT ?`,
+		symbol, symbol, limit)
+}
+
+// queryPrices reads the rows of a query selecting id, price and timestamp.
+func (s *SQLStore) queryPrices(query, symbol string, args ...interface{}) ([]Price, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var prices []Price
+	for rows.Next() {
+		p := Price{Symbol: symbol}
+		if err := rows.Scan(&p.ID, &p.Price, &p.Timestamp); err != nil {
+			return nil, err
+		}
+		prices = append(prices, p)
+	}
+	return prices, rows.Err()
+}
+
+func (s *SQLStore) Symbols() ([]string, error) {
+	rows, err := s.db.Query(`SELECT DISTINCT symbol FROM btc_price ORDER BY symbol`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var symbols []string
+	for rows.Next() {
+		var symbol string
+		if err := rows.Scan(&symbol); err != nil {
+			return nil, err
+		}
+		symbols = append(symbols, symbol)
+	}
+	return symbols, rows.Err()
+}
+
+func (s *SQLStore) HighSince(symbol string, since time.Time) (float64, error) {
+	var high sql.NullFloat64
+	err := s.db.QueryRow(`SELECT MAX(price) FROM btc_price WHERE symbol = ? AND timestamp >= ?`, symbol, since.UTC()).Scan(&high)
+	return high.Float64, err
+}
+
+func (s *SQLStore) InsertSignal(sig Signal) (int64, error) {
+	if sig.Reason == "" {
+		sig.Reason = "strategy"
+	}
+	var id int64
+	err := s.db.QueryRow(`INSERT INTO trading_signals (price_id, symbol, action, reason, price, quantity, rejection, timestamp)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?) RETURNING id`,
+		sig.PriceID, sig.Symbol, sig.Action, sig.Reason, sig.Price, sig.Quantity, sig.Rejection, sig.Timestamp.UTC()).Scan(&id)
+	return id, err
+}
+
+const signalColumns = `id, COALESCE(price_id, 0), symbol, action, reason, price, quantity, rejection, timestamp`
+
+func (s *SQLStore) SignalsSince(symbol string, since time.Time) ([]Signal, error) {
+	return s.querySignals(`SELECT `+signalColumns+` FROM trading_signals WHERE symbol = ? AND timestamp >= ? ORDER BY timestamp`,
+		symbol, since.UTC())
+}
+
+func (s *SQLStore) RecentSignals(symbol string, limit int) ([]Signal, error) {
+	return s.querySignals(`SELECT `+signalColumns+` FROM trading_signals WHERE symbol = ? ORDER BY id DESC LIMIT ?`,
+		symbol, limit)
+}
+
+func (s *SQLStore) LatestBuy(symbol string) (Signal, error) {
+	signals, err := s.querySignals(`SELECT `+signalColumns+` FROM trading_signals
+		WHERE symbol = ? AND action = 'BUY' AND rejection = '' ORDER BY id DESC LIMIT 1`, symbol)
+	if err != nil {
+		return Signal{}, err
+	}
+	if len(signals) == 0 {
+		return Signal{}, ErrNotFound
+	}
+	return signals[0], nil
+}
+
+func (s *SQLStore) RejectSignal(id int64, rejection string) error {
+	_, err := s.db.Exec(`UPDATE trading_signals SET rejection = ? WHERE id = ?`, rejection, id)
+	return err
+}
+
+func (s *SQLStore) DeleteSignalsAt(priceIDs ...int64) (int, error) {
+	if len(priceIDs) == 0 {
+		return 0, nil
+	}
+	args := make([]interface{}, len(priceIDs))
+	for i, id := range priceIDs {
+		args[i] = id
+	}
+	res, err := s.db.Exec(`DELETE FROM trading_signals WHERE price_id IN (`+placeholders(len(args))+`) AND action IN ('BUY', 'SELL')`, args...)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
+
+// querySignals reads the rows of a query selecting signalColumns.
+func (s *SQLStore) querySignals(query string, args ...interface{}) ([]Signal, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var signals []Signal
+	for rows.Next() {
+		var sig Signal
+		if err := rows.Scan(&sig.ID, &sig.PriceID, &sig.Symbol, &sig.Action, &sig.Reason, &sig.Price,
+			&sig.Quantity, &sig.Rejection, &sig.Timestamp); err != nil {
+			return nil, err
+		}
+		signals = append(signals, sig)
+	}
+	return signals, rows.Err()
+}
+
+func (s *SQLStore) SaveSettings(settings Settings) error {
+	if settings.UpdatedAt.IsZero() {
+		settings.UpdatedAt = time.Now()
+	}
+	_, err := s.db.Exec(`INSERT INTO settings (symbol, initial_funds, transaction_fee_rate, updated_at) VALUES (?, ?, ?, ?)`,
+		settings.Symbol, settings.InitialFunds, settings.FeeRate, settings.UpdatedAt.UTC())
+	return err
+}
+
+func (s *SQLStore) LatestSettings(symbol string) (Settings, error) {
+	var settings Settings
+	var updatedAt sql.NullTime
+	err := s.db.QueryRow(`SELECT symbol, initial_funds, transaction_fee_rate, updated_at FROM settings
+		WHERE symbol IN (?, '') ORDER BY symbol = ? DESC, id DESC LIMIT 1`, symbol, symbol).
+		Scan(&settings.Symbol, &settings.InitialFunds, &settings.FeeRate, &updatedAt)
+	if err == sql.ErrNoRows {
+		return Settings{FeeRate: DefaultFeeRate}, nil
+	}
+	settings.UpdatedAt = updatedAt.Time
+	return settings, err
+}
+
+func (s *SQLStore) CandlesSince(symbol string, interval int, since time.Time) ([]Candle, error) {
+	rows, err := s.db.Query(`SELECT time, open, high, low, close, vwap, volume, count FROM candles
+		WHERE symbol = ? AND interval = ? AND time >= ? ORDER BY time`, symbol, interval, since.UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var candles []Candle
+	for rows.Next() {
+		c := Candle{Symbol: symbol, Interval: interval}
+		if err := rows.Scan(&c.Time, &c.Open, &c.High, &c.Low, &c.Close, &c.VWAP, &c.Volume, &c.Count); err != nil {
+			return nil, err
+		}
+		candles = append(candles, c)
+	}
+	return candles, rows.Err()
+}
+
+func (s *SQLStore) OldestCandleTime(symbol string, interval int) (time.Time, error) {
+	var t time.Time
+	err := s.db.QueryRow(`SELECT time FROM candles WHERE symbol = ? AND interval = ? ORDER BY time LIMIT 1`,
+		symbol, interval).Scan(&t)
+	if err == sql.ErrNoRows {
+		return time.Time{}, nil
+	}
+	return t, err
+}
+
+func (s *SQLStore) LatestCandle(symbol string, interval int) (Candle, error) {
+	c := Candle{Symbol: symbol, Interval: interval}
+	err := s.db.QueryRow(`SELECT time, open, high, low, close, vwap, volume, count FROM candles
+		WHERE symbol = ? AND interval = ? ORDER BY time DESC LIMIT 1`, symbol, interval).
+		Scan(&c.Time, &c.Open, &c.High, &c.Low, &c.Close, &c.VWAP, &c.Volume, &c.Count)
+	if err == sql.ErrNoRows {
+		return Candle{}, ErrNotFound
+	}
+	return c, err
+}
+
+func (s *SQLStore) UpsertCandles(candles []Candle) (int, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	inserted := 0
+	for _, c := range candles {
+		var exists int
+		err := tx.QueryRow(`SELECT COUNT(1) FROM candles WHERE symbol = ? AND interval = ? AND time = ?`,
+			c.Symbol, c.Interval, c.Time.UTC()).Scan(&exists)
+		if err != nil {
+			return 0, err
+		}
+		_, err = tx.Exec(`INSERT INTO candles (symbol, interval, time, open, high, low, close, vwap, volume, count, source)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			ON CONFLICT(symbol, interval, time) DO UPDATE SET
+				open = excluded.open, high = excluded.high, low = excluded.low, close = excluded.close,
+				vwap = excluded.vwap, volume = excluded.volume, count = excluded.count, source = excluded.source`,
+			c.Symbol, c.Interval, c.Time.UTC(), c.Open, c.High, c.Low, c.Close, c.VWAP, c.Volume, c.Count, CandleSourceKraken)
+		if err != nil {
+			return 0, fmt.Errorf("failed to store candle %s %s: %w", c.Symbol, c.Time, err)
+		}
+		if exists == 0 {
+			inserted++
+		}
+	}
+	return inserted, tx.Commit()
+}
+
+func (s *SQLStore) RollUpTicks(ticks ...Price) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, p := range ticks {
+		for _, interval := range TickIntervals {
+			bucket := p.Timestamp.UTC().Truncate(time.Duration(interval) * time.Minute)
+			_, err := tx.Exec(`INSERT INTO candles (symbol, interval, time, open, high, low, close, vwap, volume, count)
+				VALUES (?, ?, ?, ?, ?, ?, ?, 0, 0, 1)
+				ON CONFLICT(symbol, interval, time) DO UPDATE SET
+					high = CASE WHEN excluded.high > candles.high THEN excluded.high ELSE candles.high END,
+					low = CASE WHEN excluded.low < candles.low THEN excluded.low ELSE candles.low END,
+					close = excluded.close, count = candles.count + 1
+				WHERE candles.source = ?`,
+				p.Symbol, interval, bucket, p.Price, p.Price, p.Price, p.Price, CandleSourceTicks)
+			if err != nil {
+				return fmt.Errorf("failed to update %dm candle: %w", interval, err)
+			}
+		}
+		_, err := tx.Exec(`INSERT INTO candle_rollup (symbol, price_id) VALUES (?, ?)
+			ON CONFLICT(symbol) DO UPDATE SET price_id = CASE WHEN excluded.price_id > candle_rollup.price_id THEN excluded.price_id ELSE candle_rollup.price_id END`,
+			p.Symbol, p.ID)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *SQLStore) UnrolledPrices(symbol string) ([]Price, error) {
+	var lastID int64
+	err := s.db.QueryRow(`SELECT price_id FROM candle_rollup WHERE symbol = ?`, symbol).Scan(&lastID)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+	return s.queryPrices(`SELECT id, price, timestamp FROM btc_price WHERE symbol = ? AND id > ? ORDER BY id`,
+		symbol, symbol, lastID)
+}
+
+func (s *SQLStore) PaperAccount(symbol string) (PaperAccount, error) {
+	a := PaperAccount{Symbol: symbol}
+	err := s.db.QueryRow(`SELECT initial_funds, cash FROM paper_balances WHERE symbol = ?`, symbol).Scan(&a.InitialFunds, &a.Cash)
+	if err != nil && err != sql.ErrNoRows {
+		return a, err
+	}
+	a.Traded = err == nil
+
+	var openedAt sql.NullTime
+	err = s.db.QueryRow(`SELECT quantity, entry_price, entry_quantity, opened_at FROM paper_positions WHERE symbol = ?`, symbol).
+		Scan(&a.Quantity, &a.EntryPrice, &a.EntryQuantity, &openedAt)
+	if err != nil && err != sql.ErrNoRows {
+		return a, err
+	}
+	a.OpenedAt = openedAt.Time
+	return a, nil
+}
+
+const paperFillColumns = `id, symbol, side, price, quantity, fee, cash, holdings, COALESCE(signal_id, 0), timestamp`
+
+func (s *SQLStore) PaperFills(symbol string, limit int) ([]PaperFill, error) {
+	return s.queryPaperFills(`SELECT `+paperFillColumns+` FROM paper_fills WHERE symbol = ? ORDER BY id DESC LIMIT ?`, symbol, limit)
+}
+
+func (s *SQLStore) PaperFillsSince(symbol string, since time.Time) ([]PaperFill, error) {
+	return s.queryPaperFills(`SELECT `+paperFillColumns+` FROM paper_fills WHERE (symbol = ? OR ? = '') AND timestamp >= ? ORDER BY id`,
+		symbol, symbol, since.UTC())
+}
+
+func (s *SQLStore) PaperFillBefore(symbol string, t time.Time) (PaperFill, error) {
+	fills, err := s.queryPaperFills(`SELECT `+paperFillColumns+` FROM paper_fills WHERE symbol = ? AND timestamp < ? ORDER BY id DESC LIMIT 1`,
+		symbol, t.UTC())
+	if err != nil {
+		return PaperFill{}, err
+	}
+	if len(fills) == 0 {
+		return PaperFill{}, ErrNotFound
+	}
+	return fills[0], nil
+}
+
+// queryPaperFills reads the rows of a query selecting paperFillColumns.
+func (s *SQLStore) queryPaperFills(query string, args ...interface{}) ([]PaperFill, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var fills []PaperFill
+	for rows.Next() {
+		var f PaperFill
+		if err := rows.Scan(&f.ID, &f.Symbol, &f.Side, &f.Price, &f.Quantity, &f.Fee, &f.Cash, &f.Holdings, &f.SignalID, &f.Timestamp); err != nil {
+			return nil, err
+		}
+		fills = append(fills, f)
+	}
+	return fills, rows.Err()
+}
+
+func (s *SQLStore) RecordPaperFill(a PaperAccount, f PaperFill, hit *LadderHit) (int64, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var openedAt any
+	if !a.OpenedAt.IsZero() {
+		openedAt = a.OpenedAt.UTC()
+	}
+	if _, err := tx.Exec(`INSERT INTO paper_balances (symbol, initial_funds, cash, updated_at) VALUES (?, ?, ?, ?)
+		ON CONFLICT(symbol) DO UPDATE SET initial_funds = excluded.initial_funds, cash = excluded.cash, updated_at = excluded.updated_at`,
+		a.Symbol, a.InitialFunds, a.Cash, f.Timestamp.UTC()); err != nil {
+		return 0, err
+	}
+	if _, err := tx.Exec(`INSERT INTO paper_positions (symbol, quantity, entry_price, entry_quantity, opened_at) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(symbol) DO UPDATE SET quantity = excluded.quantity, entry_price = excluded.entry_price,
+			entry_quantity = excluded.entry_quantity, opened_at = excluded.opened_at`,
+		a.Symbol, a.Quantity, a.EntryPrice, a.EntryQuantity, openedAt); err != nil {
+		return 0, err
+	}
+	var signalID any
+	if f.SignalID != 0 {
+		signalID = f.SignalID
+	}
+	var id int64
+	err = tx.QueryRow(`INSERT INTO paper_fills (symbol, side, price, quantity, fee, cash, holdings, signal_id, timestamp) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?) RETURNING id`,
+		a.Symbol, f.Side, f.Price, f.Quantity, f.Fee, f.Cash, f.Holdings, signalID, f.Timestamp.UTC()).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+	if hit != nil {
+		_, err := tx.Exec(`INSERT INTO ladder_hits (symbol, opened_at, tier, price, quantity, timestamp) VALUES (?, ?, ?, ?, ?, ?)
+			ON CONFLICT DO NOTHING`,
+			hit.Symbol, hit.OpenedAt.UTC(), hit.Tier, hit.Price, hit.Quantity, hit.Timestamp.UTC())
+		if err != nil {
+			return 0, err
+		}
+	}
+	return id, tx.Commit()
+}
+
+func (s *SQLStore) LadderHits(symbol string, openedAt time.Time) (map[float64]bool, error) {
+	rows, err := s.db.Query(`SELECT tier FROM ladder_hits WHERE symbol = ? AND opened_at = ?`, symbol, openedAt.UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	hit := make(map[float64]bool)
+	for rows.Next() {
+		var tier float64
+		if err := rows.Scan(&tier); err != nil {
+			return nil, err
+		}
+		hit[tier] = true
+	}
+	return hit, rows.Err()
+}
+
+const orderColumns = `id, COALESCE(signal_id, 0), symbol, pair, side, order_type, volume, price, txid, status,
+	filled_volume, avg_price, cost, fee, error, created_at, updated_at`
+
+func (s *SQLStore) RecentOrders(symbol string, limit int) ([]Order, error) {
+	return s.queryOrders(`SELECT `+orderColumns+` FROM orders WHERE symbol = ? ORDER BY id DESC LIMIT ?`, symbol, limit)
+}
+
+func (s *SQLStore) OrdersByStatus(statuses ...string) ([]Order, error) {
+	if len(statuses) == 0 {
+		return nil, nil
+	}
+	args := make([]interface{}, len(statuses))
+	for i, status := range statuses {
+		args[i] = status
+	}
+	return s.queryOrders(`SELECT `+orderColumns+` FROM orders WHERE status IN (`+placeholders(len(args))+`) ORDER BY id`, args...)
+}
+
+func (s *SQLStore) OrdersSince(symbol string, since time.Time) ([]Order, error) {
+	return s.queryOrders(`SELECT `+orderColumns+` FROM orders WHERE (symbol = ? OR ? = '') AND created_at >= ? ORDER BY id`,
+		symbol, symbol, since.UTC())
+}
+
+func (s *SQLStore) InsertOrder(o Order) (int64, error) {
+	var signalID any
+	if o.SignalID != 0 {
+		signalID = o.SignalID
+	}
+	var id int64
+	err := s.db.QueryRow(`INSERT INTO orders (signal_id, symbol, pair, side, order_type, volume, price, status, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?) RETURNING id`,
+		signalID, o.Symbol, o.Pair, o.Side, o.OrderType, o.Volume, o.Price, o.Status, o.CreatedAt.UTC(), o.UpdatedAt.UTC()).Scan(&id)
+	return id, err
+}
+
+func (s *SQLStore) UpdatePendingOrder(o Order) error {
+	_, err := s.db.Exec(`UPDATE orders SET status = ?, txid = ?, error = ?, updated_at = ? WHERE id = ? AND status = ?`,
+		o.Status, o.TxID, o.Error, o.UpdatedAt.UTC(), o.ID, orderPending)
+	return err
+}
+
+func (s *SQLStore) UpdateOrder(o Order, fill *OrderFill) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if fill != nil {
+		if _, err := tx.Exec(`INSERT INTO order_fills (order_id, volume, price, cost, fee, timestamp) VALUES (?, ?, ?, ?, ?, ?)`,
+			o.ID, fill.Volume, fill.Price, fill.Cost, fill.Fee, fill.Timestamp.UTC()); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.Exec(`UPDATE orders SET status = ?, filled_volume = ?, avg_price = ?, cost = ?, fee = ?, error = ?, updated_at = ? WHERE id = ?`,
+		o.Status, o.FilledVolume, o.AvgPrice, o.Cost, o.Fee, o.Error, o.UpdatedAt.UTC(), o.ID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *SQLStore) OrderFills(orderID int64) ([]OrderFill, error) {
+	rows, err := s.db.Query(`SELECT id, order_id, volume, price, cost, fee, timestamp FROM order_fills WHERE order_id = ? ORDER BY id`, orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var fills []OrderFill
+	for rows.Next() {
+		var f OrderFill
+		if err := rows.Scan(&f.ID, &f.OrderID, &f.Volume, &f.Price, &f.Cost, &f.Fee, &f.Timestamp); err != nil {
+			return nil, err
+		}
+		fills = append(fills, f)
+	}
+	return fills, rows.Err()
+}
+
+// queryOrders reads the rows of a query selecting orderColumns.
+func (s *SQLStore) queryOrders(query string, args ...interface{}) ([]Order, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var orders []Order
+	for rows.Next() {
+		var o Order
+		var createdAt, updatedAt sql.NullTime
+		if err := rows.Scan(&o.ID, &o.SignalID, &o.Symbol, &o.Pair, &o.Side, &o.OrderType, &o.Volume, &o.Price, &o.TxID, &o.Status,
+			&o.FilledVolume, &o.AvgPrice, &o.Cost, &o.Fee, &o.Error, &createdAt, &updatedAt); err != nil {
+			return nil, err
+		}
+		o.CreatedAt, o.UpdatedAt = createdAt.Time, updatedAt.Time
+		orders = append(orders, o)
+	}
+	return orders, rows.Err()
+}
+
+func (s *SQLStore) TradingHalt() (TradingHalt, error) {
+	var h TradingHalt
+	var updatedAt sql.NullTime
+	err := s.db.QueryRow(`SELECT halted, reason, updated_at FROM trading_halt WHERE id = 1`).Scan(&h.Halted, &h.Reason, &updatedAt)
+	if err == sql.ErrNoRows {
+		return h, nil
+	}
+	h.UpdatedAt = updatedAt.Time
+	return h, err
+}
+
+func (s *SQLStore) SetTradingHalt(halted bool, reason string) error {
+	_, err := s.db.Exec(`INSERT INTO trading_halt (id, halted, reason, updated_at) VALUES (1, ?, ?, ?)
+		ON CONFLICT(id) DO UPDATE SET halted = excluded.halted, reason = excluded.reason, updated_at = excluded.updated_at`,
+		halted, reason, time.Now().UTC())
+	return err
+}
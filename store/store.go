@@ -0,0 +1,260 @@
+// Package store reads and writes the collected prices, trading signals,
+// settings, candles, paper accounts, orders and kill switch behind the Store
+// interface, so the collector, the web handlers, the trading algorithm and
+// the order and risk code never build SQL themselves. Schema migrations,
+// file imports, retention and the Kraken pair cache work on the database
+// directly.
+package store
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrNotFound is returned when a lookup matches no row.
+var ErrNotFound = errors.New("store: not found")
+
+// DefaultFeeRate is the transaction fee percent used until settings are saved.
+const DefaultFeeRate = 1.0
+
+// Price is one collected price tick (a btc_price row).
+type Price struct {
+	ID        int64
+	Symbol    string
+	Price     float64
+	Timestamp time.Time
+}
+
+// Signal is one recorded BUY or SELL (a trading_signals row).
+type Signal struct {
+	ID        int64
+	PriceID   int64 // btc_price row the signal was generated on
+	Symbol    string
+	Action    string  // BUY or SELL
+	Reason    string  // strategy (when empty), exit_ladder, stop_loss, ...
+	Price     float64 // price when the signal fired
+	Quantity  float64 // amount sold by a partial SELL, 0 for the whole position
+	Rejection string  // why the signal was not acted on, if it was not
+	Timestamp time.Time
+}
+
+// Settings are the paper-trading account settings. An empty Symbol applies
+// to every symbol without settings of its own.
+type Settings struct {
+	Symbol       string
+	InitialFunds float64
+	FeeRate      float64 // percent of each trade's value
+	UpdatedAt    time.Time
+}
+
+// TickIntervals are the timeframes (in minutes) collected ticks are rolled up
+// into.
+var TickIntervals = []int{1, 5, 60, 1440}
+
+// Candle sources, stored in candles.source: bars rolled up from collected
+// ticks, and Kraken's OHLC bars with real volume, VWAP and trade counts.
+const (
+	CandleSourceTicks  = "ticks"
+	CandleSourceKraken = "kraken"
+)
+
+// Candle is one OHLC bar for a symbol. Interval is the bar length in minutes,
+// matching Kraken's OHLC interval parameter.
+type Candle struct {
+	Symbol   string    `json:"symbol"`
+	Interval int       `json:"interval"`
+	Time     time.Time `json:"time"` // bar open time, UTC
+	Open     float64   `json:"open"`
+	High     float64   `json:"high"`
+	Low      float64   `json:"low"`
+	Close    float64   `json:"close"`
+	VWAP     float64   `json:"vwap"`
+	Volume   float64   `json:"volume"`
+	Count    int       `json:"count"`
+}
+
+// TradingHalt is the kill switch state (the trading_halt row).
+type TradingHalt struct {
+	Halted    bool      `json:"halted"`
+	Reason    string    `json:"reason"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// PaperAccount is a symbol's stored paper-trading balance and position (its
+// paper_balances and paper_positions rows). Traded is false until the first
+// fill stores a balance.
+type PaperAccount struct {
+	Symbol        string
+	InitialFunds  float64
+	Cash          float64
+	Traded        bool
+	Quantity      float64
+	EntryPrice    float64
+	EntryQuantity float64   // quantity bought, before any partial sells
+	OpenedAt      time.Time // zero when flat
+}
+
+// PaperFill is one simulated trade (a paper_fills row).
+type PaperFill struct {
+	ID        int64     `json:"id"`
+	Symbol    string    `json:"symbol"`
+	Side      string    `json:"side"` // BUY or SELL
+	Price     float64   `json:"price"`
+	Quantity  float64   `json:"quantity"`
+	Fee       float64   `json:"fee"`
+	Cash      float64   `json:"cash"`     // cash after the fill
+	Holdings  float64   `json:"holdings"` // quantity held after the fill
+	SignalID  int64     `json:"signal_id,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// LadderHit is an exit ladder tier sold for the position opened at OpenedAt
+// (a ladder_hits row).
+type LadderHit struct {
+	Symbol    string
+	OpenedAt  time.Time
+	Tier      float64
+	Price     float64
+	Quantity  float64
+	Timestamp time.Time
+}
+
+// Order is an exchange order and its fill progress (an orders row). SignalID
+// links it to the trading_signals row that caused it.
+type Order struct {
+	ID           int64     `json:"id"`
+	SignalID     int64     `json:"signal_id"`
+	Symbol       string    `json:"symbol"`
+	Pair         string    `json:"pair"`
+	Side         string    `json:"side"`
+	OrderType    string    `json:"order_type"`
+	Volume       float64   `json:"volume"`
+	Price        float64   `json:"price"` // limit price, 0 for market orders
+	TxID         string    `json:"txid"`
+	Status       string    `json:"status"`
+	FilledVolume float64   `json:"filled_volume"`
+	AvgPrice     float64   `json:"avg_price"`
+	Cost         float64   `json:"cost"`
+	Fee          float64   `json:"fee"`
+	Error        string    `json:"error,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// OrderFill is the part of an order executed between two status polls (an
+// order_fills row).
+type OrderFill struct {
+	ID        int64     `json:"id"`
+	OrderID   int64     `json:"order_id"`
+	Volume    float64   `json:"volume"`
+	Price     float64   `json:"price"`
+	Cost      float64   `json:"cost"`
+	Fee       float64   `json:"fee"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// Store is the data the collector, web handlers, trading algorithm and order
+// and risk code use.
+type Store interface {
+	// InsertPrice records a price tick and returns its ID.
+	InsertPrice(symbol string, price float64, ts time.Time) (int64, error)
+	// LatestPrice returns symbol's most recent tick, or ErrNotFound.
+	LatestPrice(symbol string) (Price, error)
+	// PricesSince returns symbol's ticks at or after since, oldest first.
+	PricesSince(symbol string, since time.Time) ([]Price, error)
+	// PricesBetween returns symbol's ticks from from to to, both included,
+	// oldest first.
+	PricesBetween(symbol string, from, to time.Time) ([]Price, error)
+	// PriceBefore returns symbol's latest tick before t, or ErrNotFound.
+	PriceBefore(symbol string, t time.Time) (Price, error)
+	// RecentPrices returns symbol's latest limit ticks, newest first.
+	RecentPrices(symbol string, limit int) ([]Price, error)
+	// Symbols returns every symbol with collected prices, sorted.
+	Symbols() ([]string, error)
+	// HighSince returns symbol's highest tick at or after since, or 0 if
+	// there is none.
+	HighSince(symbol string, since time.Time) (float64, error)
+
+	// InsertSignal records a signal and returns its ID.
+	InsertSignal(s Signal) (int64, error)
+	// SignalsSince returns symbol's signals at or after since, oldest first.
+	SignalsSince(symbol string, since time.Time) ([]Signal, error)
+	// RecentSignals returns symbol's latest limit signals, newest first.
+	RecentSignals(symbol string, limit int) ([]Signal, error)
+	// LatestBuy returns symbol's latest BUY signal that was not rejected, or
+	// ErrNotFound.
+	LatestBuy(symbol string) (Signal, error)
+	// RejectSignal records why the signal id was not acted on.
+	RejectSignal(id int64, rejection string) error
+	// DeleteSignalsAt deletes the BUY and SELL signals generated on the
+	// given price ticks and returns how many there were.
+	DeleteSignalsAt(priceIDs ...int64) (int, error)
+
+	// SaveSettings records new settings; the latest saved win.
+	SaveSettings(s Settings) error
+	// LatestSettings returns the settings saved for symbol, falling back to
+	// those saved for every symbol and then to 0 funds and DefaultFeeRate.
+	LatestSettings(symbol string) (Settings, error)
+
+	// CandlesSince returns symbol's candles at interval that opened at or
+	// after since, oldest first.
+	CandlesSince(symbol string, interval int, since time.Time) ([]Candle, error)
+	// OldestCandleTime returns the open time of symbol's earliest candle at
+	// interval, or the zero time if there is none.
+	OldestCandleTime(symbol string, interval int) (time.Time, error)
+	// LatestCandle returns symbol's latest candle at interval, or
+	// ErrNotFound.
+	LatestCandle(symbol string, interval int) (Candle, error)
+	// UpsertCandles stores Kraken candles, replacing any with the same
+	// symbol, interval and open time, and returns how many were new.
+	UpsertCandles(candles []Candle) (int, error)
+	// RollUpTicks folds ticks, in ID order, into the open candle of every
+	// TickIntervals bar and records them as rolled up. Candles from Kraken
+	// are left as they are.
+	RollUpTicks(ticks ...Price) error
+	// UnrolledPrices returns symbol's ticks not rolled up into candles yet,
+	// in ID order.
+	UnrolledPrices(symbol string) ([]Price, error)
+
+	// PaperAccount returns symbol's stored paper account, empty and not
+	// Traded when it has none.
+	PaperAccount(symbol string) (PaperAccount, error)
+	// PaperFills returns symbol's latest limit paper fills, newest first.
+	PaperFills(symbol string, limit int) ([]PaperFill, error)
+	// PaperFillsSince returns symbol's paper fills at or after since, oldest
+	// first. An empty symbol returns every symbol's.
+	PaperFillsSince(symbol string, since time.Time) ([]PaperFill, error)
+	// PaperFillBefore returns symbol's latest paper fill before t, or
+	// ErrNotFound.
+	PaperFillBefore(symbol string, t time.Time) (PaperFill, error)
+	// RecordPaperFill stores the account a, the fill f that produced it and
+	// the exit ladder tier it took, if hit is not nil, in one transaction. It
+	// returns the fill's ID.
+	RecordPaperFill(a PaperAccount, f PaperFill, hit *LadderHit) (int64, error)
+	// LadderHits returns the exit ladder tiers sold for symbol's position
+	// opened at openedAt.
+	LadderHits(symbol string, openedAt time.Time) (map[float64]bool, error)
+
+	// RecentOrders returns symbol's latest limit orders, newest first.
+	RecentOrders(symbol string, limit int) ([]Order, error)
+	// OrdersByStatus returns the orders in any of statuses, oldest first.
+	OrdersByStatus(statuses ...string) ([]Order, error)
+	// OrdersSince returns symbol's orders created at or after since, oldest
+	// first. An empty symbol returns every symbol's.
+	OrdersSince(symbol string, since time.Time) ([]Order, error)
+	// InsertOrder records a new order and returns its ID.
+	InsertOrder(o Order) (int64, error)
+	// UpdatePendingOrder stores o's status, txid, error and update time,
+	// unless the stored order has already left the pending state.
+	UpdatePendingOrder(o Order) error
+	// UpdateOrder stores o's status, fill progress, error and update time,
+	// and fill, if not nil, in one transaction.
+	UpdateOrder(o Order, fill *OrderFill) error
+	// OrderFills returns the fills recorded for an order, oldest first.
+	OrderFills(orderID int64) ([]OrderFill, error)
+
+	// TradingHalt returns the kill switch state; trading runs until it is set.
+	TradingHalt() (TradingHalt, error)
+	// SetTradingHalt sets the kill switch.
+	SetTradingHalt(halted bool, reason string) error
+}
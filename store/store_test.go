@@ -0,0 +1,401 @@
+package store
+
+import (
+	"database/sql"
+	"strings"
+	"testing"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+func openTestSQLStore(t *testing.T) *SQLStore {
+	t.Helper()
+	db, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatalf("failed to open db: %v", err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+	for _, ddl := range []string{
+		`CREATE TABLE btc_price (id INTEGER PRIMARY KEY AUTOINCREMENT, symbol TEXT NOT NULL DEFAULT 'XBT', price REAL, timestamp DATETIME)`,
+		`CREATE TABLE settings (id INTEGER PRIMARY KEY AUTOINCREMENT, symbol TEXT NOT NULL DEFAULT '', initial_funds REAL DEFAULT 0, transaction_fee_rate REAL DEFAULT 1.0, updated_at DATETIME DEFAULT CURRENT_TIMESTAMP)`,
+		`CREATE TABLE trading_signals (id INTEGER PRIMARY KEY AUTOINCREMENT, price_id INTEGER, symbol TEXT NOT NULL DEFAULT 'XBT', action TEXT, price REAL, timestamp DATETIME,
+			quantity REAL NOT NULL DEFAULT 0, reason TEXT NOT NULL DEFAULT 'strategy', rejection TEXT NOT NULL DEFAULT '')`,
+		`CREATE TABLE candles (id INTEGER PRIMARY KEY AUTOINCREMENT, symbol TEXT NOT NULL, interval INTEGER NOT NULL, time DATETIME NOT NULL,
+			open REAL, high REAL, low REAL, close REAL, vwap REAL, volume REAL, count INTEGER, source TEXT NOT NULL DEFAULT 'ticks', UNIQUE(symbol, interval, time))`,
+		`CREATE TABLE candle_rollup (symbol TEXT PRIMARY KEY, price_id INTEGER NOT NULL)`,
+		`CREATE TABLE paper_balances (symbol TEXT PRIMARY KEY, initial_funds REAL NOT NULL, cash REAL NOT NULL, updated_at DATETIME)`,
+		`CREATE TABLE paper_positions (symbol TEXT PRIMARY KEY, quantity REAL NOT NULL DEFAULT 0, entry_price REAL NOT NULL DEFAULT 0,
+			entry_quantity REAL NOT NULL DEFAULT 0, opened_at DATETIME)`,
+		`CREATE TABLE paper_fills (id INTEGER PRIMARY KEY AUTOINCREMENT, symbol TEXT NOT NULL, side TEXT NOT NULL, price REAL NOT NULL,
+			quantity REAL NOT NULL, fee REAL NOT NULL, cash REAL NOT NULL, holdings REAL NOT NULL, signal_id INTEGER, timestamp DATETIME)`,
+		`CREATE TABLE ladder_hits (symbol TEXT NOT NULL, opened_at DATETIME NOT NULL, tier REAL NOT NULL, price REAL NOT NULL,
+			quantity REAL NOT NULL, timestamp DATETIME, UNIQUE(symbol, opened_at, tier))`,
+		`CREATE TABLE orders (id INTEGER PRIMARY KEY AUTOINCREMENT, signal_id INTEGER, symbol TEXT NOT NULL, pair TEXT NOT NULL, side TEXT NOT NULL,
+			order_type TEXT NOT NULL, volume REAL NOT NULL, price REAL NOT NULL DEFAULT 0, txid TEXT NOT NULL DEFAULT '', status TEXT NOT NULL,
+			filled_volume REAL NOT NULL DEFAULT 0, avg_price REAL NOT NULL DEFAULT 0, cost REAL NOT NULL DEFAULT 0, fee REAL NOT NULL DEFAULT 0,
+			error TEXT NOT NULL DEFAULT '', created_at DATETIME, updated_at DATETIME)`,
+		`CREATE TABLE order_fills (id INTEGER PRIMARY KEY AUTOINCREMENT, order_id INTEGER NOT NULL, volume REAL NOT NULL, price REAL NOT NULL,
+			cost REAL NOT NULL, fee REAL NOT NULL, timestamp DATETIME)`,
+		`CREATE TABLE trading_halt (id INTEGER PRIMARY KEY CHECK (id = 1), halted INTEGER NOT NULL DEFAULT 0, reason TEXT NOT NULL DEFAULT '', updated_at DATETIME)`,
+	} {
+		if _, err := db.Exec(ddl); err != nil {
+			t.Fatalf("setup failed: %v", err)
+		}
+	}
+	return New(db)
+}
+
+// forEachStore runs test against the SQL store and the in-memory fake, so
+// both behave the same.
+func forEachStore(t *testing.T, test func(t *testing.T, s Store)) {
+	t.Run("sql", func(t *testing.T) { test(t, openTestSQLStore(t)) })
+	t.Run("memory", func(t *testing.T) { test(t, NewMemory()) })
+}
+
+func TestStore_Prices(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+		if _, err := s.LatestPrice("XBT"); err != ErrNotFound {
+			t.Fatalf("expected ErrNotFound, got %v", err)
+		}
+		for i, price := range []float64{100, 101, 102} {
+			if _, err := s.InsertPrice("XBT", price, start.Add(time.Duration(i)*time.Hour)); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		}
+		s.InsertPrice("ETH", 10, start)
+
+		latest, err := s.LatestPrice("XBT")
+		if err != nil || latest.Price != 102 || !latest.Timestamp.Equal(start.Add(2*time.Hour)) {
+			t.Fatalf("expected 102 at 02:00, got %+v, %v", latest, err)
+		}
+		since, err := s.PricesSince("XBT", start.Add(time.Hour))
+		if err != nil || len(since) != 2 || since[0].Price != 101 {
+			t.Fatalf("expected [101 102], got %+v, %v", since, err)
+		}
+		between, err := s.PricesBetween("XBT", start, start.Add(time.Hour))
+		if err != nil || len(between) != 2 || between[1].Price != 101 {
+			t.Fatalf("expected [100 101], got %+v, %v", between, err)
+		}
+		if before, err := s.PriceBefore("XBT", start.Add(time.Hour)); err != nil || before.Price != 100 {
+			t.Fatalf("expected 100 before 01:00, got %+v, %v", before, err)
+		}
+		if _, err := s.PriceBefore("XBT", start); err != ErrNotFound {
+			t.Fatalf("expected ErrNotFound before the first tick, got %v", err)
+		}
+		recent, err := s.RecentPrices("XBT", 2)
+		if err != nil || len(recent) != 2 || recent[0].Price != 102 || recent[1].Price != 101 {
+			t.Fatalf("expected [102 101], got %+v, %v", recent, err)
+		}
+		symbols, err := s.Symbols()
+		if err != nil || len(symbols) != 2 || symbols[0] != "ETH" || symbols[1] != "XBT" {
+			t.Fatalf("expected [ETH XBT], got %v, %v", symbols, err)
+		}
+	})
+}
+
+func TestStore_Signals(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+		s.InsertSignal(Signal{PriceID: 1, Symbol: "XBT", Action: "BUY", Price: 100, Timestamp: start})
+		s.InsertSignal(Signal{PriceID: 2, Symbol: "XBT", Action: "SELL", Reason: "stop_loss", Price: 95, Quantity: 0.5, Timestamp: start.Add(time.Hour)})
+		s.InsertSignal(Signal{PriceID: 3, Symbol: "ETH", Action: "BUY", Price: 10, Timestamp: start})
+
+		signals, err := s.SignalsSince("XBT", start)
+		if err != nil || len(signals) != 2 {
+			t.Fatalf("expected 2 XBT signals, got %+v, %v", signals, err)
+		}
+		if signals[0].Reason != "strategy" || signals[1].Reason != "stop_loss" || signals[1].Quantity != 0.5 || signals[1].PriceID != 2 {
+			t.Fatalf("unexpected signals %+v", signals)
+		}
+		if later, _ := s.SignalsSince("XBT", start.Add(time.Minute)); len(later) != 1 {
+			t.Fatalf("expected 1 signal after 00:01, got %+v", later)
+		}
+		if recent, _ := s.RecentSignals("XBT", 1); len(recent) != 1 || recent[0].Action != "SELL" {
+			t.Fatalf("expected the SELL as the latest signal, got %+v", recent)
+		}
+
+		if n, err := s.DeleteSignalsAt(2, 3); err != nil || n != 2 {
+			t.Fatalf("expected 2 signals deleted, got %d, %v", n, err)
+		}
+		if left, _ := s.SignalsSince("XBT", start); len(left) != 1 || left[0].PriceID != 1 {
+			t.Fatalf("expected only the BUY on price 1 left, got %+v", left)
+		}
+	})
+}
+
+func TestStore_LatestBuy(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+		if _, err := s.LatestBuy("XBT"); err != ErrNotFound {
+			t.Fatalf("expected ErrNotFound, got %v", err)
+		}
+		s.InsertSignal(Signal{Symbol: "XBT", Action: "BUY", Price: 100, Timestamp: start})
+		id, _ := s.InsertSignal(Signal{Symbol: "XBT", Action: "BUY", Price: 110, Timestamp: start.Add(time.Hour)})
+		if buy, err := s.LatestBuy("XBT"); err != nil || buy.Price != 110 {
+			t.Fatalf("expected the $110 buy, got %+v, %v", buy, err)
+		}
+		if err := s.RejectSignal(id, "max_order_usd"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if buy, err := s.LatestBuy("XBT"); err != nil || buy.Price != 100 {
+			t.Fatalf("expected the rejected buy to be skipped, got %+v, %v", buy, err)
+		}
+		if recent, _ := s.RecentSignals("XBT", 1); recent[0].Rejection != "max_order_usd" {
+			t.Fatalf("expected the rejection stored, got %+v", recent[0])
+		}
+
+		for i, price := range []float64{90, 120, 105} {
+			s.InsertPrice("XBT", price, start.Add(time.Duration(i)*time.Hour))
+		}
+		if high, err := s.HighSince("XBT", start.Add(time.Minute)); err != nil || high != 120 {
+			t.Fatalf("expected a $120 high, got %v, %v", high, err)
+		}
+		if high, _ := s.HighSince("ETH", start); high != 0 {
+			t.Fatalf("expected no ETH high, got %v", high)
+		}
+	})
+}
+
+func TestStore_TradingHalt(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		if halt, err := s.TradingHalt(); err != nil || halt.Halted {
+			t.Fatalf("expected trading to run, got %+v, %v", halt, err)
+		}
+		s.SetTradingHalt(true, "maintenance")
+		if halt, _ := s.TradingHalt(); !halt.Halted || halt.Reason != "maintenance" || halt.UpdatedAt.IsZero() {
+			t.Fatalf("expected the halt stored, got %+v", halt)
+		}
+		s.SetTradingHalt(false, "")
+		if halt, _ := s.TradingHalt(); halt.Halted {
+			t.Fatalf("expected trading resumed, got %+v", halt)
+		}
+	})
+}
+
+func TestStore_Settings(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		settings, err := s.LatestSettings("XBT")
+		if err != nil || settings.InitialFunds != 0 || settings.FeeRate != DefaultFeeRate {
+			t.Fatalf("expected defaults, got %+v, %v", settings, err)
+		}
+		s.SaveSettings(Settings{InitialFunds: 500, FeeRate: 0.5})
+		if settings, _ = s.LatestSettings("XBT"); settings.InitialFunds != 500 {
+			t.Fatalf("expected the settings for every symbol, got %+v", settings)
+		}
+		s.SaveSettings(Settings{Symbol: "XBT", InitialFunds: 1000, FeeRate: 0.2})
+		s.SaveSettings(Settings{InitialFunds: 700, FeeRate: 0.4})
+		if settings, _ = s.LatestSettings("XBT"); settings.InitialFunds != 1000 || settings.FeeRate != 0.2 {
+			t.Fatalf("expected XBT's own settings to win, got %+v", settings)
+		}
+		if settings, _ = s.LatestSettings("ETH"); settings.InitialFunds != 700 {
+			t.Fatalf("expected the latest settings for every symbol, got %+v", settings)
+		}
+	})
+}
+
+func TestStore_Candles(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	candles := []Candle{
+		{Symbol: "XBT", Interval: 60, Time: start, Close: 100},
+		{Symbol: "XBT", Interval: 60, Time: start.Add(time.Hour), Close: 101},
+		{Symbol: "XBT", Interval: 5, Time: start, Close: 99},
+	}
+	sqlStore := openTestSQLStore(t)
+	for _, c := range candles {
+		if _, err := sqlStore.db.Exec(`INSERT INTO candles (symbol, interval, time, open, high, low, close, vwap, volume, count) VALUES (?, ?, ?, 0, 0, 0, ?, 0, 0, 0)`,
+			c.Symbol, c.Interval, c.Time, c.Close); err != nil {
+			t.Fatalf("setup failed: %v", err)
+		}
+	}
+	mem := NewMemory()
+	mem.AddCandles(candles...)
+
+	for name, s := range map[string]Store{"sql": sqlStore, "memory": mem} {
+		got, err := s.CandlesSince("XBT", 60, start.Add(time.Minute))
+		if err != nil || len(got) != 1 || got[0].Close != 101 {
+			t.Fatalf("%s: expected the 01:00 hourly candle, got %+v, %v", name, got, err)
+		}
+		if oldest, _ := s.OldestCandleTime("XBT", 60); !oldest.Equal(start) {
+			t.Fatalf("%s: expected oldest %v, got %v", name, start, oldest)
+		}
+		if oldest, _ := s.OldestCandleTime("ETH", 60); !oldest.IsZero() {
+			t.Fatalf("%s: expected no ETH candles, got %v", name, oldest)
+		}
+	}
+}
+
+func TestStore_PaperAccountsAndOrders(t *testing.T) {
+	opened := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	sqlStore := openTestSQLStore(t)
+	for _, q := range []string{
+		`INSERT INTO paper_balances (symbol, initial_funds, cash) VALUES ('XBT', 1000, 10)`,
+		`INSERT INTO paper_positions (symbol, quantity, entry_price, entry_quantity, opened_at) VALUES ('XBT', 0.5, 100, 1, ?)`,
+		`INSERT INTO paper_fills (symbol, side, price, quantity, fee, cash, holdings, signal_id, timestamp) VALUES ('XBT', 'BUY', 100, 1, 1, 0, 1, 1, ?)`,
+		`INSERT INTO paper_fills (symbol, side, price, quantity, fee, cash, holdings, timestamp) VALUES ('XBT', 'SELL', 110, 0.5, 1, 10, 0.5, ?)`,
+		`INSERT INTO ladder_hits (symbol, opened_at, tier, price, quantity, timestamp) VALUES ('XBT', ?, 10, 110, 0.5, ?)`,
+		`INSERT INTO orders (symbol, pair, side, order_type, volume, status, created_at, updated_at) VALUES ('XBT', 'XXBTZUSD', 'buy', 'market', 1, 'filled', ?, ?)`,
+		`INSERT INTO orders (symbol, pair, side, order_type, volume, status, created_at, updated_at) VALUES ('XBT', 'XXBTZUSD', 'sell', 'market', 0.5, 'pending', ?, ?)`,
+	} {
+		args := make([]interface{}, strings.Count(q, "?"))
+		for i := range args {
+			args[i] = opened
+		}
+		if _, err := sqlStore.db.Exec(q, args...); err != nil {
+			t.Fatalf("setup failed: %v", err)
+		}
+	}
+	mem := NewMemory()
+	mem.SetPaperAccount(PaperAccount{Symbol: "XBT", InitialFunds: 1000, Cash: 10, Traded: true, Quantity: 0.5, EntryPrice: 100, EntryQuantity: 1, OpenedAt: opened})
+	mem.AddPaperFills(
+		PaperFill{Symbol: "XBT", Side: "BUY", Price: 100, Quantity: 1, Fee: 1, Holdings: 1, SignalID: 1, Timestamp: opened},
+		PaperFill{Symbol: "XBT", Side: "SELL", Price: 110, Quantity: 0.5, Fee: 1, Cash: 10, Holdings: 0.5, Timestamp: opened},
+	)
+	mem.AddLadderHit("XBT", opened, 10)
+	mem.AddOrders(
+		Order{Symbol: "XBT", Pair: "XXBTZUSD", Side: "buy", OrderType: "market", Volume: 1, Status: "filled", CreatedAt: opened, UpdatedAt: opened},
+		Order{Symbol: "XBT", Pair: "XXBTZUSD", Side: "sell", OrderType: "market", Volume: 0.5, Status: "pending", CreatedAt: opened, UpdatedAt: opened},
+	)
+
+	for name, s := range map[string]Store{"sql": sqlStore, "memory": mem} {
+		a, err := s.PaperAccount("XBT")
+		if err != nil || !a.Traded || a.Cash != 10 || a.Quantity != 0.5 || a.EntryQuantity != 1 || !a.OpenedAt.Equal(opened) {
+			t.Fatalf("%s: unexpected account %+v, %v", name, a, err)
+		}
+		if a, _ := s.PaperAccount("ETH"); a.Traded || a.Cash != 0 || a.Symbol != "ETH" {
+			t.Fatalf("%s: expected an empty ETH account, got %+v", name, a)
+		}
+		fills, err := s.PaperFills("XBT", 10)
+		if err != nil || len(fills) != 2 || fills[0].Side != "SELL" || fills[1].SignalID != 1 {
+			t.Fatalf("%s: expected the SELL then the BUY, got %+v, %v", name, fills, err)
+		}
+		if hit, _ := s.LadderHits("XBT", opened); !hit[10] || len(hit) != 1 {
+			t.Fatalf("%s: expected the 10%% tier hit, got %v", name, hit)
+		}
+		if hit, _ := s.LadderHits("XBT", opened.Add(time.Hour)); len(hit) != 0 {
+			t.Fatalf("%s: expected no hits for a later position, got %v", name, hit)
+		}
+		if orders, err := s.RecentOrders("XBT", 1); err != nil || len(orders) != 1 || orders[0].Side != "sell" {
+			t.Fatalf("%s: expected the sell as the latest order, got %+v, %v", name, orders, err)
+		}
+		if orders, _ := s.OrdersByStatus("pending", "submitted"); len(orders) != 1 || orders[0].Status != "pending" {
+			t.Fatalf("%s: expected one pending order, got %+v", name, orders)
+		}
+	}
+}
+
+func TestStore_RollUpTicks(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+		backfilled := Candle{Symbol: "XBT", Interval: 60, Time: start, Open: 100, High: 110, Low: 90, Close: 105, VWAP: 102, Volume: 12.5, Count: 40}
+		if n, err := s.UpsertCandles([]Candle{backfilled}); err != nil || n != 1 {
+			t.Fatalf("expected 1 new candle, got %d, %v", n, err)
+		}
+		if n, _ := s.UpsertCandles([]Candle{backfilled}); n != 0 {
+			t.Fatalf("expected a rerun to add nothing, got %d", n)
+		}
+		for i, price := range []float64{120, 95, 98} {
+			s.InsertPrice("XBT", price, start.Add(time.Duration(i)*20*time.Second))
+		}
+
+		ticks, err := s.UnrolledPrices("XBT")
+		if err != nil || len(ticks) != 3 {
+			t.Fatalf("expected 3 ticks to roll up, got %+v, %v", ticks, err)
+		}
+		if err := s.RollUpTicks(ticks...); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if ticks, _ := s.UnrolledPrices("XBT"); len(ticks) != 0 {
+			t.Fatalf("expected every tick rolled up, got %+v", ticks)
+		}
+
+		minute, err := s.LatestCandle("XBT", 1)
+		if err != nil || minute.Open != 120 || minute.High != 120 || minute.Low != 95 || minute.Close != 98 || minute.Count != 3 {
+			t.Fatalf("unexpected 1m candle %+v, %v", minute, err)
+		}
+		// Ticks leave Kraken's candles alone
+		if hourly, _ := s.LatestCandle("XBT", 60); hourly != backfilled {
+			t.Fatalf("expected backfilled candle %+v unchanged, got %+v", backfilled, hourly)
+		}
+		if _, err := s.LatestCandle("ETH", 60); err != ErrNotFound {
+			t.Fatalf("expected ErrNotFound, got %v", err)
+		}
+	})
+}
+
+func TestStore_RecordPaperFill(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		opened := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+		buy := PaperFill{Side: "BUY", Price: 100, Quantity: 1, Fee: 1, Holdings: 1, SignalID: 7, Timestamp: opened}
+		if _, err := s.RecordPaperFill(PaperAccount{Symbol: "XBT", InitialFunds: 101, Quantity: 1, EntryPrice: 100, EntryQuantity: 1, OpenedAt: opened}, buy, nil); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		sell := PaperFill{Side: "SELL", Price: 110, Quantity: 0.5, Fee: 1, Cash: 54, Holdings: 0.5, Timestamp: opened.Add(time.Hour)}
+		hit := &LadderHit{Symbol: "XBT", OpenedAt: opened, Tier: 10, Price: 110, Quantity: 0.5, Timestamp: sell.Timestamp}
+		id, err := s.RecordPaperFill(PaperAccount{Symbol: "XBT", InitialFunds: 101, Cash: 54, Quantity: 0.5, EntryPrice: 100, EntryQuantity: 1, OpenedAt: opened}, sell, hit)
+		if err != nil || id == 0 {
+			t.Fatalf("unexpected fill ID %d, %v", id, err)
+		}
+
+		a, err := s.PaperAccount("XBT")
+		if err != nil || !a.Traded || a.Cash != 54 || a.Quantity != 0.5 || !a.OpenedAt.Equal(opened) {
+			t.Fatalf("unexpected account %+v, %v", a, err)
+		}
+		if hits, _ := s.LadderHits("XBT", opened); !hits[10] {
+			t.Fatalf("expected the 10%% tier hit, got %v", hits)
+		}
+		if fills, err := s.PaperFillsSince("", opened.Add(time.Minute)); err != nil || len(fills) != 1 || fills[0].ID != id || fills[0].Symbol != "XBT" {
+			t.Fatalf("expected the SELL, got %+v, %v", fills, err)
+		}
+		if fill, err := s.PaperFillBefore("XBT", opened.Add(time.Hour)); err != nil || fill.Side != "BUY" || fill.SignalID != 7 {
+			t.Fatalf("expected the BUY, got %+v, %v", fill, err)
+		}
+		if _, err := s.PaperFillBefore("XBT", opened); err != ErrNotFound {
+			t.Fatalf("expected ErrNotFound, got %v", err)
+		}
+	})
+}
+
+func TestStore_OrderUpdates(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		created := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+		o := Order{SignalID: 3, Symbol: "XBT", Pair: "XBTUSD", Side: "buy", OrderType: "market", Volume: 1, Status: "pending", CreatedAt: created, UpdatedAt: created}
+		id, err := s.InsertOrder(o)
+		if err != nil || id == 0 {
+			t.Fatalf("unexpected order ID %d, %v", id, err)
+		}
+		o.ID = id
+
+		o.Status, o.TxID, o.UpdatedAt = "submitted", "OTX1", created.Add(time.Second)
+		if err := s.UpdatePendingOrder(o); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		// Only a pending order takes the submission outcome
+		stale := o
+		stale.Status, stale.Error = "rejected", "too late"
+		s.UpdatePendingOrder(stale)
+
+		o.Status, o.FilledVolume, o.AvgPrice, o.Cost, o.Fee = "partially_filled", 0.4, 100, 40, 0.1
+		fill := &OrderFill{Volume: 0.4, Price: 100, Cost: 40, Fee: 0.1, Timestamp: created.Add(time.Minute)}
+		if err := s.UpdateOrder(o, fill); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		orders, err := s.OrdersSince("", created)
+		if err != nil || len(orders) != 1 {
+			t.Fatalf("expected 1 order, got %+v, %v", orders, err)
+		}
+		if got := orders[0]; got.Status != "partially_filled" || got.TxID != "OTX1" || got.FilledVolume != 0.4 || got.Error != "" || got.SignalID != 3 {
+			t.Fatalf("unexpected order %+v", got)
+		}
+		if orders, _ := s.OrdersSince("ETH", created); len(orders) != 0 {
+			t.Fatalf("expected no ETH orders, got %+v", orders)
+		}
+		fills, err := s.OrderFills(id)
+		if err != nil || len(fills) != 1 || fills[0].OrderID != id || fills[0].Volume != 0.4 {
+			t.Fatalf("expected the 0.4 fill, got %+v, %v", fills, err)
+		}
+	})
+}
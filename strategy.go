@@ -0,0 +1,186 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"crypto-trader/store"
+)
+
+// Series is the price history a Strategy evaluates: fixed-interval candles for
+// one symbol, oldest first, ending at Now.
+type Series struct {
+	Symbol   string
+	Interval int       // candle length in minutes
+	Candles  []Candle  // candles covering at least the strategy's lookback, when available
+	Start    time.Time // open time of the earliest stored candle, zero if none
+	Price    float64   // latest price
+	Now      time.Time
+}
+
+// Closes returns the close of every candle in the series, for feeding the
+// indicators package.
+func (s Series) Closes() []float64 {
+	return candleCloses(s.Candles)
+}
+
+// HLC returns the high, low and close of every candle in the series.
+func (s Series) HLC() (high, low, close []float64) {
+	return candleHLC(s.Candles)
+}
+
+// Strategy turns a price series into a trading signal. Implementations are
+// registered by name with RegisterStrategy and selected via the STRATEGY and
+// STRATEGY_PARAMS settings.
+type Strategy interface {
+	Name() string
+	Params() map[string]string
+	// History reports which candle interval (minutes) and how much history
+	// the strategy needs loaded into its Series.
+	History() (interval int, lookback time.Duration)
+	Evaluate(series Series) *TradingSignal
+}
+
+// StreamingStrategy is a Strategy that can keep its indicator state between
+// evaluations. The backtester feeds it each candle once as it closes instead
+// of rebuilding the lookback Series at every replayed price.
+type StreamingStrategy interface {
+	Strategy
+	// NewStream returns fresh state for one replay.
+	NewStream() StrategyStream
+}
+
+// StrategyStream is the state a StreamingStrategy keeps for one replay.
+type StrategyStream interface {
+	// Close adds a candle that has closed. Candles arrive oldest first.
+	Close(c Candle)
+	// Evaluate returns the signal Strategy.Evaluate would give for the
+	// closed candles plus bar, the candle in progress. series carries
+	// everything but Candles.
+	Evaluate(bar Candle, series Series) *TradingSignal
+}
+
+// StrategyFactory builds a strategy from its parameters. Missing parameters
+// take the strategy's defaults.
+type StrategyFactory func(params map[string]string) (Strategy, error)
+
+var (
+	strategiesMu sync.RWMutex
+	strategies   = make(map[string]StrategyFactory)
+)
+
+// RegisterStrategy makes a strategy available by name. Custom strategies call
+// it from an init function in their own file.
+func RegisterStrategy(name string, factory StrategyFactory) {
+	strategiesMu.Lock()
+	defer strategiesMu.Unlock()
+	if _, dup := strategies[name]; dup {
+		panic("strategy already registered: " + name)
+	}
+	strategies[name] = factory
+}
+
+// strategyNames returns the registered strategy names in sorted order.
+func strategyNames() []string {
+	strategiesMu.RLock()
+	defer strategiesMu.RUnlock()
+	var names []string
+	for n := range strategies {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// newStrategy builds the strategy registered under name.
+func newStrategy(name string, params map[string]string) (Strategy, error) {
+	strategiesMu.RLock()
+	factory, ok := strategies[name]
+	strategiesMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown strategy %q (available: %s)", name, strings.Join(strategyNames(), ", "))
+	}
+	return factory(params)
+}
+
+// parseStrategyParams parses "key=value,key=value" into a map.
+func parseStrategyParams(s string) (map[string]string, error) {
+	params := make(map[string]string)
+	for _, kv := range strings.Split(s, ",") {
+		kv = strings.TrimSpace(kv)
+		if kv == "" {
+			continue
+		}
+		k, v, ok := strings.Cut(kv, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid strategy parameter %q, expected key=value", kv)
+		}
+		params[strings.TrimSpace(k)] = strings.TrimSpace(v)
+	}
+	return params, nil
+}
+
+// formatStrategyParams renders params in the form parseStrategyParams accepts.
+func formatStrategyParams(params map[string]string) string {
+	var keys []string
+	for k := range params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var parts []string
+	for _, k := range keys {
+		parts = append(parts, k+"="+params[k])
+	}
+	return strings.Join(parts, ",")
+}
+
+// configuredStrategy builds the strategy named by STRATEGY (default
+// wma_crossover) with the parameters in STRATEGY_PARAMS.
+func configuredStrategy() (Strategy, error) {
+	name := strings.TrimSpace(os.Getenv("STRATEGY"))
+	if name == "" {
+		name = "wma_crossover"
+	}
+	params, err := parseStrategyParams(os.Getenv("STRATEGY_PARAMS"))
+	if err != nil {
+		return nil, err
+	}
+	return newStrategy(name, params)
+}
+
+// loadSeries reads the candles strategy needs for symbol as of now.
+func loadSeries(st store.Store, strategy Strategy, symbol string, currentPrice float64, now time.Time) (Series, error) {
+	interval, lookback := strategy.History()
+	step := time.Duration(interval) * time.Minute
+
+	// Load one extra bar so strategies can compare against the previous bar
+	candles, err := st.CandlesSince(symbol, interval, now.Add(-lookback-2*step))
+	if err != nil {
+		return Series{}, fmt.Errorf("failed to fetch candles: %w", err)
+	}
+	start, err := st.OldestCandleTime(symbol, interval)
+	if err != nil {
+		return Series{}, fmt.Errorf("failed to fetch candles: %w", err)
+	}
+	return Series{
+		Symbol:   symbol,
+		Interval: interval,
+		Candles:  candles,
+		Start:    start,
+		Price:    currentPrice,
+		Now:      now,
+	}, nil
+}
+
+// TradingAlgorithm evaluates strategy against the stored history for symbol.
+func TradingAlgorithm(st store.Store, strategy Strategy, symbol string, currentPrice float64) (*TradingSignal, error) {
+	series, err := loadSeries(st, strategy, symbol, currentPrice, time.Now().UTC())
+	if err != nil {
+		return nil, err
+	}
+	return strategy.Evaluate(series), nil
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// alwaysBuy is a minimal custom strategy used to check the registry.
+type alwaysBuy struct{}
+
+func (alwaysBuy) Name() string                  { return "always_buy" }
+func (alwaysBuy) Params() map[string]string     { return nil }
+func (alwaysBuy) History() (int, time.Duration) { return 60, time.Hour }
+func (alwaysBuy) Evaluate(s Series) *TradingSignal {
+	return &TradingSignal{Action: "BUY", CurrentPrice: s.Price}
+}
+
+var registerAlwaysBuy sync.Once
+
+func TestRegisterStrategy_CustomStrategyIsSelectable(t *testing.T) {
+	registerAlwaysBuy.Do(func() {
+		RegisterStrategy("always_buy", func(params map[string]string) (Strategy, error) { return alwaysBuy{}, nil })
+	})
+
+	t.Setenv("STRATEGY", "always_buy")
+	strategy, err := configuredStrategy()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := strategy.Evaluate(Series{Price: 42}); got.Action != "BUY" || got.CurrentPrice != 42 {
+		t.Fatalf("unexpected signal: %+v", got)
+	}
+}
+
+func TestNewStrategy_WMACrossoverParams(t *testing.T) {
+	params, err := parseStrategyParams("fast=4h, slow=1d")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	strategy, err := newStrategy("wma_crossover", params)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := formatStrategyParams(strategy.Params()); got != "fast=4h,slow=1d,threshold=0" {
+		t.Fatalf("expected fast=4h,slow=1d,threshold=0, got %s", got)
+	}
+
+	if _, err := newStrategy("wma_crossover", map[string]string{"threshold": "-1"}); err == nil {
+		t.Fatalf("expected error for a negative threshold")
+	}
+	if _, err := newStrategy("wma_crossover", map[string]string{"fast": "30d", "slow": "7d"}); err == nil {
+		t.Fatalf("expected error when fast window is not shorter than slow")
+	}
+	if _, err := newStrategy("nope", nil); err == nil {
+		t.Fatalf("expected error for unknown strategy")
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// defaultSymbol is the symbol assumed for rows recorded before multi-ticker
+// support, and the one collected when no ticker is configured.
+const defaultSymbol = "XBT"
+
+// normalizeSymbol maps a user-supplied ticker to the symbol stored in the
+// database. Kraken asset codes are used as the canonical form, so "btc" and
+// "XBT" both become "XBT".
+func normalizeSymbol(symbol string) string {
+	return krakenTicker(strings.TrimSpace(symbol))
+}
+
+// configuredTickers returns the symbols to collect, read from the comma
+// separated TICKERS setting or, for older .env files, the single TICKER.
+func configuredTickers() []string {
+	val := os.Getenv("TICKERS")
+	if val == "" {
+		val = os.Getenv("TICKER")
+	}
+
+	var tickers []string
+	seen := make(map[string]bool)
+	for _, t := range strings.Split(val, ",") {
+		t = normalizeSymbol(t)
+		if t == "" || seen[t] {
+			continue
+		}
+		seen[t] = true
+		tickers = append(tickers, t)
+	}
+	if len(tickers) == 0 {
+		tickers = []string{defaultSymbol}
+	}
+	return tickers
+}
+
+// ensureSymbolColumns adds the symbol column to tables created before
+// multi-ticker support. Existing rows were all collected for XBT.
+func ensureSymbolColumns(db *sql.DB) error {
+	for _, table := range []string{"btc_price", "trading_signals", "settings"} {
+		has, err := hasColumn(db, table, "symbol")
+		if err != nil {
+			return err
+		}
+		if has {
+			continue
+		}
+		def := fmt.Sprintf("'%s'", defaultSymbol)
+		if table == "settings" {
+			def = "''" // settings without a symbol apply to every symbol
+		}
+		if _, err := db.Exec(fmt.Sprintf(`ALTER TABLE %s ADD COLUMN symbol TEXT NOT NULL DEFAULT %s`, table, def)); err != nil {
+			return fmt.Errorf("failed to add symbol column to %s: %w", table, err)
+		}
+	}
+
+	_, err := db.Exec(`CREATE INDEX IF NOT EXISTS idx_btc_price_symbol_timestamp ON btc_price (symbol, timestamp)`)
+	return err
+}
+
+// ensureColumn adds column to table with the given type and default clause
+// unless it already exists.
+func ensureColumn(db *sql.DB, table, column, def string) error {
+	has, err := hasColumn(db, table, column)
+	if err != nil || has {
+		return err
+	}
+	if _, err := db.Exec(fmt.Sprintf(`ALTER TABLE %s ADD COLUMN %s %s`, table, column, def)); err != nil {
+		return fmt.Errorf("failed to add %s column to %s: %w", column, table, err)
+	}
+	return nil
+}
+
+// hasColumn reports whether table has a column with the given name.
+func hasColumn(db *sql.DB, table, column string) (bool, error) {
+	rows, err := db.Query(fmt.Sprintf(`PRAGMA table_info(%s)`, table))
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var cid, notNull, pk int
+		var name, colType string
+		var dflt sql.NullString
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &dflt, &pk); err != nil {
+			return false, err
+		}
+		if strings.EqualFold(name, column) {
+			return true, nil
+		}
+	}
+	return false, rows.Err()
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestConfiguredTickers(t *testing.T) {
+	t.Setenv("TICKER", "")
+	t.Setenv("TICKERS", "btc, ETH,XBT,,ltc")
+	got := configuredTickers()
+	want := []string{"XBT", "ETH", "LTC"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+
+	t.Setenv("TICKERS", "")
+	if got := configuredTickers(); !reflect.DeepEqual(got, []string{"XBT"}) {
+		t.Fatalf("expected default [XBT], got %v", got)
+	}
+}
+
+func TestEnsureSymbolColumns_MigratesExistingRows(t *testing.T) {
+	db := openTestDB(t)
+	for _, ddl := range []string{
+		`CREATE TABLE btc_price (id INTEGER PRIMARY KEY AUTOINCREMENT, price REAL, timestamp DATETIME)`,
+		`CREATE TABLE settings (id INTEGER PRIMARY KEY AUTOINCREMENT, initial_funds REAL DEFAULT 0, transaction_fee_rate REAL DEFAULT 1.0, updated_at DATETIME DEFAULT CURRENT_TIMESTAMP)`,
+		`CREATE TABLE trading_signals (id INTEGER PRIMARY KEY AUTOINCREMENT, price_id INTEGER, action TEXT, price REAL, timestamp DATETIME)`,
+		`INSERT INTO btc_price (price, timestamp) VALUES (100, '2024-01-01 00:00:00')`,
+	} {
+		if _, err := db.Exec(ddl); err != nil {
+			t.Fatalf("setup failed: %v", err)
+		}
+	}
+
+	if err := ensureSymbolColumns(db); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// Running twice must be a no-op
+	if err := ensureSymbolColumns(db); err != nil {
+		t.Fatalf("unexpected error on second run: %v", err)
+	}
+
+	var symbol string
+	if err := db.QueryRow(`SELECT symbol FROM btc_price`).Scan(&symbol); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if symbol != "XBT" {
+		t.Fatalf("expected existing rows to become XBT, got %s", symbol)
+	}
+}
@@ -1,57 +1,40 @@
 package main
 
 import (
-	"database/sql"
 	"fmt"
 	"log"
+	"os"
 	"time"
 
-	_ "modernc.org/sqlite"
+	"crypto-trader/store"
 )
 
 func main() {
-	db, err := sql.Open("sqlite", "btc_prices.db")
+	db, err := store.Open(os.Getenv("DATABASE_URL"))
 	if err != nil {
 		log.Fatal(err)
 	}
 	defer db.Close()
 
-	// Get last two price IDs
-	rows, err := db.Query("SELECT id, price FROM btc_price ORDER BY id DESC LIMIT 2")
+	st := store.New(db)
+
+	// Get the last two prices
+	prices, err := st.RecentPrices("XBT", 2)
 	if err != nil {
 		log.Fatal(err)
 	}
-	defer rows.Close()
-	var ids []int
-	var prices []float64
-	for rows.Next() {
-		var id int
-		var price float64
-		if err := rows.Scan(&id, &price); err != nil {
-			continue
-		}
-		ids = append(ids, id)
-		prices = append(prices, price)
-	}
-	if len(ids) == 0 {
+	if len(prices) == 0 {
 		log.Fatal("no price rows found")
 	}
 
 	// Insert a BUY for the most recent price, and a SELL for the second-most recent (if available)
 	now := time.Now().UTC()
-	res, err := db.Exec("INSERT INTO trading_signals (price_id, action, price, timestamp) VALUES (?, ?, ?, ?)", ids[0], "BUY", prices[0], now)
-	if err != nil {
-		log.Fatal(err)
-	}
-	lastID, _ := res.LastInsertId()
-	fmt.Printf("Inserted BUY signal id=%d for price_id=%d\n", lastID, ids[0])
-	if len(ids) > 1 {
-		res2, err := db.Exec("INSERT INTO trading_signals (price_id, action, price, timestamp) VALUES (?, ?, ?, ?)", ids[1], "SELL", prices[1], now)
+	for i, action := range []string{"BUY", "SELL"}[:len(prices)] {
+		id, err := st.InsertSignal(store.Signal{PriceID: prices[i].ID, Symbol: "XBT", Action: action, Price: prices[i].Price, Timestamp: now})
 		if err != nil {
 			log.Fatal(err)
 		}
-		lastID2, _ := res2.LastInsertId()
-		fmt.Printf("Inserted SELL signal id=%d for price_id=%d\n", lastID2, ids[1])
+		fmt.Printf("Inserted %s signal id=%d for price_id=%d\n", action, id, prices[i].ID)
 	}
 
 	fmt.Println("Done")
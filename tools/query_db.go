@@ -1,50 +1,40 @@
 package main
 
 import (
-	"database/sql"
+	"flag"
 	"fmt"
 	"log"
+	"os"
 
-	_ "modernc.org/sqlite"
+	"crypto-trader/store"
 )
 
 func main() {
-	db, err := sql.Open("sqlite", "btc_prices.db")
+	symbol := flag.String("symbol", "XBT", "Symbol to show (Kraken asset code, e.g. XBT, ETH)")
+	flag.Parse()
+
+	db, err := store.Open(os.Getenv("DATABASE_URL"))
 	if err != nil {
 		log.Fatal(err)
 	}
 	defer db.Close()
+	st := store.New(db)
 
 	fmt.Println("Recent btc_price rows:")
-	rows, err := db.Query("SELECT id, price, timestamp FROM btc_price ORDER BY id DESC LIMIT 10")
+	prices, err := st.RecentPrices(*symbol, 10)
 	if err != nil {
 		log.Fatal(err)
 	}
-	defer rows.Close()
-	for rows.Next() {
-		var id int
-		var price float64
-		var ts string
-		if err := rows.Scan(&id, &price, &ts); err != nil {
-			continue
-		}
-		fmt.Printf("id=%d price=%.2f ts=%s\n", id, price, ts)
+	for _, p := range prices {
+		fmt.Printf("id=%d price=%.2f ts=%s\n", p.ID, p.Price, p.Timestamp)
 	}
 
 	fmt.Println("\nRecent trading_signals:")
-	sRows, err := db.Query("SELECT id, price_id, action, price, timestamp FROM trading_signals ORDER BY id DESC LIMIT 20")
+	signals, err := st.RecentSignals(*symbol, 20)
 	if err != nil {
 		log.Fatal(err)
 	}
-	defer sRows.Close()
-	for sRows.Next() {
-		var id, priceID int
-		var action string
-		var price float64
-		var ts string
-		if err := sRows.Scan(&id, &priceID, &action, &price, &ts); err != nil {
-			continue
-		}
-		fmt.Printf("id=%d price_id=%d action=%s price=%.2f ts=%s\n", id, priceID, action, price, ts)
+	for _, s := range signals {
+		fmt.Printf("id=%d price_id=%d action=%s price=%.2f ts=%s\n", s.ID, s.PriceID, s.Action, s.Price, s.Timestamp)
 	}
 }
@@ -1,76 +1,35 @@
 package main
 
 import (
-	"database/sql"
 	"flag"
 	"fmt"
 	"log"
 	"os"
 	"time"
 
-	_ "modernc.org/sqlite"
+	"crypto-trader/indicators"
+	"crypto-trader/store"
 )
 
-func computeWMA(prices []float64, window int) []float64 {
-	n := len(prices)
-	if n == 0 {
-		return nil
-	}
-	if window < 1 {
-		window = 1
-	}
-	res := make([]float64, n)
-	for i := 0; i < n; i++ {
-		start := i - window + 1
-		if start < 0 {
-			start = 0
-		}
-		var weightedSum, sumWeights float64
-		for j := start; j <= i; j++ {
-			weight := float64(j - start + 1)
-			weightedSum += prices[j] * weight
-			sumWeights += weight
-		}
-		if sumWeights == 0 {
-			res[i] = prices[i]
-		} else {
-			res[i] = weightedSum / sumWeights
-		}
-	}
-	return res
-}
-
 func main() {
 	days := flag.Int("days", 30, "Number of days to consider when estimating samples per day for WMA windows")
 	dry := flag.Bool("dry", false, "Dry run: don't insert into DB")
+	symbol := flag.String("symbol", "XBT", "Symbol to evaluate (Kraken asset code, e.g. XBT, ETH)")
 	flag.Parse()
 
-	db, err := sql.Open("sqlite", "btc_prices.db")
+	db, err := store.Open(os.Getenv("DATABASE_URL"))
 	if err != nil {
 		log.Fatal(err)
 	}
 	defer db.Close()
 
-	query := fmt.Sprintf("SELECT id, price, timestamp FROM btc_price WHERE timestamp >= datetime('now', '-%d day') ORDER BY timestamp ASC", *days)
-	rows, err := db.Query(query)
+	st := store.New(db)
+
+	since := time.Now().AddDate(0, 0, -*days)
+	prices, err := st.PricesSince(*symbol, since)
 	if err != nil {
 		log.Fatal(err)
 	}
-	defer rows.Close()
-
-	type P struct {
-		ID        int
-		Price     float64
-		Timestamp string
-	}
-	var prices []P
-	for rows.Next() {
-		var p P
-		if err := rows.Scan(&p.ID, &p.Price, &p.Timestamp); err != nil {
-			continue
-		}
-		prices = append(prices, p)
-	}
 	if len(prices) == 0 {
 		log.Fatal("no prices found")
 	}
@@ -118,8 +77,18 @@ func main() {
 
 	fmt.Printf("Processing %d price points, samples/day=%.2f, window7=%d, window30=%d\n", len(raw), samplesPerDay, window7, window30)
 
-	wma7 := computeWMA(raw, window7)
-	wma30 := computeWMA(raw, window30)
+	wma7 := indicators.WMASeries(raw, window7)
+	wma30 := indicators.WMASeries(raw, window30)
+
+	// Signals already recorded, so re-running never duplicates them
+	existing := make(map[string]bool)
+	signals, err := st.SignalsSince(*symbol, since)
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, s := range signals {
+		existing[fmt.Sprintf("%d/%s", s.PriceID, s.Action)] = true
+	}
 
 	inserted := 0
 	for i := 1; i < len(raw); i++ {
@@ -138,13 +107,7 @@ func main() {
 		}
 
 		// Check if a signal already exists for this price_id and action
-		var cnt int
-		err := db.QueryRow("SELECT COUNT(1) FROM trading_signals WHERE price_id = ? AND action = ?", prices[i].ID, action).Scan(&cnt)
-		if err != nil {
-			log.Fatal(err)
-		}
-		if cnt > 0 {
-			// already exists
+		if existing[fmt.Sprintf("%d/%s", prices[i].ID, action)] {
 			continue
 		}
 
@@ -154,7 +117,7 @@ func main() {
 			continue
 		}
 
-		_, err = db.Exec("INSERT INTO trading_signals (price_id, action, price, timestamp) VALUES (?, ?, ?, ?)", prices[i].ID, action, prices[i].Price, time.Now().UTC())
+		_, err = st.InsertSignal(store.Signal{PriceID: prices[i].ID, Symbol: *symbol, Action: action, Price: prices[i].Price, Timestamp: time.Now().UTC()})
 		if err != nil {
 			log.Fatal(err)
 		}
@@ -0,0 +1,346 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"crypto-trader/store"
+)
+
+// WalkForwardWindow is one in-sample/out-of-sample step of a walk-forward run.
+type WalkForwardWindow struct {
+	InFrom    time.Time       `json:"in_from"`
+	InTo      time.Time       `json:"in_to"`
+	OutFrom   time.Time       `json:"out_from"`
+	OutTo     time.Time       `json:"out_to"`
+	Params    string          `json:"params"` // best in-sample parameters, traded out of sample
+	InSample  *OptimizeRun    `json:"in_sample"`
+	OutSample *BacktestResult `json:"-"`
+	OutReturn float64         `json:"out_return"`
+	OutTrades int             `json:"out_trades"`
+	Error     string          `json:"error,omitempty"` // why the window was not traded
+}
+
+// WalkForwardResult is the stitched out-of-sample performance of a walk-forward run.
+type WalkForwardResult struct {
+	Windows      []*WalkForwardWindow `json:"windows"`
+	Equity       []EquityPoint        `json:"-"`
+	InitialFunds float64              `json:"initial_funds"`
+	FinalEquity  float64              `json:"final_equity"`
+	TotalReturn  float64              `json:"total_return"`
+	MaxDrawdown  float64              `json:"max_drawdown"`
+	WinRate      float64              `json:"win_rate"`
+	Sharpe       float64              `json:"sharpe"`
+	Trades       int                  `json:"trades"`
+}
+
+// walkForwardWindows splits [from, to) into rolling windows: train of
+// in-sample history followed by test out of sample, advancing by test so the
+// out-of-sample periods tile the range without overlapping.
+func walkForwardWindows(from, to time.Time, train, test time.Duration) []*WalkForwardWindow {
+	var windows []*WalkForwardWindow
+	for start := from; !start.Add(train + test).After(to); start = start.Add(test) {
+		windows = append(windows, &WalkForwardWindow{
+			InFrom:  start,
+			InTo:    start.Add(train),
+			OutFrom: start.Add(train),
+			OutTo:   start.Add(train + test),
+		})
+	}
+	return windows
+}
+
+// runWalkForward optimizes the named strategy over each window's in-sample
+// period and trades the winning parameters over its out-of-sample period,
+// carrying equity from one window to the next. history loads replay data for
+// a candle interval, lookback and range. Positions still open at the end of
+// an out-of-sample period are closed at its last price, paying the fee.
+func runWalkForward(name string, combos []map[string]string, windows []*WalkForwardWindow, rank string, workers int,
+	cfg BacktestConfig, symbol string, history func(interval int, lookback time.Duration, from, to time.Time) (*backtestData, error)) (*WalkForwardResult, error) {
+
+	result := &WalkForwardResult{Windows: windows, InitialFunds: cfg.InitialFunds}
+	equity := cfg.InitialFunds
+	wins := 0
+	for _, w := range windows {
+		// Ranges are half-open so adjacent windows never replay the same price
+		inTo, outTo := w.InTo.Add(-time.Nanosecond), w.OutTo.Add(-time.Nanosecond)
+
+		runs, err := runOptimize(name, combos, workers, cfg, symbol, func(interval int, lookback time.Duration) (*backtestData, error) {
+			return history(interval, lookback, w.InFrom, inTo)
+		})
+		if err != nil {
+			return nil, err
+		}
+		rankOptimizeRuns(runs, rank)
+		if len(runs) == 0 || runs[0].Error != "" {
+			w.Error = "no valid parameter combination"
+			continue
+		}
+		w.InSample, w.Params = runs[0], runs[0].Params
+
+		params, err := parseStrategyParams(w.Params)
+		if err != nil {
+			return nil, err
+		}
+		strategy, err := newStrategy(name, params)
+		if err != nil {
+			return nil, err
+		}
+		interval, lookback := strategy.History()
+		data, err := history(interval, lookback, w.OutFrom, outTo)
+		if err != nil {
+			return nil, err
+		}
+		if len(data.Prices) == 0 {
+			w.Error = "no prices out of sample"
+			continue
+		}
+
+		out := runBacktest(strategy, symbol, data, BacktestConfig{InitialFunds: equity, FeeRate: cfg.FeeRate, Ladder: cfg.Ladder})
+		w.OutSample = out
+		end := out.FinalEquity
+		for _, t := range out.Trades {
+			pnl := t.PnL
+			if t.Open {
+				// What is still held is worth PnL + Cost - Proceeds
+				exitFee := (t.PnL + t.Cost - t.Proceeds) * cfg.FeeRate / 100
+				end -= exitFee
+				pnl -= exitFee
+			}
+			result.Trades++
+			if pnl > 0 {
+				wins++
+			}
+		}
+		if equity > 0 {
+			w.OutReturn = end/equity - 1
+		}
+		w.OutTrades = len(out.Trades)
+		equity = end
+
+		result.Equity = append(result.Equity, out.Equity...)
+		if n := len(result.Equity); n > 0 {
+			result.Equity[n-1].Equity = end
+		}
+	}
+
+	result.FinalEquity = equity
+	if cfg.InitialFunds > 0 {
+		result.TotalReturn = equity/cfg.InitialFunds - 1
+	}
+	result.MaxDrawdown = maxDrawdown(result.Equity)
+	result.Sharpe = sharpeRatio(result.Equity)
+	if result.Trades > 0 {
+		result.WinRate = float64(wins) / float64(result.Trades)
+	}
+	return result, nil
+}
+
+// parameterStability counts how often each value of each parameter was chosen
+// and how many times the chosen value changed between consecutive windows.
+func parameterStability(windows []*WalkForwardWindow) (counts map[string]map[string]int, changes map[string]int) {
+	counts = make(map[string]map[string]int)
+	changes = make(map[string]int)
+	var prev map[string]string
+	for _, w := range windows {
+		if w.Params == "" {
+			continue
+		}
+		params, err := parseStrategyParams(w.Params)
+		if err != nil {
+			continue
+		}
+		for k, v := range params {
+			if counts[k] == nil {
+				counts[k] = make(map[string]int)
+			}
+			counts[k][v]++
+			if prev != nil && prev[k] != v {
+				changes[k]++
+			}
+		}
+		prev = params
+	}
+	return counts, changes
+}
+
+// walkForwardCommand implements `crypto-trader walkforward`: rolling
+// in-sample optimization scored on the following out-of-sample period.
+func walkForwardCommand(args []string) {
+	fs := flag.NewFlagSet("walkforward", flag.ExitOnError)
+	symbol := fs.String("symbol", configuredTickers()[0], "Symbol to validate on (e.g. BTC, ETH)")
+	fromFlag := fs.String("from", "", "Start of the range, 2006-01-02 or RFC 3339 (default: -days before -to)")
+	toFlag := fs.String("to", "", "End of the range, 2006-01-02 or RFC 3339 (default: now)")
+	days := fs.Int("days", 120, "Days of history to walk through when -from is not set")
+	trainFlag := fs.String("train", "30d", "In-sample window to optimize over")
+	testFlag := fs.String("test", "7d", "Out-of-sample window to trade the chosen parameters over")
+	strategyName := fs.String("strategy", "", "Strategy to validate (default: STRATEGY setting)")
+	baseParams := fs.String("params", "", "Fixed parameters as key=value,key=value, overridden by the grid")
+	gridFlag := fs.String("grid", "fast=1d..7d:1d;slow=7d..30d:7d", "Parameter grid, e.g. fast=3d..20d:1d;slow=10d,30d,60d")
+	workers := fs.Int("workers", runtime.NumCPU(), "Backtests to run in parallel")
+	rank := fs.String("rank", "return", "In-sample metric to pick parameters by (return, sharpe, drawdown, winrate)")
+	funds := fs.Float64("funds", 0, "Initial funds (default: settings table, else 10000)")
+	fee := fs.Float64("fee", -1, "Transaction fee percent per trade (default: settings table)")
+	ladder := fs.String("ladder", os.Getenv("EXIT_LADDER"), "Exit ladder tiers as gain:fraction,... (default: EXIT_LADDER setting)")
+	equityFile := fs.String("equity", "", "Write the stitched out-of-sample equity curve to this CSV file")
+	jsonFile := fs.String("json", "", "Write the windows and summary to this JSON file")
+	fs.Parse(args)
+
+	name := *strategyName
+	if name == "" {
+		if name = strings.TrimSpace(os.Getenv("STRATEGY")); name == "" {
+			name = "wma_crossover"
+		}
+	}
+	if _, ok := optimizeRankings[*rank]; !ok {
+		fmt.Println("Unknown -rank:", *rank)
+		os.Exit(1)
+	}
+	train, err := parseWindow(*trainFlag)
+	if err != nil {
+		fmt.Println("Invalid -train:", err)
+		os.Exit(1)
+	}
+	test, err := parseWindow(*testFlag)
+	if err != nil {
+		fmt.Println("Invalid -test:", err)
+		os.Exit(1)
+	}
+	base, err := parseStrategyParams(*baseParams)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	grid, err := parseGrid(*gridFlag)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	from, to, err := backtestRange(*fromFlag, *toFlag, *days)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	windows := walkForwardWindows(from, to, train, test)
+	if len(windows) == 0 {
+		fmt.Printf("Range %s to %s is shorter than one %s + %s window\n",
+			from.Format("2006-01-02"), to.Format("2006-01-02"), formatWindow(train), formatWindow(test))
+		os.Exit(1)
+	}
+	sym := normalizeSymbol(*symbol)
+
+	db, err := openDatabase()
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	defer db.Close()
+
+	if _, err := catchUpCandles(store.New(db), sym); err != nil {
+		fmt.Println("Error aggregating candles:", err)
+		os.Exit(1)
+	}
+
+	cfg := backtestSettings(db, sym)
+	if *funds > 0 {
+		cfg.InitialFunds = *funds
+	}
+	if *fee >= 0 {
+		cfg.FeeRate = *fee
+	}
+	if cfg.Ladder, err = parseExitLadder(*ladder); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	combos := gridCombinations(grid, base)
+	fmt.Printf("Walk-forward %s on %s, %s to %s: %d windows of %s in-sample + %s out-of-sample, %d combinations each\n\n",
+		name, sym, from.Format("2006-01-02"), to.Format("2006-01-02"), len(windows),
+		formatWindow(train), formatWindow(test), len(combos))
+
+	result, err := runWalkForward(name, combos, windows, *rank, *workers, cfg, sym,
+		func(interval int, lookback time.Duration, from, to time.Time) (*backtestData, error) {
+			return loadBacktestHistory(db, sym, interval, lookback, from, to)
+		})
+	if err != nil {
+		fmt.Println("Error running walk-forward:", err)
+		os.Exit(1)
+	}
+	printWalkForwardResult(result)
+
+	if *equityFile != "" {
+		if err := writeEquityCSV(*equityFile, result.Equity); err != nil {
+			fmt.Println("Error writing equity curve:", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Equity curve written to %s\n", *equityFile)
+	}
+	if *jsonFile != "" {
+		out, err := json.MarshalIndent(result, "", "  ")
+		if err == nil {
+			err = os.WriteFile(*jsonFile, out, 0o644)
+		}
+		if err != nil {
+			fmt.Println("Error writing JSON:", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Results written to %s\n", *jsonFile)
+	}
+}
+
+// printWalkForwardResult prints each window, the stitched out-of-sample
+// summary and how stable the chosen parameters were.
+func printWalkForwardResult(r *WalkForwardResult) {
+	fmt.Printf("%-23s %-23s %-28s %9s %9s %7s\n", "in-sample", "out-of-sample", "params", "in ret", "out ret", "trades")
+	for _, w := range r.Windows {
+		inRange := w.InFrom.Format("01-02 15:04") + " - " + w.InTo.Format("01-02")
+		outRange := w.OutFrom.Format("01-02 15:04") + " - " + w.OutTo.Format("01-02")
+		if w.Error != "" {
+			fmt.Printf("%-23s %-23s %s\n", inRange, outRange, w.Error)
+			continue
+		}
+		fmt.Printf("%-23s %-23s %-28s %8.2f%% %8.2f%% %7d\n",
+			inRange, outRange, w.Params, w.InSample.TotalReturn*100, w.OutReturn*100, w.OutTrades)
+	}
+
+	fmt.Println("\nOut-of-sample equity curve (daily close):")
+	for _, e := range dailyEquity(r.Equity) {
+		fmt.Printf("  %s  price $%.2f  equity $%.2f\n", e.Time.Format("2006-01-02"), e.Price, e.Equity)
+	}
+
+	fmt.Println("\nOut-of-sample summary:")
+	fmt.Printf("  Initial funds:  $%.2f\n", r.InitialFunds)
+	fmt.Printf("  Final equity:   $%.2f\n", r.FinalEquity)
+	fmt.Printf("  Total return:   %+.2f%%\n", r.TotalReturn*100)
+	fmt.Printf("  Max drawdown:   %.2f%%\n", r.MaxDrawdown*100)
+	fmt.Printf("  Trades:         %d\n", r.Trades)
+	fmt.Printf("  Win rate:       %.1f%%\n", r.WinRate*100)
+	fmt.Printf("  Sharpe ratio:   %.2f\n", r.Sharpe)
+
+	counts, changes := parameterStability(r.Windows)
+	var names []string
+	for k := range counts {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	fmt.Println("\nParameter stability:")
+	for _, k := range names {
+		var values []string
+		for v := range counts[k] {
+			values = append(values, v)
+		}
+		sort.Strings(values)
+		sort.SliceStable(values, func(i, j int) bool { return counts[k][values[i]] > counts[k][values[j]] })
+		var parts []string
+		for _, v := range values {
+			parts = append(parts, fmt.Sprintf("%s x%d", v, counts[k][v]))
+		}
+		fmt.Printf("  %-10s %s (changed %d times)\n", k+":", strings.Join(parts, ", "), changes[k])
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestWalkForwardWindows_OutOfSampleTilesRange(t *testing.T) {
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	windows := walkForwardWindows(from, from.AddDate(0, 0, 20), 10*24*time.Hour, 3*24*time.Hour)
+	if len(windows) != 3 {
+		t.Fatalf("expected 3 windows, got %d", len(windows))
+	}
+	for i, w := range windows {
+		if !w.OutFrom.Equal(w.InTo) {
+			t.Fatalf("window %d: out-of-sample should start where in-sample ends", i)
+		}
+		if i > 0 && !w.OutFrom.Equal(windows[i-1].OutTo) {
+			t.Fatalf("window %d: out-of-sample periods should be contiguous", i)
+		}
+	}
+}
+
+func TestRunWalkForward_TradesInSampleWinnerOutOfSample(t *testing.T) {
+	registerBandStrategy()
+
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	var prices []pricePoint
+	for i, p := range []float64{100, 90, 120, 100, 80, 120, 100} {
+		prices = append(prices, pricePoint{Time: from.Add(time.Duration(i) * time.Hour), Price: p})
+	}
+	history := func(interval int, lookback time.Duration, start, end time.Time) (*backtestData, error) {
+		data := &backtestData{Start: from}
+		for _, p := range prices {
+			if !p.Time.Before(start) && !p.Time.After(end) {
+				data.Prices = append(data.Prices, p)
+			}
+		}
+		return data, nil
+	}
+
+	// One window: hours 0-2 in sample (only low=95 trades), hours 3-5 out of sample
+	windows := walkForwardWindows(from, from.Add(6*time.Hour), 3*time.Hour, 3*time.Hour)
+	combos := gridCombinations([]gridParam{{Name: "low", Values: []string{"85", "95"}}}, nil)
+	result, err := runWalkForward("band", combos, windows, "return", 2, BacktestConfig{InitialFunds: 1000}, "XBT", history)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(result.Windows) != 1 || result.Windows[0].Params != "low=95" {
+		t.Fatalf("expected low=95 to be chosen, got %+v", result.Windows)
+	}
+	// Out of sample it buys at 80 and sells at 120
+	if math.Abs(result.TotalReturn-0.5) > 1e-9 || result.Trades != 1 || result.WinRate != 1 {
+		t.Fatalf("unexpected out-of-sample result: %+v", result)
+	}
+	if len(result.Equity) != 3 {
+		t.Fatalf("expected 3 out-of-sample equity points, got %d", len(result.Equity))
+	}
+}
+
+func TestParameterStability_CountsChanges(t *testing.T) {
+	windows := []*WalkForwardWindow{
+		{Params: "fast=1d,slow=7d"},
+		{Params: "fast=2d,slow=7d"},
+		{Error: "no valid parameter combination"},
+		{Params: "fast=1d,slow=7d"},
+	}
+	counts, changes := parameterStability(windows)
+	if counts["fast"]["1d"] != 2 || counts["slow"]["7d"] != 3 {
+		t.Fatalf("unexpected counts: %v", counts)
+	}
+	if changes["fast"] != 2 || changes["slow"] != 0 {
+		t.Fatalf("unexpected changes: %v", changes)
+	}
+}